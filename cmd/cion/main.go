@@ -1,3 +1,31 @@
 package main
 
-func main() {}
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: cion <command> [arguments]
+
+Commands:
+  trc    run the TRC signing ceremony
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "trc":
+		err = runTRC(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+)
+
+const trcUsage = `Usage: cion trc <command> [arguments]
+
+A base TRC is created in a ceremony:
+
+  1. payload: build the TRC payload from the voting and root certificates of
+     the core ASes.
+  2. sign: every voter signs the payload with its voting key.
+  3. combine: the signatures are combined into the signed TRC, which is
+     verified and optionally inserted into the trust database.
+
+A TRC update follows the same steps, with the payload built by propose. The
+voters of the update, the new voters and the replaced root certificates sign
+the payload, and combine verifies the update against its predecessor.
+
+Commands:
+  payload    build a base TRC payload
+  propose    build a TRC update payload
+  sign       sign a TRC payload
+  combine    combine signed TRCs
+`
+
+func runTRC(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, trcUsage)
+		return errors.New("missing TRC command")
+	}
+	switch args[0] {
+	case "payload":
+		return runTRCPayload(args[1:])
+	case "propose":
+		return runTRCPropose(args[1:])
+	case "sign":
+		return runTRCSign(args[1:])
+	case "combine":
+		return runTRCCombine(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, trcUsage)
+		return fmt.Errorf("unknown TRC command %q", args[0])
+	}
+}
+
+func runTRCPayload(args []string) error {
+	fs := flag.NewFlagSet("trc payload", flag.ContinueOnError)
+	isd := fs.Uint("isd", 0, "ISD of the TRC")
+	description := fs.String("description", "", "description of the TRC")
+	quorum := fs.Int("quorum", 0, "voting quorum, zero for a majority of the voters")
+	notBefore := fs.String("not-before", "", "start of the TRC validity (RFC 3339), empty for the certificate validity")
+	notAfter := fs.String("not-after", "", "end of the TRC validity (RFC 3339), empty for the certificate validity")
+	out := fs.String("out", "", "output file of the DER encoded payload")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cion trc payload -isd <isd> -out <file> <certificate files>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *isd == 0 || *out == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing arguments")
+	}
+
+	certs, err := readCerts(fs.Args())
+	if err != nil {
+		return err
+	}
+	var validity cppki.Validity
+	if *notBefore != "" || *notAfter != "" {
+		if validity.NotBefore, err = time.Parse(time.RFC3339, *notBefore); err != nil {
+			return fmt.Errorf("parsing -not-before: %w", err)
+		}
+		if validity.NotAfter, err = time.Parse(time.RFC3339, *notAfter); err != nil {
+			return fmt.Errorf("parsing -not-after: %w", err)
+		}
+	}
+	trc, err := pki.NewBaseTRC(pki.BaseTRCConfig{
+		ISD:          addr.ISD(*isd),
+		Description:  *description,
+		Validity:     validity,
+		Quorum:       *quorum,
+		Certificates: certs,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, trc.Raw, 0o644)
+}
+
+func runTRCPropose(args []string) error {
+	fs := flag.NewFlagSet("trc propose", flag.ContinueOnError)
+	predecessor := fs.String("predecessor", "", "signed predecessor TRC")
+	sensitive := fs.Bool("sensitive", false, "propose a sensitive instead of a regular update")
+	description := fs.String("description", "", "description of the TRC, empty to keep the predecessor's")
+	quorum := fs.Int("quorum", 0, "voting quorum, zero to keep the predecessor's")
+	grace := fs.Duration("grace", 0, "grace period of the predecessor, zero for the default")
+	var voters fileList
+	fs.Var(&voters, "voter", "voting certificate in the predecessor that votes, repeatable, none for all voters")
+	out := fs.String("out", "", "output file of the DER encoded payload")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(),
+			"Usage: cion trc propose -predecessor <file> -out <file> [<certificate files>...]")
+		fmt.Fprintln(fs.Output(), "Without certificate files, the certificates of the predecessor are kept.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *predecessor == "" || *out == "" {
+		fs.Usage()
+		return errors.New("missing arguments")
+	}
+
+	pred, err := readSignedTRC(*predecessor)
+	if err != nil {
+		return err
+	}
+	certs, err := readCerts(fs.Args())
+	if err != nil {
+		return err
+	}
+	voterCerts, err := readCerts(voters)
+	if err != nil {
+		return err
+	}
+	typ := cppki.RegularUpdate
+	if *sensitive {
+		typ = cppki.SensitiveUpdate
+	}
+	proposal, err := pki.ProposeTRCUpdate(pred.TRC, pki.TRCUpdateConfig{
+		Type:         typ,
+		Description:  *description,
+		GracePeriod:  *grace,
+		Quorum:       *quorum,
+		Certificates: certs,
+		Voters:       voterCerts,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, proposal.TRC.Raw, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Proposed %s update %s, to be signed by:\n", typ, proposal.TRC.ID)
+	for _, cert := range proposal.Signers() {
+		fmt.Printf("  %s\n", cert.Subject.CommonName)
+	}
+	return nil
+}
+
+func runTRCSign(args []string) error {
+	fs := flag.NewFlagSet("trc sign", flag.ContinueOnError)
+	cert := fs.String("cert", "", "PEM encoded voting certificate")
+	key := fs.String("key", "", "PEM encoded PKCS#8 voting key")
+	out := fs.String("out", "", "output file of the signed TRC")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cion trc sign -cert <file> -key <file> -out <file> <payload file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cert == "" || *key == "" || *out == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing arguments")
+	}
+
+	payload, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	certs, err := cppki.ReadPEMCerts(*cert)
+	if err != nil {
+		return err
+	}
+	signer, err := trust.LoadPrivateKey(*key)
+	if err != nil {
+		return err
+	}
+	signed, err := pki.SignTRC(payload, pki.Credential{Key: signer, Cert: certs[0]})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, signed, 0o644)
+}
+
+func runTRCCombine(args []string) error {
+	fs := flag.NewFlagSet("trc combine", flag.ContinueOnError)
+	predecessor := fs.String("predecessor", "", "signed predecessor TRC of a TRC update")
+	db := fs.String("db", "", "trust database to insert the TRC into, empty to skip insertion")
+	out := fs.String("out", "", "output file of the signed TRC")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cion trc combine -out <file> <signed TRC files>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing arguments")
+	}
+
+	var parts [][]byte
+	for _, file := range fs.Args() {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, raw)
+	}
+	var pred *cppki.TRC
+	if *predecessor != "" {
+		signed, err := readSignedTRC(*predecessor)
+		if err != nil {
+			return err
+		}
+		pred = &signed.TRC
+	}
+	signed, err := pki.CombineTRC(pred, parts...)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, signed.Raw, 0o644); err != nil {
+		return err
+	}
+	if *db == "" {
+		return nil
+	}
+	trustDB, err := bbolt.New(*db, nil)
+	if err != nil {
+		return err
+	}
+	defer trustDB.Close()
+	_, err = trust.TRCVerifier{DB: trustDB}.Insert(context.Background(), signed)
+	return err
+}
+
+// fileList is a repeatable file flag.
+type fileList []string
+
+func (l *fileList) String() string { return fmt.Sprint(*l) }
+
+func (l *fileList) Set(file string) error {
+	*l = append(*l, file)
+	return nil
+}
+
+// readCerts reads the PEM encoded certificates in the files. It returns nil
+// without files.
+func readCerts(files []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, file := range files {
+		c, err := cppki.ReadPEMCerts(file)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c...)
+	}
+	return certs, nil
+}
+
+func readSignedTRC(file string) (cppki.SignedTRC, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return cppki.SignedTRC{}, err
+	}
+	return cppki.DecodeSignedTRC(raw)
+}
@@ -0,0 +1,35 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/scionproto/scion/pkg/addr"
+	seg "github.com/scionproto/scion/pkg/segment"
+)
+
+// Beacon consists of the path segment and the interface it was received on.
+type Beacon struct {
+	// Segment is the path segment.
+	Segment *seg.PathSegment
+	// InIfID is the interface the beacon is received on. It is zero for
+	// beacons originated by the local AS.
+	InIfID uint16
+}
+
+func (b Beacon) String() string {
+	return fmt.Sprintf("Ingress: %d Segment: [ %s ]", b.InIfID, b.Segment)
+}
+
+// DB is the database interface for received beacons.
+type DB interface {
+	// Beacons looks up all beacons originated by the given ISD-AS. A zero
+	// ISD-AS returns the beacons of all origins.
+	Beacons(ctx context.Context, origin addr.IA) ([]Beacon, error)
+	// Insert inserts the given beacon. A beacon with the same ID is replaced
+	// if the given beacon is more recent. Returns true if the beacon was
+	// inserted or replaced an older one.
+	Insert(context.Context, Beacon) (bool, error)
+
+	Close() error
+}
@@ -0,0 +1,183 @@
+package bbolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fancl20/cion/pkg/beacon"
+
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+// The beacons are stored in the "beacons" bucket keyed by origin ISD-AS and
+// segment ID, the value is the ingress interface followed by the segment. The
+// "expiry" bucket indexes the beacons by their expiration time.
+var (
+	beaconsBucket = []byte("beacons")
+	expiryBucket  = []byte("expiry")
+)
+
+type bboltDB struct {
+	db *bbolt.DB
+}
+
+func New(path string, opts *bbolt.Options) (beacon.DB, error) {
+	db, err := bbolt.Open(path, 0600, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, s := range [][]byte{beaconsBucket, expiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &bboltDB{
+		db: db,
+	}, nil
+}
+
+// Beacons looks up all beacons originated by the given ISD-AS. Wildcard
+// identifiers are allowed. Expired beacons are never returned.
+func (b *bboltDB) Beacons(ctx context.Context, origin addr.IA) ([]beacon.Beacon, error) {
+	now := time.Now()
+	var beacons []beacon.Beacon
+	if err := b.db.View(func(tx *bbolt.Tx) error {
+		prefix := iaPrefix(origin)
+		c := tx.Bucket(beaconsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			bcn, err := decodeBeacon(v)
+			if err != nil {
+				return err
+			}
+			if bcn.Segment.MinExpiry().After(now) {
+				beacons = append(beacons, bcn)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return beacons, nil
+}
+
+// Insert inserts the given beacon. Expired beacons are removed from the DB on
+// every insert.
+func (b *bboltDB) Insert(ctx context.Context, bcn beacon.Beacon) (bool, error) {
+	now := time.Now()
+	if bcn.Segment.MinExpiry().Before(now) {
+		return false, nil
+	}
+	raw, err := proto.Marshal(seg.PathSegmentToPB(bcn.Segment))
+	if err != nil {
+		return false, fmt.Errorf("encoding beacon: %w", err)
+	}
+	raw = slices.Concat(binary.BigEndian.AppendUint16(nil, bcn.InIfID), raw)
+
+	var inserted bool
+	if err := b.db.Update(func(tx *bbolt.Tx) error {
+		if err := deleteExpired(tx, now); err != nil {
+			return err
+		}
+		key := slices.Concat(iaKey(bcn.Segment.FirstIA()), bcn.Segment.ID())
+		if v := tx.Bucket(beaconsBucket).Get(key); v != nil {
+			existing, err := decodeBeacon(v)
+			if err != nil {
+				return err
+			}
+			if !bcn.Segment.Info.Timestamp.After(existing.Segment.Info.Timestamp) {
+				return nil
+			}
+			if err := deleteBeacon(tx, key, existing); err != nil {
+				return err
+			}
+		}
+		inserted = true
+		if err := tx.Bucket(beaconsBucket).Put(key, raw); err != nil {
+			return err
+		}
+		return tx.Bucket(expiryBucket).Put(expiryKey(bcn.Segment.MinExpiry(), key), nil)
+	}); err != nil {
+		return false, err
+	}
+	return inserted, nil
+}
+
+func (b *bboltDB) Close() error {
+	return b.db.Close()
+}
+
+func deleteBeacon(tx *bbolt.Tx, key []byte, bcn beacon.Beacon) error {
+	if err := tx.Bucket(beaconsBucket).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(expiryBucket).Delete(expiryKey(bcn.Segment.MinExpiry(), key))
+}
+
+// deleteExpired removes all beacons that expired before now.
+func deleteExpired(tx *bbolt.Tx, now time.Time) error {
+	var expired [][]byte
+	c := tx.Bucket(expiryBucket).Cursor()
+	for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) < now.Unix(); k, _ = c.Next() {
+		expired = append(expired, slices.Clone(k))
+	}
+	for _, k := range expired {
+		if err := tx.Bucket(beaconsBucket).Delete(k[8:]); err != nil {
+			return err
+		}
+		if err := tx.Bucket(expiryBucket).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeBeacon(raw []byte) (beacon.Beacon, error) {
+	if len(raw) < 2 {
+		return beacon.Beacon{}, fmt.Errorf("invalid beacon length %d", len(raw))
+	}
+	var pb cppb.PathSegment
+	if err := proto.Unmarshal(raw[2:], &pb); err != nil {
+		return beacon.Beacon{}, err
+	}
+	ps, err := seg.BeaconFromPB(&pb)
+	if err != nil {
+		return beacon.Beacon{}, err
+	}
+	return beacon.Beacon{Segment: ps, InIfID: binary.BigEndian.Uint16(raw)}, nil
+}
+
+func iaKey(ia addr.IA) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(ia))
+}
+
+func expiryKey(t time.Time, key []byte) []byte {
+	return slices.Concat(binary.BigEndian.AppendUint64(nil, uint64(t.Unix())), key)
+}
+
+// iaPrefix returns the prefix of the keys matching the ISD-AS. Wildcard ISD-AS
+// identifiers result in shorter prefixes.
+func iaPrefix(ia addr.IA) []byte {
+	switch {
+	case ia.ISD() == 0:
+		return nil
+	case ia.AS() == 0:
+		return iaKey(ia)[:2]
+	default:
+		return iaKey(ia)
+	}
+}
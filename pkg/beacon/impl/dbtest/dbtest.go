@@ -0,0 +1,207 @@
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	pathdbtest "github.com/fancl20/cion/pkg/pathdb/impl/dbtest"
+)
+
+var (
+	// DefaultTimeout is the default timeout for running the test harness.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config holds the configuration for the beacon database testing harness.
+type Config struct {
+	Timeout time.Duration
+}
+
+// InitDefaults initializes the default values for the config.
+func (cfg *Config) InitDefaults() {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+}
+
+// TestableDB extends the beacon db interface with methods that are needed for testing.
+type TestableDB interface {
+	beacon.DB
+	// Prepare should reset the internal state so that the db is empty and is ready to be tested.
+	Prepare(*testing.T, context.Context)
+}
+
+// Run should be used to test any implementation of the beacon.DB interface.
+// An implementation interface should at least have one test method that calls
+// this test-suite.
+func Run(t *testing.T, db TestableDB, cfg Config) {
+	cfg.InitDefaults()
+	tests := map[string]func(*testing.T, beacon.DB, Config){
+		"test insert":  testInsert,
+		"test beacons": testBeacons,
+		"test expiry":  testExpiry,
+	}
+	// Run test suite on DB directly.
+	for name, test := range tests {
+		t.Run("DB: "+name, func(t *testing.T) {
+			ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+			defer cancelF()
+			db.Prepare(t, ctx)
+			test(t, db, cfg)
+			db.Close()
+		})
+	}
+}
+
+var (
+	core110 = addr.MustParseIA("1-ff00:0:110")
+	core111 = addr.MustParseIA("1-ff00:0:111")
+	core210 = addr.MustParseIA("2-ff00:0:210")
+	localIA = addr.MustParseIA("1-ff00:0:1")
+)
+
+func testInsert(t *testing.T, db beacon.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	now := time.Now().Truncate(time.Second)
+	bcn := beacon.Beacon{
+		Segment: pathdbtest.NewBeacon(t, now.Add(-time.Minute), localIA, 5, core110),
+		InIfID:  1,
+	}
+	in, err := db.Insert(ctx, bcn)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if !in {
+		t.Fatal("Insert should return true for new beacon")
+	}
+	t.Run("Insert existing", func(t *testing.T) {
+		in, err := db.Insert(ctx, bcn)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if in {
+			t.Error("Insert should return false for existing beacon")
+		}
+	})
+	t.Run("Insert older", func(t *testing.T) {
+		older := beacon.Beacon{
+			Segment: pathdbtest.NewBeacon(t, now.Add(-time.Hour), localIA, 5, core110),
+			InIfID:  1,
+		}
+		in, err := db.Insert(ctx, older)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if in {
+			t.Error("Insert should return false for older beacon")
+		}
+	})
+	t.Run("Insert newer", func(t *testing.T) {
+		newer := beacon.Beacon{
+			Segment: pathdbtest.NewBeacon(t, now, localIA, 5, core110),
+			InIfID:  1,
+		}
+		in, err := db.Insert(ctx, newer)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if !in {
+			t.Error("Insert should return true for newer beacon")
+		}
+		beacons, err := db.Beacons(ctx, 0)
+		if err != nil {
+			t.Fatalf("Beacons failed: %v", err)
+		}
+		if len(beacons) != 1 || beacons[0].Segment.Info.Timestamp.Unix() != now.Unix() {
+			t.Errorf("Beacons should return only the newer beacon, got %v", beacons)
+		}
+	})
+}
+
+func testBeacons(t *testing.T, db beacon.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	now := time.Now()
+	b110 := beacon.Beacon{Segment: pathdbtest.NewBeacon(t, now, localIA, 5, core110), InIfID: 1}
+	b111 := beacon.Beacon{Segment: pathdbtest.NewBeacon(t, now, localIA, 6, core111), InIfID: 2}
+	b111Via110 := beacon.Beacon{Segment: pathdbtest.NewBeacon(t, now, localIA, 7, core111, core110), InIfID: 1}
+	b210 := beacon.Beacon{Segment: pathdbtest.NewBeacon(t, now, localIA, 8, core210, core110), InIfID: 1}
+	for _, b := range []beacon.Beacon{b110, b111, b111Via110, b210} {
+		if _, err := db.Insert(ctx, b); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	tests := map[string]struct {
+		origin addr.IA
+		want   []beacon.Beacon
+	}{
+		"all":       {origin: 0, want: []beacon.Beacon{b110, b111, b111Via110, b210}},
+		"origin":    {origin: core111, want: []beacon.Beacon{b111, b111Via110}},
+		"ISD":       {origin: addr.MustParseIA("2-0"), want: []beacon.Beacon{b210}},
+		"no beacon": {origin: localIA},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			beacons, err := db.Beacons(ctx, tc.origin)
+			if err != nil {
+				t.Fatalf("Beacons failed: %v", err)
+			}
+			if !beaconsEqual(beacons, tc.want) {
+				t.Errorf("Beacons returned %v, want %v", beacons, tc.want)
+			}
+		})
+	}
+}
+
+func testExpiry(t *testing.T, db beacon.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	// The hop fields of the test beacons are valid for 6 hours.
+	expired := beacon.Beacon{
+		Segment: pathdbtest.NewBeacon(t, time.Now().Add(-7*time.Hour), localIA, 5, core110),
+		InIfID:  1,
+	}
+	in, err := db.Insert(ctx, expired)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if in {
+		t.Error("Insert should return false for expired beacon")
+	}
+	beacons, err := db.Beacons(ctx, 0)
+	if err != nil {
+		t.Fatalf("Beacons failed: %v", err)
+	}
+	if len(beacons) != 0 {
+		t.Errorf("Beacons should not return expired beacons, got %v", beacons)
+	}
+}
+
+// beaconsEqual compares two slices of beacons for equality, ignoring order.
+func beaconsEqual(a, b []beacon.Beacon) bool {
+	f := func(i, j beacon.Beacon) int {
+		if i.InIfID != j.InIfID {
+			return int(i.InIfID) - int(j.InIfID)
+		}
+		return bytes.Compare(i.Segment.FullID(), j.Segment.FullID())
+	}
+
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, f)
+	slices.SortFunc(b, f)
+
+	return slices.EqualFunc(a, b, func(i, j beacon.Beacon) bool {
+		return f(i, j) == 0 && i.Segment.Info.Timestamp.Unix() == j.Segment.Info.Timestamp.Unix()
+	})
+}
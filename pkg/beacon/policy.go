@@ -0,0 +1,144 @@
+package beacon
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/segment/iface"
+)
+
+// Policy selects the beacons that are propagated.
+type Policy interface {
+	// Select returns at most n of the beacons, ordered from best to worst.
+	// All beacons share the same origin.
+	Select(beacons []Beacon, n int) []Beacon
+}
+
+// ShortestPolicy selects the beacons with the fewest AS entries.
+type ShortestPolicy struct{}
+
+// Select implements the Policy interface.
+func (ShortestPolicy) Select(beacons []Beacon, n int) []Beacon {
+	sorted := sortedBy(beacons, func(b Beacon) int { return len(b.Segment.ASEntries) })
+	return sorted[:min(n, len(sorted))]
+}
+
+// DiversityPolicy selects the shortest beacon first, and then repeatedly the
+// beacon that shares the fewest links with the beacons already selected.
+type DiversityPolicy struct{}
+
+// Select implements the Policy interface.
+func (DiversityPolicy) Select(beacons []Beacon, n int) []Beacon {
+	candidates := ShortestPolicy{}.Select(beacons, len(beacons))
+	if len(candidates) <= n {
+		return candidates
+	}
+
+	selected := []Beacon{candidates[0]}
+	candidates = candidates[1:]
+	for len(selected) < n {
+		best, bestDiversity := 0, -1
+		for i, c := range candidates {
+			// The diversity of a candidate is the number of new links it
+			// contributes compared to the most similar selected beacon.
+			diversity := len(c.Segment.ASEntries)
+			for _, s := range selected {
+				diversity = min(diversity, c.Diversity(s))
+			}
+			// Candidates are sorted by length, so ties prefer shorter beacons.
+			if diversity > bestDiversity {
+				best, bestDiversity = i, diversity
+			}
+		}
+		selected = append(selected, candidates[best])
+		candidates = slices.Delete(candidates, best, best+1)
+	}
+	return selected
+}
+
+// LatencyPolicy selects the beacons with the lowest latency according to the
+// static info extension. Beacons with incomplete latency information are
+// ranked after all beacons with complete information.
+type LatencyPolicy struct{}
+
+// Select implements the Policy interface.
+func (LatencyPolicy) Select(beacons []Beacon, n int) []Beacon {
+	latencies := make(map[*seg.PathSegment]time.Duration, len(beacons))
+	for _, b := range beacons {
+		latency, ok := b.Latency()
+		if !ok {
+			latency = math.MaxInt64
+		}
+		latencies[b.Segment] = latency
+	}
+	sorted := sortedBy(beacons, func(b Beacon) time.Duration { return latencies[b.Segment] })
+	return sorted[:min(n, len(sorted))]
+}
+
+// Diversity returns the number of links in this beacon that do not appear in
+// the other beacon. Diversity is asymmetric.
+func (b Beacon) Diversity(other Beacon) int {
+	var diff int
+	for _, entry := range b.Segment.ASEntries {
+		if !slices.ContainsFunc(other.Segment.ASEntries, func(o seg.ASEntry) bool {
+			return link(entry) == link(o)
+		}) {
+			diff++
+		}
+	}
+	return diff
+}
+
+// Latency returns the sum of the latencies announced in the static info
+// extensions of the AS entries. It returns false if an AS entry does not
+// announce the latency of its links.
+func (b Beacon) Latency() (time.Duration, bool) {
+	var total time.Duration
+	entries := b.Segment.ASEntries
+	for i, entry := range entries {
+		static := entry.Extensions.StaticInfo
+		if static == nil {
+			return 0, false
+		}
+		// The latency of the link to the next AS, including the link the
+		// beacon was received on for the last entry.
+		inter, ok := static.Latency.Inter[iface.ID(entry.HopEntry.HopField.ConsEgress)]
+		if !ok {
+			return 0, false
+		}
+		total += inter
+		if i > 0 {
+			total += static.Latency.Intra[iface.ID(entry.HopEntry.HopField.ConsIngress)]
+		}
+	}
+	return total, true
+}
+
+type linkKey struct {
+	ia      addr.IA
+	ingress uint16
+}
+
+func link(entry seg.ASEntry) linkKey {
+	return linkKey{ia: entry.Local, ingress: entry.HopEntry.HopField.ConsIngress}
+}
+
+// sortedBy returns a copy of the beacons sorted by the key. Ties are broken by
+// the ingress interface and the segment ID to keep the selection
+// deterministic.
+func sortedBy[K cmp.Ordered](beacons []Beacon, key func(Beacon) K) []Beacon {
+	sorted := slices.Clone(beacons)
+	slices.SortStableFunc(sorted, func(a, b Beacon) int {
+		return cmp.Or(
+			cmp.Compare(key(a), key(b)),
+			cmp.Compare(a.InIfID, b.InIfID),
+			bytes.Compare(a.Segment.ID(), b.Segment.ID()),
+		)
+	})
+	return sorted
+}
@@ -0,0 +1,127 @@
+package beacon_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/segment/extensions/staticinfo"
+	"github.com/scionproto/scion/pkg/segment/iface"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// hop describes an AS entry of a test beacon.
+type hop struct {
+	ia      string
+	ingress uint16
+	egress  uint16
+	latency time.Duration
+}
+
+func newBeacon(t *testing.T, inIfID uint16, hops ...hop) beacon.Beacon {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := seg.CreateSegment(time.Now(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range hops {
+		entry := seg.ASEntry{
+			Local: addr.MustParseIA(h.ia),
+			Next:  addr.MustParseIA("1-ff00:0:1"),
+			MTU:   1472,
+			HopEntry: seg.HopEntry{
+				HopField: seg.HopField{ExpTime: 63, ConsIngress: h.ingress, ConsEgress: h.egress},
+			},
+		}
+		if i+1 < len(hops) {
+			entry.Next = addr.MustParseIA(hops[i+1].ia)
+		}
+		if h.latency != 0 {
+			entry.Extensions.StaticInfo = &staticinfo.Extension{
+				Latency: staticinfo.LatencyInfo{
+					Inter: map[iface.ID]time.Duration{iface.ID(h.egress): h.latency},
+				},
+			}
+		}
+		signer := trust.Signer{
+			PrivateKey: key,
+			Algorithm:  signed.ECDSAWithSHA256,
+			IA:         entry.Local,
+			Expiration: time.Now().Add(time.Hour),
+		}
+		if err := ps.AddASEntry(context.Background(), entry, signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return beacon.Beacon{Segment: ps, InIfID: inIfID}
+}
+
+func TestPolicies(t *testing.T) {
+	// Three beacons from 1-ff00:0:110. a and b share the link into
+	// 1-ff00:0:111, c takes a disjoint route.
+	a := newBeacon(t, 1,
+		hop{ia: "1-ff00:0:110", egress: 1, latency: 10 * time.Millisecond},
+		hop{ia: "1-ff00:0:111", ingress: 2, egress: 3, latency: 10 * time.Millisecond})
+	b := newBeacon(t, 2,
+		hop{ia: "1-ff00:0:110", egress: 1, latency: 10 * time.Millisecond},
+		hop{ia: "1-ff00:0:111", ingress: 2, egress: 4, latency: 10 * time.Millisecond},
+		hop{ia: "1-ff00:0:112", ingress: 5, egress: 6, latency: time.Millisecond})
+	c := newBeacon(t, 3,
+		hop{ia: "1-ff00:0:110", egress: 7, latency: time.Millisecond},
+		hop{ia: "1-ff00:0:113", ingress: 8, egress: 9, latency: time.Millisecond},
+		hop{ia: "1-ff00:0:114", ingress: 10, egress: 11})
+	beacons := []beacon.Beacon{c, b, a}
+
+	tests := map[string]struct {
+		policy beacon.Policy
+		n      int
+		want   []beacon.Beacon
+	}{
+		"shortest":          {policy: beacon.ShortestPolicy{}, n: 2, want: []beacon.Beacon{a, b}},
+		"shortest all":      {policy: beacon.ShortestPolicy{}, n: 5, want: []beacon.Beacon{a, b, c}},
+		"diversity":         {policy: beacon.DiversityPolicy{}, n: 2, want: []beacon.Beacon{a, c}},
+		"latency":           {policy: beacon.LatencyPolicy{}, n: 2, want: []beacon.Beacon{a, b}},
+		"latency unknown":   {policy: beacon.LatencyPolicy{}, n: 3, want: []beacon.Beacon{a, b, c}},
+		"latency none left": {policy: beacon.LatencyPolicy{}, n: 0, want: []beacon.Beacon{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.policy.Select(beacons, tc.n)
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d beacons, got %d", len(tc.want), len(got))
+			}
+			for i := range got {
+				if got[i].InIfID != tc.want[i].InIfID {
+					t.Errorf("beacon %d: expected %s, got %s", i, tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBeaconLatency(t *testing.T) {
+	b := newBeacon(t, 1,
+		hop{ia: "1-ff00:0:110", egress: 1, latency: 10 * time.Millisecond},
+		hop{ia: "1-ff00:0:111", ingress: 2, egress: 3, latency: 5 * time.Millisecond})
+	if latency, ok := b.Latency(); !ok || latency != 15*time.Millisecond {
+		t.Errorf("expected latency 15ms, got %s (%t)", latency, ok)
+	}
+	b = newBeacon(t, 1,
+		hop{ia: "1-ff00:0:110", egress: 1, latency: 10 * time.Millisecond},
+		hop{ia: "1-ff00:0:111", ingress: 2, egress: 3})
+	if _, ok := b.Latency(); ok {
+		t.Error("latency should be unknown without static info")
+	}
+}
@@ -0,0 +1,173 @@
+package beaconing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/segment/extensions/staticinfo"
+	"github.com/scionproto/scion/pkg/segment/iface"
+	"github.com/scionproto/scion/pkg/slayers/path"
+
+	"github.com/fancl20/cion/pkg/controlplane"
+)
+
+var (
+	// DefaultMaxExpTime is the default relative expiration time of the hop
+	// fields, which corresponds to 6 hours.
+	DefaultMaxExpTime uint8 = 63
+	// DefaultMTU is the default MTU set in the AS entries.
+	DefaultMTU = 1472
+)
+
+// Signer signs the AS entries. It is usually a trust.Signer.
+type Signer interface {
+	Sign(ctx context.Context, msg []byte, associatedData ...[]byte) (*cryptopb.SignedMessage, error)
+	Validity() cppki.Validity
+}
+
+// Extender extends path segments with entries for the local AS.
+type Extender struct {
+	// IA is the local ISD-AS.
+	IA addr.IA
+	// Interfaces are the inter-AS interfaces of the local AS, keyed by their ID.
+	Interfaces map[uint16]controlplane.Interface
+	// Key is the forwarding key of the router, used to compute the hop field
+	// MACs.
+	Key []byte
+	// Signer signs the AS entries.
+	Signer Signer
+	// MTU is the AS internal MTU. Zero means DefaultMTU.
+	MTU int
+	// MaxExpTime is the maximum relative expiration time of the hop fields.
+	// Zero means DefaultMaxExpTime.
+	MaxExpTime uint8
+}
+
+// Extend extends the segment with an AS entry for the local AS. The zero value
+// for ingress indicates that the entry is the first entry of the segment. The
+// zero value for egress indicates that the entry is the last entry of the
+// segment, and the beacon is terminated. Peers are the peering interfaces added
+// as peer entries.
+func (e *Extender) Extend(ctx context.Context, ps *seg.PathSegment,
+	ingress, egress uint16, peers []uint16) error {
+
+	firstHop := ps.MaxIdx() < 0
+	switch {
+	case ingress == 0 && egress == 0:
+		return fmt.Errorf("ingress and egress must not be both 0")
+	case ingress == 0 && !firstHop:
+		return fmt.Errorf("ingress must only be zero in first hop")
+	case ingress != 0 && firstHop:
+		return fmt.Errorf("ingress must be zero in first hop, got %d", ingress)
+	}
+	var next addr.IA
+	if egress != 0 {
+		intf, ok := e.Interfaces[egress]
+		if !ok {
+			return fmt.Errorf("egress interface %d not found", egress)
+		}
+		next = intf.IA
+	}
+	expTime, err := e.expTime(ps)
+	if err != nil {
+		return err
+	}
+
+	ts := uint32(ps.Info.Timestamp.Unix())
+	beta := extractBeta(ps)
+	hop := e.hopField(ingress, egress, expTime, ts, beta)
+	entry := seg.ASEntry{
+		Local: e.IA,
+		Next:  next,
+		MTU:   e.MTU,
+		HopEntry: seg.HopEntry{
+			IngressMTU: e.Interfaces[ingress].MTU,
+			HopField:   hop,
+		},
+	}
+	if entry.MTU == 0 {
+		entry.MTU = DefaultMTU
+	}
+	if latency := e.Interfaces[egress].Latency; egress != 0 && latency != 0 {
+		entry.Extensions.StaticInfo = &staticinfo.Extension{
+			Latency: staticinfo.LatencyInfo{
+				Inter: map[iface.ID]time.Duration{iface.ID(egress): latency},
+			},
+		}
+	}
+	// Peer hop fields chain to the hop field of the entry, so that they are
+	// verified with the same SegID accumulator as the following hop field.
+	peerBeta := beta ^ binary.BigEndian.Uint16(hop.MAC[:2])
+	for _, peer := range peers {
+		intf, ok := e.Interfaces[peer]
+		if !ok || intf.RemoteID == 0 || intf.IA.IsWildcard() {
+			continue
+		}
+		entry.PeerEntries = append(entry.PeerEntries, seg.PeerEntry{
+			Peer:          intf.IA,
+			PeerInterface: intf.RemoteID,
+			PeerMTU:       intf.MTU,
+			HopField:      e.hopField(peer, egress, expTime, ts, peerBeta),
+		})
+	}
+
+	if err := ps.AddASEntry(ctx, entry, e.Signer); err != nil {
+		return fmt.Errorf("adding AS entry: %w", err)
+	}
+	if egress == 0 {
+		return ps.Validate(seg.ValidateSegment)
+	}
+	return ps.Validate(seg.ValidateBeacon)
+}
+
+// expTime returns the relative expiration time of the hop fields. It is capped
+// so that the hop fields do not outlive the signer.
+func (e *Extender) expTime(ps *seg.PathSegment) (uint8, error) {
+	expTime := e.MaxExpTime
+	if expTime == 0 {
+		expTime = DefaultMaxExpTime
+	}
+	signerExp := e.Signer.Validity().NotAfter
+	if ps.Info.Timestamp.Add(path.ExpTimeToDuration(expTime)).After(signerExp) {
+		var err error
+		expTime, err = path.ExpTimeFromDuration(signerExp.Sub(ps.Info.Timestamp))
+		if err != nil {
+			return 0, fmt.Errorf("calculating expiration time from signer expiration %s: %w",
+				signerExp, err)
+		}
+	}
+	return expTime, nil
+}
+
+func (e *Extender) hopField(ingress, egress uint16, expTime uint8, ts uint32,
+	beta uint16) seg.HopField {
+
+	mac := path.MAC(hmac.New(sha256.New, e.Key),
+		path.InfoField{SegID: beta, Timestamp: ts},
+		path.HopField{ExpTime: expTime, ConsIngress: ingress, ConsEgress: egress},
+		nil)
+	return seg.HopField{
+		ExpTime:     expTime,
+		ConsIngress: ingress,
+		ConsEgress:  egress,
+		MAC:         mac,
+	}
+}
+
+// extractBeta computes the SegID accumulator for the next hop field added to
+// the segment.
+func extractBeta(ps *seg.PathSegment) uint16 {
+	beta := ps.Info.SegmentID
+	for _, entry := range ps.ASEntries {
+		beta ^= binary.BigEndian.Uint16(entry.HopEntry.HopField.MAC[:2])
+	}
+	return beta
+}
@@ -0,0 +1,115 @@
+package beaconing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/log"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// DefaultOriginationInterval is the default interval between two rounds of
+// beacon origination.
+var DefaultOriginationInterval = 5 * time.Second
+
+// Originator periodically originates beacons on the core and child interfaces
+// of a core AS.
+type Originator struct {
+	// Extender creates the AS entries of the beacons.
+	Extender *Extender
+	// Type is the type of the local AS. Only core and authoritative ASes
+	// originate beacons.
+	Type trust.ASType
+	// Clients reach the control service of the neighbours, keyed by the local
+	// interface ID.
+	Clients map[uint16]control_planeconnect.SegmentCreationServiceClient
+	// Interval is the interval between two rounds of origination. Zero means
+	// DefaultOriginationInterval.
+	Interval time.Duration
+}
+
+// Run originates beacons until the context is cancelled.
+func (o *Originator) Run(ctx context.Context) error {
+	if !o.Type.IsCore() {
+		return fmt.Errorf("beacons can only be originated by core ASes, got %s AS", o.Type)
+	}
+	interval := o.Interval
+	if interval == 0 {
+		interval = DefaultOriginationInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := o.Originate(ctx); err != nil {
+			log.FromCtx(ctx).Error("Originating beacons", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Originate originates one beacon on each core and child interface. Errors on
+// individual interfaces do not prevent origination on the others.
+func (o *Originator) Originate(ctx context.Context) error {
+	var egress, peers []uint16
+	for id, intf := range o.Extender.Interfaces {
+		switch intf.LinkType {
+		case dataplane.LinkCore, dataplane.LinkChild:
+			egress = append(egress, id)
+		case dataplane.LinkPeer:
+			peers = append(peers, id)
+		}
+	}
+	slices.Sort(egress)
+	slices.Sort(peers)
+
+	now := time.Now()
+	var errs []error
+	for _, id := range egress {
+		if err := o.originate(ctx, id, peers, now); err != nil {
+			errs = append(errs, fmt.Errorf("interface %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (o *Originator) originate(ctx context.Context, egress uint16, peers []uint16,
+	now time.Time) error {
+
+	clt, ok := o.Clients[egress]
+	if !ok {
+		return fmt.Errorf("no client for interface")
+	}
+	ps, err := seg.CreateSegment(now, uint16(rand.UintN(1<<16)))
+	if err != nil {
+		return fmt.Errorf("creating segment: %w", err)
+	}
+	// Peer entries are only useful towards children, core segments cannot
+	// use peering links.
+	if o.Extender.Interfaces[egress].LinkType != dataplane.LinkChild {
+		peers = nil
+	}
+	if err := o.Extender.Extend(ctx, ps, 0, egress, peers); err != nil {
+		return fmt.Errorf("extending beacon: %w", err)
+	}
+	if _, err := clt.Beacon(ctx, connect.NewRequest(&cppb.BeaconRequest{
+		Segment: seg.PathSegmentToPB(ps),
+	})); err != nil {
+		return fmt.Errorf("sending beacon: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package beaconing_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/slayers/path"
+
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	testKey = []byte("test_key_1234567")
+	localIA = addr.MustParseIA("1-ff00:0:110")
+)
+
+// beaconClient records the beacons sent to a neighbour.
+type beaconClient struct {
+	mu      sync.Mutex
+	beacons []*seg.PathSegment
+}
+
+func (c *beaconClient) Beacon(_ context.Context,
+	req *connect.Request[cppb.BeaconRequest]) (*connect.Response[cppb.BeaconResponse], error) {
+
+	ps, err := seg.BeaconFromPB(req.Msg.Segment)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.beacons = append(c.beacons, ps)
+	return connect.NewResponse(&cppb.BeaconResponse{}), nil
+}
+
+type keyVerifier struct {
+	key crypto.PublicKey
+}
+
+func (v keyVerifier) Verify(_ context.Context, msg *cryptopb.SignedMessage,
+	associatedData ...[]byte) (*signed.Message, error) {
+
+	return signed.Verify(msg, v.key, associatedData...)
+}
+
+func newExtender(t *testing.T, ia addr.IA,
+	intfs map[uint16]controlplane.Interface) (*beaconing.Extender, keyVerifier) {
+
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &beaconing.Extender{
+		IA:         ia,
+		Interfaces: intfs,
+		Key:        testKey,
+		Signer: trust.Signer{
+			PrivateKey: key,
+			Algorithm:  signed.ECDSAWithSHA256,
+			IA:         ia,
+			Expiration: time.Now().Add(24 * time.Hour),
+		},
+	}, keyVerifier{key: key.Public()}
+}
+
+// checkHopMAC verifies the MAC of the hop field of the AS entry at idx.
+func checkHopMAC(t *testing.T, ps *seg.PathSegment, idx int) {
+	t.Helper()
+	beta := ps.Info.SegmentID
+	for _, entry := range ps.ASEntries[:idx] {
+		beta ^= uint16(entry.HopEntry.HopField.MAC[0])<<8 | uint16(entry.HopEntry.HopField.MAC[1])
+	}
+	hop := ps.ASEntries[idx].HopEntry.HopField
+	want := path.MAC(hmac.New(sha256.New, testKey),
+		path.InfoField{SegID: beta, Timestamp: uint32(ps.Info.Timestamp.Unix())},
+		path.HopField{ExpTime: hop.ExpTime, ConsIngress: hop.ConsIngress, ConsEgress: hop.ConsEgress},
+		nil)
+	if hop.MAC != want {
+		t.Errorf("hop field %d has invalid MAC", idx)
+	}
+}
+
+func TestOriginator(t *testing.T) {
+	ctx := context.Background()
+	intfs := map[uint16]controlplane.Interface{
+		1: {IA: addr.MustParseIA("1-ff00:0:111"), RemoteID: 11, LinkType: dataplane.LinkCore},
+		2: {IA: addr.MustParseIA("1-ff00:0:1"), RemoteID: 12, LinkType: dataplane.LinkChild},
+		3: {IA: addr.MustParseIA("1-ff00:0:2"), RemoteID: 13, LinkType: dataplane.LinkParent},
+		4: {IA: addr.MustParseIA("1-ff00:0:3"), RemoteID: 14, LinkType: dataplane.LinkPeer},
+	}
+	clients := map[uint16]*beaconClient{1: {}, 2: {}, 3: {}, 4: {}}
+	ext, verifier := newExtender(t, localIA, intfs)
+	o := &beaconing.Originator{
+		Extender: ext,
+		Type:     trust.ASTypeAuthoritative,
+		Clients:  map[uint16]control_planeconnect.SegmentCreationServiceClient{},
+	}
+	for id, c := range clients {
+		o.Clients[id] = c
+	}
+
+	if err := o.Originate(ctx); err != nil {
+		t.Fatalf("Originate failed: %v", err)
+	}
+	for id, c := range clients {
+		wantBeacons := 0
+		if lt := intfs[id].LinkType; lt == dataplane.LinkCore || lt == dataplane.LinkChild {
+			wantBeacons = 1
+		}
+		if len(c.beacons) != wantBeacons {
+			t.Fatalf("interface %d: expected %d beacons, got %d", id, wantBeacons, len(c.beacons))
+		}
+		if wantBeacons == 0 {
+			continue
+		}
+
+		ps := c.beacons[0]
+		entry := ps.ASEntries[0]
+		if !entry.Local.Equal(localIA) || !entry.Next.Equal(intfs[id].IA) {
+			t.Errorf("interface %d: unexpected AS entry %s -> %s", id, entry.Local, entry.Next)
+		}
+		if hop := entry.HopEntry.HopField; hop.ConsIngress != 0 || hop.ConsEgress != id {
+			t.Errorf("interface %d: unexpected hop field %d -> %d", id, hop.ConsIngress, hop.ConsEgress)
+		}
+		checkHopMAC(t, ps, 0)
+		if err := ps.VerifyASEntry(ctx, verifier, 0); err != nil {
+			t.Errorf("interface %d: invalid signature: %v", id, err)
+		}
+		wantPeers := 0
+		if intfs[id].LinkType == dataplane.LinkChild {
+			wantPeers = 1
+		}
+		if len(entry.PeerEntries) != wantPeers {
+			t.Errorf("interface %d: expected %d peer entries, got %d",
+				id, wantPeers, len(entry.PeerEntries))
+		}
+	}
+
+	normal := &beaconing.Originator{Extender: ext, Type: trust.ASTypeNormal}
+	if err := normal.Run(ctx); err == nil {
+		t.Error("non-core AS should not originate beacons")
+	}
+}
+
+func TestExtenderExpTime(t *testing.T) {
+	ext, _ := newExtender(t, localIA, map[uint16]controlplane.Interface{
+		1: {IA: addr.MustParseIA("1-ff00:0:111"), RemoteID: 11, LinkType: dataplane.LinkCore},
+	})
+	signer := ext.Signer.(trust.Signer)
+	signer.Expiration = time.Now().Add(time.Hour)
+	ext.Signer = signer
+
+	ps, err := seg.CreateSegment(time.Now(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ext.Extend(context.Background(), ps, 0, 1, nil); err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if exp := ps.MaxExpiry(); exp.After(signer.Expiration) {
+		t.Errorf("hop fields expire at %s, after the signer at %s", exp, signer.Expiration)
+	}
+}
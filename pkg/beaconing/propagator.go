@@ -0,0 +1,166 @@
+package beaconing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/log"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	// DefaultPropagationInterval is the default interval between two rounds of
+	// beacon propagation.
+	DefaultPropagationInterval = 5 * time.Second
+	// DefaultBestN is the default number of beacons per origin propagated on
+	// each interface.
+	DefaultBestN = 5
+)
+
+// Propagator periodically propagates the best received beacons. Core ASes
+// propagate beacons received from core neighbours to their other core
+// neighbours, non-core ASes propagate beacons received from parents to their
+// children.
+type Propagator struct {
+	// Extender extends the beacons with the entry of the local AS.
+	Extender *Extender
+	// Type is the type of the local AS.
+	Type trust.ASType
+	// Beacons stores the received beacons.
+	Beacons beacon.DB
+	// Policy selects the beacons to propagate. Nil means
+	// beacon.ShortestPolicy.
+	Policy beacon.Policy
+	// BestN is the number of beacons per origin propagated on each interface.
+	// Zero means DefaultBestN.
+	BestN int
+	// Clients reach the control service of the neighbours, keyed by the local
+	// interface ID.
+	Clients map[uint16]control_planeconnect.SegmentCreationServiceClient
+	// Interval is the interval between two rounds of propagation. Zero means
+	// DefaultPropagationInterval.
+	Interval time.Duration
+}
+
+// Run propagates beacons until the context is cancelled.
+func (p *Propagator) Run(ctx context.Context) error {
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultPropagationInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := p.Propagate(ctx); err != nil {
+			log.FromCtx(ctx).Error("Propagating beacons", "err", err)
+		}
+	}
+}
+
+// Propagate propagates the best beacons of every origin on each egress
+// interface. Errors on individual beacons do not prevent the propagation of
+// the others.
+func (p *Propagator) Propagate(ctx context.Context) error {
+	ingressType, egressType := dataplane.LinkParent, dataplane.LinkChild
+	if p.Type.IsCore() {
+		ingressType, egressType = dataplane.LinkCore, dataplane.LinkCore
+	}
+	var egress, peers []uint16
+	for id, intf := range p.Extender.Interfaces {
+		switch intf.LinkType {
+		case egressType:
+			egress = append(egress, id)
+		case dataplane.LinkPeer:
+			peers = append(peers, id)
+		}
+	}
+	slices.Sort(egress)
+	slices.Sort(peers)
+	// Peering links can only be used by non-core segments.
+	if p.Type.IsCore() {
+		peers = nil
+	}
+
+	beacons, err := p.Beacons.Beacons(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("looking up beacons: %w", err)
+	}
+	now := time.Now()
+	origins := make(map[addr.IA][]beacon.Beacon)
+	for _, b := range beacons {
+		if p.Extender.Interfaces[b.InIfID].LinkType != ingressType || b.Segment.MinExpiry().Before(now) {
+			continue
+		}
+		origin := b.Segment.FirstIA()
+		origins[origin] = append(origins[origin], b)
+	}
+
+	var errs []error
+	for _, id := range egress {
+		next := p.Extender.Interfaces[id].IA
+		for _, candidates := range origins {
+			// Never send a beacon back to an AS it already traversed.
+			candidates = slices.DeleteFunc(slices.Clone(candidates), func(b beacon.Beacon) bool {
+				return slices.ContainsFunc(b.Segment.ASEntries, func(e seg.ASEntry) bool {
+					return e.Local.Equal(next)
+				})
+			})
+			for _, b := range p.policy().Select(candidates, p.bestN()) {
+				if err := p.propagate(ctx, b, id, peers); err != nil {
+					errs = append(errs, fmt.Errorf("interface %d: %w", id, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Propagator) propagate(ctx context.Context, b beacon.Beacon, egress uint16,
+	peers []uint16) error {
+
+	clt, ok := p.Clients[egress]
+	if !ok {
+		return fmt.Errorf("no client for interface")
+	}
+	ps := b.Segment.ShallowCopy()
+	if err := p.Extender.Extend(ctx, ps, b.InIfID, egress, peers); err != nil {
+		return fmt.Errorf("extending beacon: %w", err)
+	}
+	if _, err := clt.Beacon(ctx, connect.NewRequest(&cppb.BeaconRequest{
+		Segment: seg.PathSegmentToPB(ps),
+	})); err != nil {
+		return fmt.Errorf("sending beacon: %w", err)
+	}
+	return nil
+}
+
+func (p *Propagator) policy() beacon.Policy {
+	if p.Policy == nil {
+		return beacon.ShortestPolicy{}
+	}
+	return p.Policy
+}
+
+func (p *Propagator) bestN() int {
+	if p.BestN == 0 {
+		return DefaultBestN
+	}
+	return p.BestN
+}
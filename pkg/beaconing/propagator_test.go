@@ -0,0 +1,129 @@
+package beaconing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+type memBeaconDB struct {
+	beacons []beacon.Beacon
+}
+
+func (db *memBeaconDB) Beacons(_ context.Context, origin addr.IA) ([]beacon.Beacon, error) {
+	return db.beacons, nil
+}
+
+func (db *memBeaconDB) Insert(_ context.Context, b beacon.Beacon) (bool, error) {
+	db.beacons = append(db.beacons, b)
+	return true, nil
+}
+
+func (db *memBeaconDB) Close() error { return nil }
+
+// originate creates a beacon originated by origin on interface egress.
+func originate(t *testing.T, origin addr.IA, egress uint16, next addr.IA) *seg.PathSegment {
+	t.Helper()
+	ext, _ := newExtender(t, origin, map[uint16]controlplane.Interface{
+		egress: {IA: next, LinkType: dataplane.LinkCore},
+	})
+	ps, err := seg.CreateSegment(time.Now(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ext.Extend(context.Background(), ps, 0, egress, nil); err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func TestPropagator(t *testing.T) {
+	ctx := context.Background()
+	originIA := addr.MustParseIA("1-ff00:0:111")
+	tests := map[string]struct {
+		asType trust.ASType
+		intfs  map[uint16]controlplane.Interface
+		// want is the number of beacons expected on each interface.
+		want map[uint16]int
+	}{
+		"core": {
+			asType: trust.ASTypeCore,
+			intfs: map[uint16]controlplane.Interface{
+				1: {IA: originIA, RemoteID: 11, LinkType: dataplane.LinkCore},
+				2: {IA: addr.MustParseIA("1-ff00:0:112"), RemoteID: 12, LinkType: dataplane.LinkCore},
+				3: {IA: addr.MustParseIA("1-ff00:0:1"), RemoteID: 13, LinkType: dataplane.LinkChild},
+			},
+			want: map[uint16]int{1: 0, 2: 1, 3: 0},
+		},
+		"non-core": {
+			asType: trust.ASTypeNormal,
+			intfs: map[uint16]controlplane.Interface{
+				1: {IA: originIA, RemoteID: 11, LinkType: dataplane.LinkParent},
+				2: {IA: addr.MustParseIA("1-ff00:0:1"), RemoteID: 12, LinkType: dataplane.LinkChild},
+				3: {IA: addr.MustParseIA("1-ff00:0:2"), RemoteID: 13, LinkType: dataplane.LinkPeer},
+			},
+			want: map[uint16]int{1: 0, 2: 1, 3: 0},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ext, verifier := newExtender(t, localIA, tc.intfs)
+			db := &memBeaconDB{}
+			for range 2 {
+				db.Insert(ctx, beacon.Beacon{Segment: originate(t, originIA, 11, localIA), InIfID: 1})
+			}
+			clients := map[uint16]*beaconClient{1: {}, 2: {}, 3: {}}
+			p := &beaconing.Propagator{
+				Extender: ext,
+				Type:     tc.asType,
+				Beacons:  db,
+				BestN:    1,
+				Clients:  map[uint16]control_planeconnect.SegmentCreationServiceClient{},
+			}
+			for id, c := range clients {
+				p.Clients[id] = c
+			}
+
+			if err := p.Propagate(ctx); err != nil {
+				t.Fatalf("Propagate failed: %v", err)
+			}
+			for id, c := range clients {
+				if len(c.beacons) != tc.want[id] {
+					t.Fatalf("interface %d: expected %d beacons, got %d", id, tc.want[id], len(c.beacons))
+				}
+				for _, ps := range c.beacons {
+					if len(ps.ASEntries) != 2 {
+						t.Fatalf("interface %d: expected 2 AS entries, got %d", id, len(ps.ASEntries))
+					}
+					entry := ps.ASEntries[1]
+					if hop := entry.HopEntry.HopField; hop.ConsIngress != 1 || hop.ConsEgress != id {
+						t.Errorf("interface %d: unexpected hop field %d -> %d",
+							id, hop.ConsIngress, hop.ConsEgress)
+					}
+					checkHopMAC(t, ps, 1)
+					if err := ps.VerifyASEntry(ctx, verifier, 1); err != nil {
+						t.Errorf("interface %d: invalid signature: %v", id, err)
+					}
+					wantPeers := 0
+					if !tc.asType.IsCore() {
+						wantPeers = 1
+					}
+					if len(entry.PeerEntries) != wantPeers {
+						t.Errorf("interface %d: expected %d peer entries, got %d",
+							id, wantPeers, len(entry.PeerEntries))
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package beaconing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/log"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	// DefaultRegistrationInterval is the default interval between two rounds
+	// of segment registration.
+	DefaultRegistrationInterval = 5 * time.Second
+	// DefaultRefreshWindow is the default time before the expiration of a
+	// registered segment at which it is registered again.
+	DefaultRefreshWindow = time.Hour
+)
+
+// Registrar periodically terminates the best received beacons and registers
+// them as path segments. Non-core ASes keep the segments as up segments and
+// register them as down segments at the originating core AS. Core ASes keep
+// the segments as core segments.
+type Registrar struct {
+	// Extender terminates the beacons with the entry of the local AS.
+	Extender *Extender
+	// Type is the type of the local AS.
+	Type trust.ASType
+	// Beacons stores the received beacons.
+	Beacons beacon.DB
+	// PathDB stores the segments of the local AS.
+	PathDB pathdb.DB
+	// Policy selects the beacons to register. Nil means beacon.ShortestPolicy.
+	Policy beacon.Policy
+	// BestN is the number of segments per origin registered. Zero means
+	// DefaultBestN.
+	BestN int
+	// Clients returns a client to the control service of the given core AS.
+	// It is only used by non-core ASes.
+	Clients func(addr.IA) (control_planeconnect.SegmentRegistrationServiceClient, error)
+	// Interval is the interval between two rounds of registration. Zero means
+	// DefaultRegistrationInterval.
+	Interval time.Duration
+	// RefreshWindow is the time before the expiration of a registered segment
+	// at which it is registered again. Zero means DefaultRefreshWindow.
+	RefreshWindow time.Duration
+
+	mu sync.Mutex
+	// registered maps the IDs of the registered beacons to the expiration
+	// time of the registered segments.
+	registered map[string]time.Time
+}
+
+// Run registers segments until the context is cancelled.
+func (r *Registrar) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultRegistrationInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := r.Register(ctx); err != nil {
+			log.FromCtx(ctx).Error("Registering segments", "err", err)
+		}
+	}
+}
+
+// Register registers the best segments of every origin. Segments that are
+// already registered are only registered again once they are close to
+// expiry. Failed registrations are retried in the next round.
+func (r *Registrar) Register(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ingressType := dataplane.LinkParent
+	if r.Type.IsCore() {
+		ingressType = dataplane.LinkCore
+	}
+	var peers []uint16
+	if !r.Type.IsCore() {
+		for id, intf := range r.Extender.Interfaces {
+			if intf.LinkType == dataplane.LinkPeer {
+				peers = append(peers, id)
+			}
+		}
+		slices.Sort(peers)
+	}
+
+	beacons, err := r.Beacons.Beacons(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("looking up beacons: %w", err)
+	}
+	now := time.Now()
+	origins := make(map[addr.IA][]beacon.Beacon)
+	for _, b := range beacons {
+		if r.Extender.Interfaces[b.InIfID].LinkType != ingressType || b.Segment.MinExpiry().Before(now) {
+			continue
+		}
+		origin := b.Segment.FirstIA()
+		origins[origin] = append(origins[origin], b)
+	}
+
+	if r.registered == nil {
+		r.registered = make(map[string]time.Time)
+	}
+	maps.DeleteFunc(r.registered, func(_ string, exp time.Time) bool { return exp.Before(now) })
+	refresh := r.RefreshWindow
+	if refresh == 0 {
+		refresh = DefaultRefreshWindow
+	}
+
+	var errs []error
+	for origin, candidates := range origins {
+		for _, b := range r.policy().Select(candidates, r.bestN()) {
+			id := string(b.Segment.ID())
+			if exp, ok := r.registered[id]; ok && exp.After(now.Add(refresh)) {
+				continue
+			}
+			exp, err := r.register(ctx, b, peers)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("origin %s: %w", origin, err))
+				continue
+			}
+			r.registered[id] = exp
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// register terminates the beacon and registers the segment. It returns the
+// expiration time of the segment.
+func (r *Registrar) register(ctx context.Context, b beacon.Beacon,
+	peers []uint16) (time.Time, error) {
+
+	ps := b.Segment.ShallowCopy()
+	if err := r.Extender.Extend(ctx, ps, b.InIfID, 0, peers); err != nil {
+		return time.Time{}, fmt.Errorf("terminating beacon: %w", err)
+	}
+
+	localType := seg.TypeUp
+	if r.Type.IsCore() {
+		localType = seg.TypeCore
+	}
+	if _, err := r.PathDB.Insert(ctx, &seg.Meta{Type: localType, Segment: ps}); err != nil {
+		return time.Time{}, fmt.Errorf("inserting segment: %w", err)
+	}
+	if r.Type.IsCore() {
+		return ps.MinExpiry(), nil
+	}
+
+	clt, err := r.Clients(ps.FirstIA())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creating client: %w", err)
+	}
+	if _, err := clt.SegmentsRegistration(ctx, connect.NewRequest(&cppb.SegmentsRegistrationRequest{
+		Segments: map[int32]*cppb.SegmentsRegistrationRequest_Segments{
+			int32(seg.TypeDown): {Segments: []*cppb.PathSegment{seg.PathSegmentToPB(ps)}},
+		},
+	})); err != nil {
+		return time.Time{}, fmt.Errorf("registering down segment: %w", err)
+	}
+	return ps.MinExpiry(), nil
+}
+
+func (r *Registrar) policy() beacon.Policy {
+	if r.Policy == nil {
+		return beacon.ShortestPolicy{}
+	}
+	return r.Policy
+}
+
+func (r *Registrar) bestN() int {
+	if r.BestN == 0 {
+		return DefaultBestN
+	}
+	return r.BestN
+}
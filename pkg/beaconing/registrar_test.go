@@ -0,0 +1,132 @@
+package beaconing_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/pathdb/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// registrationClient records the segments registered at a core AS.
+type registrationClient struct {
+	err      error
+	segments []*seg.PathSegment
+}
+
+func (c *registrationClient) SegmentsRegistration(_ context.Context,
+	req *connect.Request[cppb.SegmentsRegistrationRequest],
+) (*connect.Response[cppb.SegmentsRegistrationResponse], error) {
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	for _, pb := range req.Msg.Segments[int32(seg.TypeDown)].GetSegments() {
+		ps, err := seg.SegmentFromPB(pb)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		c.segments = append(c.segments, ps)
+	}
+	return connect.NewResponse(&cppb.SegmentsRegistrationResponse{}), nil
+}
+
+func TestRegistrar(t *testing.T) {
+	ctx := context.Background()
+	coreIA := addr.MustParseIA("1-ff00:0:111")
+	leafIA := addr.MustParseIA("1-ff00:0:1")
+
+	newRegistrar := func(t *testing.T, ia addr.IA, asType trust.ASType,
+		lt dataplane.LinkType) (*beaconing.Registrar, *registrationClient) {
+
+		ext, _ := newExtender(t, ia, map[uint16]controlplane.Interface{
+			1: {IA: coreIA, RemoteID: 11, LinkType: lt},
+		})
+		db, err := bbolt.New(filepath.Join(t.TempDir(), "path.db"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		beacons := &memBeaconDB{}
+		beacons.Insert(ctx, beacon.Beacon{Segment: originate(t, coreIA, 11, ia), InIfID: 1})
+		clt := &registrationClient{}
+		return &beaconing.Registrar{
+			Extender: ext,
+			Type:     asType,
+			Beacons:  beacons,
+			PathDB:   db,
+			Clients: func(ia addr.IA) (control_planeconnect.SegmentRegistrationServiceClient, error) {
+				if !ia.Equal(coreIA) {
+					t.Errorf("unexpected registration at %s", ia)
+				}
+				return clt, nil
+			},
+		}, clt
+	}
+
+	t.Run("non-core", func(t *testing.T) {
+		r, clt := newRegistrar(t, leafIA, trust.ASTypeNormal, dataplane.LinkParent)
+		clt.err = errors.New("unavailable")
+		if err := r.Register(ctx); err == nil {
+			t.Fatal("Register should fail if the core is unavailable")
+		}
+		clt.err = nil
+		if err := r.Register(ctx); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if len(clt.segments) != 1 {
+			t.Fatalf("expected 1 registered down segment, got %d", len(clt.segments))
+		}
+		if ps := clt.segments[0]; !ps.FirstIA().Equal(coreIA) || !ps.LastIA().Equal(leafIA) {
+			t.Errorf("unexpected down segment %s", ps)
+		}
+		ups, err := r.PathDB.Get(ctx, pathdb.Query{SegTypes: []seg.Type{seg.TypeUp}})
+		if err != nil || len(ups) != 1 {
+			t.Fatalf("expected 1 up segment, got %d (%v)", len(ups), err)
+		}
+
+		// Registered segments are only registered again close to expiry.
+		if err := r.Register(ctx); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if len(clt.segments) != 1 {
+			t.Errorf("segment should not be registered again, got %d registrations", len(clt.segments))
+		}
+		r.RefreshWindow = 24 * time.Hour
+		if err := r.Register(ctx); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if len(clt.segments) != 2 {
+			t.Errorf("segment close to expiry should be registered again, got %d registrations",
+				len(clt.segments))
+		}
+	})
+
+	t.Run("core", func(t *testing.T) {
+		r, clt := newRegistrar(t, addr.MustParseIA("1-ff00:0:112"), trust.ASTypeCore, dataplane.LinkCore)
+		if err := r.Register(ctx); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if len(clt.segments) != 0 {
+			t.Errorf("core segments should not be registered remotely, got %d", len(clt.segments))
+		}
+		cores, err := r.PathDB.Get(ctx, pathdb.Query{SegTypes: []seg.Type{seg.TypeCore}})
+		if err != nil || len(cores) != 1 {
+			t.Fatalf("expected 1 core segment, got %d (%v)", len(cores), err)
+		}
+	})
+}
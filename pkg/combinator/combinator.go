@@ -0,0 +1,56 @@
+// Package combinator combines up, core and down segments into end-to-end
+// forwarding paths.
+//
+// The paths are constructed by the combinator of the SCION reference
+// implementation. This package only converts them to the raw forwarding paths
+// used by the CION data plane.
+package combinator
+
+import (
+	"github.com/scionproto/scion/pkg/addr"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/private/path/combinator"
+)
+
+// Path is a forwarding path between two ASes.
+type Path struct {
+	// Raw is the encoded forwarding path.
+	Raw *scion.Raw
+	// Metadata describes the path. It contains the interface sequence, the
+	// expiration time, the MTU and the static info announced by the ASes.
+	Metadata snet.PathMetadata
+	// Fingerprint identifies the sequence of interfaces of the path.
+	Fingerprint snet.PathFingerprint
+	// Weight is the number of inter-AS links traversed by the path.
+	Weight int
+}
+
+// Combine constructs all paths from src to dst using the segments. Ups are
+// the up segments of src, downs the down segments of dst and cores the core
+// segments connecting them.
+//
+// Paths that traverse an AS more than once are dropped. If the same sequence
+// of interfaces can be constructed from different segments, only the path
+// that expires last is returned. The paths are ordered by weight, ties are
+// broken by the segments they are constructed from.
+func Combine(src, dst addr.IA, ups, cores, downs []*seg.PathSegment) []Path {
+	combined := combinator.Combine(src, dst, ups, cores, downs, false)
+	paths := make([]Path, len(combined))
+	for i, p := range combined {
+		raw := &scion.Raw{}
+		if err := raw.DecodeFromBytes(p.SCIONPath.Raw); err != nil {
+			// The path is encoded by the combinator from at most three valid
+			// segments, so decoding cannot fail.
+			panic(err)
+		}
+		paths[i] = Path{
+			Raw:         raw,
+			Metadata:    p.Metadata,
+			Fingerprint: p.Fingerprint,
+			Weight:      p.Weight,
+		}
+	}
+	return paths
+}
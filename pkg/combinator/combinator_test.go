@@ -0,0 +1,667 @@
+package combinator_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/segment/extensions/staticinfo"
+	"github.com/scionproto/scion/pkg/segment/iface"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/combinator"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var testKey = []byte("test_key_1234567")
+
+// The test topology consists of the core ASes A and B. X is a child of A with
+// the children S and T, Y is a child of B with the child D. X and Y, as well as
+// S and D, are connected by peering links.
+//
+//	A ------- B
+//	|         |
+//	X ~~~~~~~ Y
+//	| \       |
+//	S  T      D
+//	 ~~~~~~~~~
+var (
+	iaA = addr.MustParseIA("1-ff00:0:110")
+	iaB = addr.MustParseIA("1-ff00:0:120")
+	iaX = addr.MustParseIA("1-ff00:0:111")
+	iaS = addr.MustParseIA("1-ff00:0:112")
+	iaT = addr.MustParseIA("1-ff00:0:113")
+	iaY = addr.MustParseIA("1-ff00:0:121")
+	iaD = addr.MustParseIA("1-ff00:0:122")
+
+	topology = map[addr.IA]map[uint16]controlplane.Interface{
+		iaA: {
+			1: {IA: iaB, RemoteID: 1, LinkType: dataplane.LinkCore, MTU: 1400},
+			2: {IA: iaX, RemoteID: 1, LinkType: dataplane.LinkChild, MTU: 1280,
+				Latency: 10 * time.Millisecond},
+		},
+		iaB: {
+			1: {IA: iaA, RemoteID: 1, LinkType: dataplane.LinkCore, MTU: 1400},
+			2: {IA: iaY, RemoteID: 1, LinkType: dataplane.LinkChild, MTU: 1400},
+		},
+		iaX: {
+			1: {IA: iaA, RemoteID: 2, LinkType: dataplane.LinkParent, MTU: 1280},
+			2: {IA: iaS, RemoteID: 1, LinkType: dataplane.LinkChild, MTU: 1400,
+				Latency: 5 * time.Millisecond},
+			3: {IA: iaT, RemoteID: 1, LinkType: dataplane.LinkChild, MTU: 1400},
+			4: {IA: iaY, RemoteID: 4, LinkType: dataplane.LinkPeer, MTU: 1350},
+		},
+		iaS: {
+			1: {IA: iaX, RemoteID: 2, LinkType: dataplane.LinkParent, MTU: 1400},
+			5: {IA: iaD, RemoteID: 5, LinkType: dataplane.LinkPeer, MTU: 1300},
+		},
+		iaT: {
+			1: {IA: iaX, RemoteID: 3, LinkType: dataplane.LinkParent, MTU: 1400},
+		},
+		iaY: {
+			1: {IA: iaB, RemoteID: 2, LinkType: dataplane.LinkParent, MTU: 1400},
+			2: {IA: iaD, RemoteID: 1, LinkType: dataplane.LinkChild, MTU: 1400},
+			4: {IA: iaX, RemoteID: 4, LinkType: dataplane.LinkPeer, MTU: 1350},
+		},
+		iaD: {
+			1: {IA: iaY, RemoteID: 2, LinkType: dataplane.LinkParent, MTU: 1400},
+			5: {IA: iaS, RemoteID: 5, LinkType: dataplane.LinkPeer, MTU: 1300},
+		},
+	}
+)
+
+// hop describes the AS entry added to a segment.
+type hop struct {
+	ia              addr.IA
+	ingress, egress uint16
+	peers           []uint16
+}
+
+// newSegment creates a segment through the hops of the test topology.
+func newSegment(t *testing.T, timestamp time.Time, hops ...hop) *seg.PathSegment {
+	t.Helper()
+	ps, err := seg.CreateSegment(timestamp, uint16(timestamp.Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hops {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ext := &beaconing.Extender{
+			IA:         h.ia,
+			Interfaces: topology[h.ia],
+			Key:        testKey,
+			Signer: trust.Signer{
+				PrivateKey: key,
+				Algorithm:  signed.ECDSAWithSHA256,
+				IA:         h.ia,
+				Expiration: timestamp.Add(24 * time.Hour),
+			},
+		}
+		if err := ext.Extend(context.Background(), ps, h.ingress, h.egress, h.peers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ps
+}
+
+// interfaces formats the interfaces of the path.
+func interfaces(p combinator.Path) []string {
+	var intfs []string
+	for _, intf := range p.Metadata.Interfaces {
+		intfs = append(intfs, fmt.Sprintf("%s#%d", intf.IA, intf.ID))
+	}
+	return intfs
+}
+
+// checkMACs walks the path like the routers do and verifies every hop field
+// against the accumulated SegID.
+func checkMACs(t *testing.T, p combinator.Path) {
+	t.Helper()
+	var decoded scion.Decoded
+	if err := decoded.DecodeFromBytes(p.Raw.Raw); err != nil {
+		t.Fatalf("decoding path: %v", err)
+	}
+	hopIdx := 0
+	for i, info := range decoded.InfoFields {
+		hops := decoded.HopFields[hopIdx : hopIdx+int(decoded.PathMeta.SegLen[i])]
+		hopIdx += len(hops)
+		for j, hf := range hops {
+			// Peering hop fields do not change the accumulator. They are the
+			// last hop of up segments and the first hop of down segments.
+			isPeer := info.Peer && (info.ConsDir && j == 0 || !info.ConsDir && j == len(hops)-1)
+			if !info.ConsDir && j > 0 && !isPeer {
+				info.UpdateSegID(hf.Mac)
+			}
+			want := path.MAC(hmac.New(sha256.New, testKey), info, hf, nil)
+			if hf.Mac != want {
+				t.Errorf("segment %d: hop field %d has invalid MAC", i, j)
+			}
+			if info.ConsDir && !isPeer {
+				info.SegID ^= binary.BigEndian.Uint16(hf.Mac[:2])
+			}
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	earlier := now.Add(-time.Hour)
+	// upS and upT are the up segments of S and T, which double as their down
+	// segments. downD is the down segment of D, coreBA connects A to B.
+	upS := newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 2, []uint16{4}},
+		hop{iaS, 1, 0, []uint16{5}})
+	oldUpS := newSegment(t, earlier, hop{iaA, 0, 2, nil}, hop{iaX, 1, 2, []uint16{4}},
+		hop{iaS, 1, 0, []uint16{5}})
+	upT := newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 3, []uint16{4}}, hop{iaT, 1, 0, nil})
+	downD := newSegment(t, now, hop{iaB, 0, 2, nil}, hop{iaY, 1, 2, []uint16{4}},
+		hop{iaD, 1, 0, []uint16{5}})
+	coreBA := newSegment(t, now, hop{iaB, 0, 1, nil}, hop{iaA, 1, 0, nil})
+	// upX and downY end at the peering ASes X and Y.
+	upX := newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 0, []uint16{4}})
+	downY := newSegment(t, now, hop{iaB, 0, 2, nil}, hop{iaY, 1, 0, []uint16{4}})
+
+	type wantPath struct {
+		interfaces []string
+		segLen     [3]uint8
+		mtu        uint16
+		weight     int
+	}
+	tests := map[string]struct {
+		src, dst           addr.IA
+		ups, cores, downs  []*seg.PathSegment
+		want               []wantPath
+		wantExpiry         time.Time
+		wantFirstLatencies []time.Duration
+	}{
+		"up": {
+			src: iaS, dst: iaA,
+			ups: []*seg.PathSegment{upS},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#1", "1-ff00:0:110#2"},
+				segLen:     [3]uint8{3},
+				mtu:        1280,
+				weight:     2,
+			}},
+			wantExpiry:         now.Add(6 * time.Hour),
+			wantFirstLatencies: []time.Duration{5 * time.Millisecond, snet.LatencyUnset, 10 * time.Millisecond},
+		},
+		"up shortcut": {
+			src: iaS, dst: iaX,
+			ups: []*seg.PathSegment{upS},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2"},
+				segLen:     [3]uint8{2},
+				mtu:        1400,
+				weight:     1,
+			}},
+			wantExpiry:         now.Add(6 * time.Hour),
+			wantFirstLatencies: []time.Duration{5 * time.Millisecond},
+		},
+		"down": {
+			src: iaB, dst: iaD,
+			downs: []*seg.PathSegment{downD},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:120#2", "1-ff00:0:121#1", "1-ff00:0:121#2", "1-ff00:0:122#1"},
+				segLen:     [3]uint8{3},
+				mtu:        1400,
+				weight:     2,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"down shortcut": {
+			src: iaY, dst: iaD,
+			downs: []*seg.PathSegment{downD},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:121#2", "1-ff00:0:122#1"},
+				segLen:     [3]uint8{2},
+				mtu:        1400,
+				weight:     1,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"core": {
+			src: iaA, dst: iaB,
+			cores: []*seg.PathSegment{coreBA},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:110#1", "1-ff00:0:120#1"},
+				segLen:     [3]uint8{2},
+				mtu:        1400,
+				weight:     1,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"up and down through shortcut": {
+			// The path through the common core AS A traverses X twice and
+			// is dropped.
+			src: iaS, dst: iaT,
+			ups:   []*seg.PathSegment{upS},
+			downs: []*seg.PathSegment{upT},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#3", "1-ff00:0:113#1"},
+				segLen:     [3]uint8{2, 2},
+				mtu:        1400,
+				weight:     2,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"up and down through core": {
+			src: iaX, dst: iaT,
+			ups: []*seg.PathSegment{
+				newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 0, nil}),
+			},
+			downs: []*seg.PathSegment{upT},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:111#3", "1-ff00:0:113#1"},
+				segLen:     [3]uint8{2},
+				mtu:        1400,
+				weight:     1,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"up core down with peering": {
+			src: iaS, dst: iaD,
+			ups:   []*seg.PathSegment{upS},
+			cores: []*seg.PathSegment{coreBA},
+			downs: []*seg.PathSegment{downD},
+			want: []wantPath{
+				{
+					interfaces: []string{"1-ff00:0:112#5", "1-ff00:0:122#5"},
+					segLen:     [3]uint8{1, 1},
+					mtu:        1300,
+					weight:     1,
+				},
+				{
+					interfaces: []string{
+						"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#4",
+						"1-ff00:0:121#4", "1-ff00:0:121#2", "1-ff00:0:122#1",
+					},
+					segLen: [3]uint8{2, 2},
+					mtu:    1350,
+					weight: 3,
+				},
+				{
+					interfaces: []string{
+						"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#1", "1-ff00:0:110#2",
+						"1-ff00:0:110#1", "1-ff00:0:120#1", "1-ff00:0:120#2", "1-ff00:0:121#1",
+						"1-ff00:0:121#2", "1-ff00:0:122#1",
+					},
+					segLen: [3]uint8{3, 2, 3},
+					mtu:    1280,
+					weight: 5,
+				},
+			},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"peering between last ASes": {
+			src: iaX, dst: iaY,
+			ups:   []*seg.PathSegment{upX},
+			cores: []*seg.PathSegment{coreBA},
+			downs: []*seg.PathSegment{downY},
+			want: []wantPath{
+				{
+					interfaces: []string{"1-ff00:0:111#4", "1-ff00:0:121#4"},
+					segLen:     [3]uint8{1, 1},
+					mtu:        1350,
+					weight:     1,
+				},
+				{
+					interfaces: []string{
+						"1-ff00:0:111#1", "1-ff00:0:110#2", "1-ff00:0:110#1", "1-ff00:0:120#1",
+						"1-ff00:0:120#2", "1-ff00:0:121#1",
+					},
+					segLen: [3]uint8{2, 2, 2},
+					mtu:    1280,
+					weight: 3,
+				},
+			},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"peering after up shortcut": {
+			src: iaS, dst: iaY,
+			ups:   []*seg.PathSegment{upS},
+			cores: []*seg.PathSegment{coreBA},
+			downs: []*seg.PathSegment{downY},
+			want: []wantPath{
+				{
+					interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#4", "1-ff00:0:121#4"},
+					segLen:     [3]uint8{2, 1},
+					mtu:        1350,
+					weight:     2,
+				},
+				{
+					interfaces: []string{
+						"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#1", "1-ff00:0:110#2",
+						"1-ff00:0:110#1", "1-ff00:0:120#1", "1-ff00:0:120#2", "1-ff00:0:121#1",
+					},
+					segLen: [3]uint8{3, 2, 2},
+					mtu:    1280,
+					weight: 4,
+				},
+			},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"peering before down shortcut": {
+			src: iaX, dst: iaD,
+			ups:   []*seg.PathSegment{upX},
+			cores: []*seg.PathSegment{coreBA},
+			downs: []*seg.PathSegment{downD},
+			want: []wantPath{
+				{
+					interfaces: []string{"1-ff00:0:111#4", "1-ff00:0:121#4", "1-ff00:0:121#2", "1-ff00:0:122#1"},
+					segLen:     [3]uint8{1, 2},
+					mtu:        1350,
+					weight:     2,
+				},
+				{
+					interfaces: []string{
+						"1-ff00:0:111#1", "1-ff00:0:110#2", "1-ff00:0:110#1", "1-ff00:0:120#1",
+						"1-ff00:0:120#2", "1-ff00:0:121#1", "1-ff00:0:121#2", "1-ff00:0:122#1",
+					},
+					segLen: [3]uint8{2, 2, 3},
+					mtu:    1280,
+					weight: 4,
+				},
+			},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"missing core segment": {
+			src: iaS, dst: iaB,
+			ups: []*seg.PathSegment{upS},
+		},
+		"no segments": {
+			src: iaS, dst: iaD,
+		},
+		"duplicate segments": {
+			// Both segments result in the same path, the one that expires
+			// last is kept.
+			src: iaS, dst: iaA,
+			ups: []*seg.PathSegment{oldUpS, upS},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2", "1-ff00:0:111#1", "1-ff00:0:110#2"},
+				segLen:     [3]uint8{3},
+				mtu:        1280,
+				weight:     2,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+		"duplicate shortcuts": {
+			// The shortcut through X is constructed from both the long and the
+			// short up segment of S.
+			src: iaS, dst: iaX,
+			ups: []*seg.PathSegment{
+				oldUpS,
+				newSegment(t, now, hop{iaX, 0, 2, nil}, hop{iaS, 1, 0, nil}),
+			},
+			want: []wantPath{{
+				interfaces: []string{"1-ff00:0:112#1", "1-ff00:0:111#2"},
+				segLen:     [3]uint8{2},
+				mtu:        1400,
+				weight:     1,
+			}},
+			wantExpiry: now.Add(6 * time.Hour),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			paths := combinator.Combine(tc.src, tc.dst, tc.ups, tc.cores, tc.downs)
+			if len(paths) != len(tc.want) {
+				t.Fatalf("Combine returned %d paths, want %d", len(paths), len(tc.want))
+			}
+			for i, want := range tc.want {
+				p := paths[i]
+				if diff := cmp.Diff(want.interfaces, interfaces(p)); diff != "" {
+					t.Errorf("path %d: interfaces mismatch (-want +got):\n%s", i, diff)
+				}
+				if got := p.Raw.PathMeta.SegLen; got != want.segLen {
+					t.Errorf("path %d: SegLen = %v, want %v", i, got, want.segLen)
+				}
+				if p.Metadata.MTU != want.mtu {
+					t.Errorf("path %d: MTU = %d, want %d", i, p.Metadata.MTU, want.mtu)
+				}
+				if p.Weight != want.weight {
+					t.Errorf("path %d: Weight = %d, want %d", i, p.Weight, want.weight)
+				}
+				if !p.Metadata.Expiry.Equal(tc.wantExpiry) {
+					t.Errorf("path %d: Expiry = %s, want %s", i, p.Metadata.Expiry, tc.wantExpiry)
+				}
+				if want := len(p.Metadata.Interfaces) - 1; len(p.Metadata.Latency) != want {
+					t.Errorf("path %d: %d latencies, want %d", i, len(p.Metadata.Latency), want)
+				}
+				checkMACs(t, p)
+			}
+			if tc.wantFirstLatencies != nil {
+				if diff := cmp.Diff(tc.wantFirstLatencies, paths[0].Metadata.Latency); diff != "" {
+					t.Errorf("latency mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			// The result does not depend on the order of the segments or
+			// the iteration order of the graph.
+			for range 10 {
+				again := combinator.Combine(tc.src, tc.dst, reversed(tc.ups), reversed(tc.cores),
+					reversed(tc.downs))
+				for i := range paths {
+					if again[i].Fingerprint != paths[i].Fingerprint ||
+						!again[i].Metadata.Expiry.Equal(paths[i].Metadata.Expiry) {
+						t.Fatalf("path %d differs between runs", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCombinePathFlags(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	upS := newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 2, []uint16{4}},
+		hop{iaS, 1, 0, []uint16{5}})
+	downD := newSegment(t, now, hop{iaB, 0, 2, nil}, hop{iaY, 1, 2, []uint16{4}},
+		hop{iaD, 1, 0, []uint16{5}})
+	coreBA := newSegment(t, now, hop{iaB, 0, 1, nil}, hop{iaA, 1, 0, nil})
+
+	paths := combinator.Combine(iaS, iaD, []*seg.PathSegment{upS}, []*seg.PathSegment{coreBA},
+		[]*seg.PathSegment{downD})
+	type flags struct {
+		ConsDir, Peer bool
+	}
+	want := [][]flags{
+		{{false, true}, {true, true}},
+		{{false, true}, {true, true}},
+		{{false, false}, {false, false}, {true, false}},
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("Combine returned %d paths, want %d", len(paths), len(want))
+	}
+	for i, p := range paths {
+		var decoded scion.Decoded
+		if err := decoded.DecodeFromBytes(p.Raw.Raw); err != nil {
+			t.Fatal(err)
+		}
+		var got []flags
+		for _, info := range decoded.InfoFields {
+			got = append(got, flags{info.ConsDir, info.Peer})
+		}
+		if diff := cmp.Diff(want[i], got); diff != "" {
+			t.Errorf("path %d: info field flags mismatch (-want +got):\n%s", i, diff)
+		}
+		if p.Raw.NumINF != len(want[i]) || p.Raw.NumHops != len(decoded.HopFields) {
+			t.Errorf("path %d: NumINF = %d, NumHops = %d", i, p.Raw.NumINF, p.Raw.NumHops)
+		}
+	}
+}
+
+func TestCombineExpiry(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	upS := func(timestamp time.Time) *seg.PathSegment {
+		return newSegment(t, timestamp, hop{iaA, 0, 2, nil}, hop{iaX, 1, 2, []uint16{4}},
+			hop{iaS, 1, 0, []uint16{5}})
+	}
+	downD := newSegment(t, now, hop{iaB, 0, 2, nil}, hop{iaY, 1, 2, []uint16{4}},
+		hop{iaD, 1, 0, []uint16{5}})
+	coreBA := func() *seg.PathSegment {
+		return newSegment(t, now, hop{iaB, 0, 1, nil}, hop{iaA, 1, 0, nil})
+	}
+	// withExpTime sets the expiration time of the hop field of an AS entry.
+	// Combine does not verify the segments, so they can be modified after
+	// signing.
+	withExpTime := func(ps *seg.PathSegment, idx int, expTime uint8) *seg.PathSegment {
+		ps.ASEntries[idx].HopEntry.HopField.ExpTime = expTime
+		return ps
+	}
+
+	tests := map[string]struct {
+		src, dst          addr.IA
+		ups, cores, downs []*seg.PathSegment
+		want              []time.Time
+	}{
+		"earliest hop": {
+			src: iaS, dst: iaA,
+			ups:  []*seg.PathSegment{withExpTime(upS(now), 1, 0)},
+			want: []time.Time{now.Add(path.ExpTimeToDuration(0))},
+		},
+		"earliest segment": {
+			// Only the path through the core segment expires early.
+			src: iaS, dst: iaD,
+			ups:   []*seg.PathSegment{upS(now)},
+			cores: []*seg.PathSegment{withExpTime(coreBA(), 0, 10)},
+			downs: []*seg.PathSegment{downD},
+			want: []time.Time{
+				now.Add(6 * time.Hour),
+				now.Add(6 * time.Hour),
+				now.Add(path.ExpTimeToDuration(10)),
+			},
+		},
+		"expired segment": {
+			// Expired paths are returned, it is up to the caller to filter
+			// them.
+			src: iaS, dst: iaA,
+			ups:  []*seg.PathSegment{upS(now.Add(-12 * time.Hour))},
+			want: []time.Time{now.Add(-6 * time.Hour)},
+		},
+		"expired duplicate": {
+			src: iaS, dst: iaA,
+			ups:  []*seg.PathSegment{upS(now), upS(now.Add(-12 * time.Hour))},
+			want: []time.Time{now.Add(6 * time.Hour)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			paths := combinator.Combine(tc.src, tc.dst, tc.ups, tc.cores, tc.downs)
+			var got []time.Time
+			for _, p := range paths {
+				got = append(got, p.Metadata.Expiry)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("expiry mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCombineMetadata(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	upS := newSegment(t, now, hop{iaA, 0, 2, nil}, hop{iaX, 1, 2, []uint16{4}},
+		hop{iaS, 1, 0, []uint16{5}})
+	downD := newSegment(t, now, hop{iaB, 0, 2, nil}, hop{iaY, 1, 2, []uint16{4}},
+		hop{iaD, 1, 0, []uint16{5}})
+	coreBA := newSegment(t, now, hop{iaB, 0, 1, nil}, hop{iaA, 1, 0, nil})
+
+	// Combine does not verify the segments, so the AS entries of X and Y can be
+	// modified after signing. X announces a lower AS internal MTU.
+	upS.ASEntries[1].MTU = 1200
+	upS.ASEntries[1].Extensions.StaticInfo.Note = "X"
+	downD.ASEntries[1].Extensions.StaticInfo = &staticinfo.Extension{
+		Latency: staticinfo.LatencyInfo{
+			Intra: map[iface.ID]time.Duration{1: 3 * time.Millisecond, 4: 2 * time.Millisecond},
+			Inter: map[iface.ID]time.Duration{2: 4 * time.Millisecond},
+		},
+		Bandwidth: staticinfo.BandwidthInfo{
+			Intra: map[iface.ID]uint64{1: 100, 4: 50},
+			Inter: map[iface.ID]uint64{2: 1000},
+		},
+		Geo: staticinfo.GeoInfo{
+			2: {Latitude: 47.3, Longitude: 8.5, Address: "Zurich"},
+		},
+		LinkType: staticinfo.LinkTypeInfo{
+			2: staticinfo.LinkTypeMultihop,
+			4: staticinfo.LinkTypeDirect,
+		},
+		InternalHops: staticinfo.InternalHopsInfo{4: 2},
+		Note:         "Y",
+	}
+
+	paths := combinator.Combine(iaS, iaD, []*seg.PathSegment{upS}, []*seg.PathSegment{coreBA},
+		[]*seg.PathSegment{downD})
+	if len(paths) != 3 {
+		t.Fatalf("Combine returned %d paths, want 3", len(paths))
+	}
+	// The peering link between S and D bypasses X, the other paths are limited
+	// by its internal MTU.
+	for i, want := range []uint16{1300, 1200, 1200} {
+		if paths[i].Metadata.MTU != want {
+			t.Errorf("path %d: MTU = %d, want %d", i, paths[i].Metadata.MTU, want)
+		}
+	}
+
+	// The path S#1 X#2 X#4 Y#4 Y#2 D#1 uses the peering link between X and Y.
+	md := paths[1].Metadata
+	type staticInfo struct {
+		Latency      []time.Duration
+		Bandwidth    []uint64
+		Geo          []snet.GeoCoordinates
+		LinkType     []snet.LinkType
+		InternalHops []uint32
+		Notes        []string
+	}
+	want := staticInfo{
+		Latency: []time.Duration{
+			5 * time.Millisecond, snet.LatencyUnset, snet.LatencyUnset,
+			2 * time.Millisecond, 4 * time.Millisecond,
+		},
+		Bandwidth: []uint64{0, 0, 0, 50, 1000},
+		Geo: []snet.GeoCoordinates{
+			{}, {}, {}, {}, {Latitude: 47.3, Longitude: 8.5, Address: "Zurich"}, {},
+		},
+		LinkType:     []snet.LinkType{snet.LinkTypeUnset, snet.LinkTypeDirect, snet.LinkTypeMultihop},
+		InternalHops: []uint32{0, 2},
+		Notes:        []string{"", "X", "Y", ""},
+	}
+	got := staticInfo{
+		Latency:      md.Latency,
+		Bandwidth:    md.Bandwidth,
+		Geo:          md.Geo,
+		LinkType:     md.LinkType,
+		InternalHops: md.InternalHops,
+		Notes:        md.Notes,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("static info mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func reversed(segments []*seg.PathSegment) []*seg.PathSegment {
+	r := make([]*seg.PathSegment, len(segments))
+	for i, s := range segments {
+		r[len(segments)-1-i] = s
+	}
+	return r
+}
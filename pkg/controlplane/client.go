@@ -1,10 +1,18 @@
 package controlplane
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
 	"strings"
 
 	"connectrpc.com/connect"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+	"github.com/scionproto/scion/pkg/snet"
 )
 
 // Client implements the Interface by making RPC calls to a remote server.
@@ -14,6 +22,10 @@ type Client struct {
 	control_planeconnect.SegmentRegistrationServiceClient
 	control_planeconnect.SegmentLookupServiceClient
 	control_planeconnect.ChainRenewalServiceClient
+
+	// The transports of a client created by Dial, closed by Close.
+	h3 *http3.Transport
+	tr *quic.Transport
 }
 
 // NewClient creates a new control plane client.
@@ -27,3 +39,44 @@ func NewClient(clt connect.HTTPClient, baseURL string, opts ...connect.ClientOpt
 		ChainRenewalServiceClient:        control_planeconnect.NewChainRenewalServiceClient(clt, baseURL, opts...),
 	}
 }
+
+// Dial creates a control plane client that sends the RPCs over QUIC on the connection, usually a
+// SCION connection from the host package. All requests are sent to the remote address. The
+// connection must not be used by a Server at the same time.
+//
+// The TLS configuration is usually ClientTLSConfig. If it has no server name and the remote
+// address is a *snet.UDPAddr, the ISD-AS of the remote address is used as server name.
+func Dial(conn net.PacketConn, remote net.Addr, tlsConf *tls.Config,
+	opts ...connect.ClientOption) *Client {
+
+	tlsConf = tlsConf.Clone()
+	if a, ok := remote.(*snet.UDPAddr); ok && tlsConf.ServerName == "" {
+		tlsConf.ServerName = a.IA.String()
+	}
+	tr := &quic.Transport{Conn: conn}
+	h3 := &http3.Transport{
+		TLSClientConfig: tlsConf,
+		Dial: func(ctx context.Context, _ string, tlsConf *tls.Config,
+			conf *quic.Config) (*quic.Conn, error) {
+
+			return tr.Dial(ctx, remote, tlsConf, conf)
+		},
+	}
+	// The URL does not address the server, which is given by remote.
+	c := NewClient(&http.Client{Transport: h3}, "https://cion", opts...)
+	c.h3, c.tr = h3, tr
+	return c
+}
+
+// Close closes the QUIC connections of a client created by Dial. The connection passed to Dial
+// is not closed and can be reused. Clients created by NewClient are not affected.
+func (c *Client) Close() error {
+	var errs []error
+	if c.h3 != nil {
+		errs = append(errs, c.h3.Close())
+	}
+	if c.tr != nil {
+		errs = append(errs, c.tr.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"connectrpc.com/connect"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// Fetcher fetches trust material from the control services of other ASes. It
+// is the network side of trust.FetchingProvider, which verifies the fetched
+// material.
+type Fetcher struct {
+	// Clients returns a client to the control service at the address passed
+	// with the trust.Server option.
+	Clients func(net.Addr) (*Client, error)
+}
+
+var _ trust.Fetcher = Fetcher{}
+
+// Chains fetches the certificate chains that match the query. A server that
+// has no matching chains is not an error.
+func (f Fetcher) Chains(ctx context.Context, query trust.ChainQuery,
+	server net.Addr) ([][]*x509.Certificate, error) {
+
+	clt, err := f.Clients(server)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", server, err)
+	}
+	req := &cppb.ChainsRequest{
+		IsdAs:        uint64(query.IA),
+		SubjectKeyId: query.SubjectKeyID,
+	}
+	if !query.Validity.NotBefore.IsZero() {
+		req.AtLeastValidSince = timestamppb.New(query.Validity.NotBefore)
+	}
+	if !query.Validity.NotAfter.IsZero() {
+		req.AtLeastValidUntil = timestamppb.New(query.Validity.NotAfter)
+	}
+	rep, err := clt.Chains(ctx, connect.NewRequest(req))
+	if connect.CodeOf(err) == connect.CodeNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("requesting chains: %w", err)
+	}
+	chains := make([][]*x509.Certificate, 0, len(rep.Msg.Chains))
+	for _, pb := range rep.Msg.Chains {
+		as, err := x509.ParseCertificate(pb.AsCert)
+		if err != nil {
+			return nil, fmt.Errorf("parsing AS certificate: %w", err)
+		}
+		ca, err := x509.ParseCertificate(pb.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("parsing CA certificate: %w", err)
+		}
+		chains = append(chains, []*x509.Certificate{as, ca})
+	}
+	return chains, nil
+}
+
+// TRC fetches the TRC with the given ID.
+func (f Fetcher) TRC(ctx context.Context, id cppki.TRCID,
+	server net.Addr) (cppki.SignedTRC, error) {
+
+	clt, err := f.Clients(server)
+	if err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("connecting to %s: %w", server, err)
+	}
+	rep, err := clt.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{
+		Isd:    uint32(id.ISD),
+		Base:   uint64(id.Base),
+		Serial: uint64(id.Serial),
+	}))
+	if err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("requesting TRC %s: %w", id, err)
+	}
+	trc, err := cppki.DecodeSignedTRC(rep.Msg.Trc)
+	if err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("parsing TRC %s: %w", id, err)
+	}
+	return trc, nil
+}
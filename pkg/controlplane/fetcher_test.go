@@ -0,0 +1,210 @@
+package controlplane_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+// countingFetcher counts the fetches and blocks them until release is closed.
+type countingFetcher struct {
+	trust.Fetcher
+	fetches atomic.Int32
+	release chan struct{}
+}
+
+func (f *countingFetcher) Chains(ctx context.Context, query trust.ChainQuery,
+	server net.Addr) ([][]*x509.Certificate, error) {
+
+	f.fetches.Add(1)
+	<-f.release
+	return f.Fetcher.Chains(ctx, query, server)
+}
+
+func TestFetchingProvider(t *testing.T) {
+	ctx := context.Background()
+	isd := trusttest.NewISD(t, coreIA, leafIA)
+	rogue := trusttest.NewISD(t, coreIA, leaf2IA)
+	// The TRC update subtest updates isd.TRC.
+	base := isd.TRC
+
+	// The remote serves a valid chain of the core AS and a chain of leaf2
+	// that is not issued under the TRC.
+	remoteDB := newTrustDB(t, base)
+	for _, chain := range [][]*x509.Certificate{isd.ASes[coreIA].Chain, rogue.ASes[leaf2IA].Chain} {
+		if _, err := remoteDB.InsertChain(ctx, chain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := newService(t, coreIA)
+	svc.TrustDB = remoteDB
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		controlplane.NewServer(svc).Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	fetcher := controlplane.Fetcher{
+		Clients: func(net.Addr) (*controlplane.Client, error) {
+			return controlplane.NewClient(srv.Client(), srv.URL), nil
+		},
+	}
+	server := &snet.UDPAddr{IA: coreIA, Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+
+	tests := map[string]struct {
+		query      trust.ChainQuery
+		opts       []trust.Option
+		recurser   trust.Recurser
+		wantChains int
+		wantErr    bool
+	}{
+		"fetched": {
+			query:      trust.ChainQuery{IA: coreIA, Validity: cppki.Validity{NotAfter: time.Now()}},
+			opts:       []trust.Option{trust.Server(server)},
+			wantChains: 1,
+		},
+		"not verifiable": {
+			query: trust.ChainQuery{IA: leaf2IA},
+			opts:  []trust.Option{trust.Server(server)},
+		},
+		"not on remote": {
+			query: trust.ChainQuery{IA: leafIA},
+			opts:  []trust.Option{trust.Server(server)},
+		},
+		"no server": {
+			query:   trust.ChainQuery{IA: coreIA},
+			wantErr: true,
+		},
+		"recursion not allowed": {
+			query: trust.ChainQuery{IA: coreIA},
+			opts: []trust.Option{
+				trust.Server(server),
+				trust.Client(&snet.UDPAddr{IA: core2IA}),
+			},
+			recurser: trust.ASLocalRecurser{IA: coreIA},
+			wantErr:  true,
+		},
+		"wildcard": {
+			query:   trust.ChainQuery{IA: addr.MustIAFrom(1, 0)},
+			opts:    []trust.Option{trust.Server(server)},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newTrustDB(t, base)
+			p := &trust.FetchingProvider{DB: db, Recurser: tc.recurser, Fetcher: fetcher}
+			chains, err := p.GetChains(ctx, tc.query, tc.opts...)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("GetChains should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChains failed: %v", err)
+			}
+			if len(chains) != tc.wantChains {
+				t.Errorf("got %d chains, want %d", len(chains), tc.wantChains)
+			}
+			stored, err := db.Chains(ctx, trust.ChainQuery{IA: tc.query.IA})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != tc.wantChains {
+				t.Errorf("stored %d chains, want %d", len(stored), tc.wantChains)
+			}
+
+			// Stored chains are served without fetching.
+			before := requests.Load()
+			if _, err := p.GetChains(ctx, tc.query); tc.wantChains > 0 && err != nil {
+				t.Errorf("GetChains from database failed: %v", err)
+			}
+			if tc.wantChains > 0 && requests.Load() != before {
+				t.Error("stored chains should not be fetched again")
+			}
+		})
+	}
+
+	t.Run("concurrent fetches", func(t *testing.T) {
+		f := &countingFetcher{Fetcher: fetcher, release: make(chan struct{})}
+		p := &trust.FetchingProvider{DB: newTrustDB(t, base), Fetcher: f}
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				chains, err := p.GetChains(ctx, trust.ChainQuery{IA: coreIA}, trust.Server(server))
+				if err != nil || len(chains) != 1 {
+					t.Errorf("GetChains returned %d chains: %v", len(chains), err)
+				}
+			}()
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(f.release)
+		wg.Wait()
+		if n := f.fetches.Load(); n != 1 {
+			t.Errorf("fetched %d times, want 1", n)
+		}
+	})
+
+	t.Run("TRC update", func(t *testing.T) {
+		local, remote := newTrustDB(t, base), newTrustDB(t, base)
+		svc.TrustDB = remote
+		defer func() { svc.TrustDB = remoteDB }()
+		p := &trust.FetchingProvider{DB: local, Fetcher: fetcher}
+
+		// The remote stores an update that is not voted for by the voters of
+		// the base TRC.
+		rogueUpdate := rogue.Update(t, cppki.SensitiveUpdate, time.Now(), time.Hour)
+		if _, err := remote.InsertTRC(ctx, rogueUpdate); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.NotifyTRC(ctx, rogueUpdate.TRC.ID, trust.Server(server)); err == nil {
+			t.Error("NotifyTRC should reject an update that does not verify")
+		}
+
+		remote = newTrustDB(t, base)
+		svc.TrustDB = remote
+		update := isd.Update(t, cppki.RegularUpdate, time.Now(), time.Hour)
+		if _, err := remote.InsertTRC(ctx, update); err != nil {
+			t.Fatal(err)
+		}
+		trc, err := p.GetSignedTRC(ctx, update.TRC.ID, trust.Server(server))
+		if err != nil {
+			t.Fatalf("GetSignedTRC failed: %v", err)
+		}
+		if trc.TRC.ID != update.TRC.ID {
+			t.Errorf("got TRC %s, want %s", trc.TRC.ID, update.TRC.ID)
+		}
+	})
+
+	t.Run("unverifiable chain in database", func(t *testing.T) {
+		// Chains in the database are verified as well, even if inactive TRCs
+		// are allowed.
+		db := newTrustDB(t, base)
+		if _, err := db.InsertChain(ctx, rogue.ASes[leaf2IA].Chain); err != nil {
+			t.Fatal(err)
+		}
+		p := &trust.FetchingProvider{DB: db, Fetcher: fetcher}
+		chains, err := p.GetChains(ctx, trust.ChainQuery{IA: leaf2IA},
+			trust.AllowInactive(), trust.Server(server))
+		if err != nil || len(chains) != 0 {
+			t.Errorf("GetChains returned %d unverifiable chains: %v", len(chains), err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package controlplane
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// DefaultMaterialLimit is the default limit of trust material requests per
+// peer.
+var DefaultMaterialLimit = RateLimit{Rate: 10, Burst: 50}
+
+// RateLimit limits the requests of a single peer with a token bucket.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second.
+	Rate float64
+	// Burst is the number of requests that can be sent at once.
+	Burst int
+}
+
+// limiter tracks a token bucket per peer. The zero value is ready to use.
+type limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the bucket of the peer and reports whether one was
+// available.
+func (l *limiter) allow(peer string, limit RateLimit, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	// Buckets that have refilled completely are equivalent to new ones.
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if b.refill(limit, now) >= float64(limit.Burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[peer]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[peer] = b
+	}
+	if b.refill(limit, now) < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *bucket) refill(limit RateLimit, now time.Time) float64 {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.Rate)
+		b.last = now
+	}
+	return b.tokens
+}
+
+// peerKey identifies the peer of the RPC for rate limiting. Authenticated peers
+// are identified by their ISD-AS, others by their host address.
+func peerKey(ctx context.Context, peer connect.Peer) string {
+	if ia, ok := PeerIA(ctx); ok {
+		return ia.String()
+	}
+	if host, _, err := net.SplitHostPort(peer.Addr); err == nil {
+		return host
+	}
+	return peer.Addr
+}
@@ -0,0 +1,190 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/scrypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// Chains returns the certificate chains in the trust DB that match the request.
+func (s *Service) Chains(ctx context.Context,
+	req *connect.Request[cppb.ChainsRequest]) (*connect.Response[cppb.ChainsResponse], error) {
+
+	if err := s.checkMaterialLimit(ctx, req.Peer()); err != nil {
+		return nil, err
+	}
+	query, err := requestToChainQuery(req.Msg)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	chains, err := s.TrustDB.Chains(ctx, query)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("looking up chains: %w", err))
+	}
+	if len(chains) == 0 {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("no chains of %s found", query.IA))
+	}
+	return connect.NewResponse(chainsToResponse(chains)), nil
+}
+
+// TRC returns the TRC in the trust DB that matches the request.
+func (s *Service) TRC(ctx context.Context,
+	req *connect.Request[cppb.TRCRequest]) (*connect.Response[cppb.TRCResponse], error) {
+
+	if err := s.checkMaterialLimit(ctx, req.Peer()); err != nil {
+		return nil, err
+	}
+	id, err := requestToTRCQuery(req.Msg)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	trc, err := s.TrustDB.SignedTRC(ctx, id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("looking up TRC: %w", err))
+	}
+	if trc.IsZero() {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("TRC %s not found", id))
+	}
+	return connect.NewResponse(&cppb.TRCResponse{Trc: trc.Raw}), nil
+}
+
+// ChainRenewer renews the certificate chains of ASes.
+type ChainRenewer interface {
+	// RenewChain verifies the CMS signed renewal request and returns the CMS
+	// signed response with the renewed chain. Rejected requests return an
+	// error wrapping pki.ErrInvalidRenewal.
+	RenewChain(ctx context.Context, req []byte) ([]byte, error)
+}
+
+var _ ChainRenewer = (*pki.CA)(nil)
+
+// ChainRenewal handles certificate renewal requests. Only CMS signed requests
+// are supported.
+func (s *Service) ChainRenewal(ctx context.Context,
+	req *connect.Request[cppb.ChainRenewalRequest],
+) (*connect.Response[cppb.ChainRenewalResponse], error) {
+
+	if s.CA == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented,
+			errors.New("chain renewal is not supported by this AS"))
+	}
+	if err := s.checkMaterialLimit(ctx, req.Peer()); err != nil {
+		return nil, err
+	}
+	if len(req.Msg.CmsSignedRequest) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			errors.New("renewal request is not CMS signed"))
+	}
+	rep, err := s.CA.RenewChain(ctx, req.Msg.CmsSignedRequest)
+	switch {
+	case errors.Is(err, pki.ErrInvalidRenewal):
+		return nil, connect.NewError(connect.CodePermissionDenied, err)
+	case err != nil:
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("renewing chain: %w", err))
+	}
+	return connect.NewResponse(&cppb.ChainRenewalResponse{CmsSignedResponse: rep}), nil
+}
+
+// PublishTRC verifies the TRC against its predecessor in the trust DB and
+// inserts it, so that it is served to other ASes.
+func (s *Service) PublishTRC(ctx context.Context, trc cppki.SignedTRC) error {
+	if _, err := (trust.TRCVerifier{DB: s.TrustDB}).Insert(ctx, trc); err != nil {
+		return fmt.Errorf("publishing TRC %s: %w", trc.TRC.ID, err)
+	}
+	return nil
+}
+
+// checkMaterialLimit returns a resource exhausted error if the peer of the RPC
+// has exceeded the trust material request limit.
+func (s *Service) checkMaterialLimit(ctx context.Context, peer connect.Peer) error {
+	limit := s.MaterialLimit
+	if limit == (RateLimit{}) {
+		limit = DefaultMaterialLimit
+	}
+	key := peerKey(ctx, peer)
+	if !s.materialLimiter.allow(key, limit, time.Now()) {
+		return connect.NewError(connect.CodeResourceExhausted,
+			fmt.Errorf("trust material request limit of %s exceeded", key))
+	}
+	return nil
+}
+
+func requestToChainQuery(req *cppb.ChainsRequest) (trust.ChainQuery, error) {
+	ia := addr.IA(req.IsdAs)
+	if ia.IsWildcard() {
+		return trust.ChainQuery{}, fmt.Errorf("requested ISD-AS %s is a wildcard", ia)
+	}
+	var validity cppki.Validity
+	if req.AtLeastValidUntil != nil {
+		if err := req.AtLeastValidUntil.CheckValid(); err != nil {
+			return trust.ChainQuery{}, fmt.Errorf("validating at_least_valid_until: %w", err)
+		}
+		validity.NotAfter = req.AtLeastValidUntil.AsTime()
+		// Clients that do not set at_least_valid_since expect the chain to be
+		// valid at at_least_valid_until.
+		if req.AtLeastValidSince == nil {
+			validity.NotBefore = validity.NotAfter
+		}
+	}
+	if req.AtLeastValidSince != nil {
+		if err := req.AtLeastValidSince.CheckValid(); err != nil {
+			return trust.ChainQuery{}, fmt.Errorf("validating at_least_valid_since: %w", err)
+		}
+		validity.NotBefore = req.AtLeastValidSince.AsTime()
+	}
+	if !validity.NotAfter.IsZero() && validity.NotBefore.After(validity.NotAfter) {
+		return trust.ChainQuery{}, fmt.Errorf("at_least_valid_since %s after at_least_valid_until %s",
+			validity.NotBefore, validity.NotAfter)
+	}
+	return trust.ChainQuery{
+		IA:           ia,
+		SubjectKeyID: req.SubjectKeyId,
+		Validity:     validity,
+	}, nil
+}
+
+func requestToTRCQuery(req *cppb.TRCRequest) (cppki.TRCID, error) {
+	if req.Isd > uint32(addr.MaxISD) {
+		return cppki.TRCID{}, fmt.Errorf("requested ISD %d not in range", req.Isd)
+	}
+	id := cppki.TRCID{
+		ISD:    addr.ISD(req.Isd),
+		Base:   scrypto.Version(req.Base),
+		Serial: scrypto.Version(req.Serial),
+	}
+	// Queries for the latest TRC only need a valid ISD.
+	if id.Base.IsLatest() && id.Serial.IsLatest() {
+		if id.ISD == 0 {
+			return cppki.TRCID{}, cppki.ErrWildcardISD
+		}
+		return id, nil
+	}
+	if err := id.Validate(); err != nil {
+		return cppki.TRCID{}, err
+	}
+	return id, nil
+}
+
+func chainsToResponse(chains [][]*x509.Certificate) *cppb.ChainsResponse {
+	rep := &cppb.ChainsResponse{
+		Chains: make([]*cppb.Chain, 0, len(chains)),
+	}
+	for _, chain := range chains {
+		rep.Chains = append(rep.Chains, &cppb.Chain{
+			AsCert: chain[0].Raw,
+			CaCert: chain[1].Raw,
+		})
+	}
+	return rep
+}
@@ -0,0 +1,76 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"connectrpc.com/connect"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/proto/control_plane/v1/control_planeconnect"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// Renewer renews the chain of the local AS at the CA of a core or
+// authoritative AS with the ChainRenewal RPC. The new key is written to the key
+// directory and the renewed chain is inserted into the trust DB, where a
+// trust.KeySignerGen picks them up.
+type Renewer struct {
+	// Client sends the renewal requests to the CA, usually a *Client.
+	Client control_planeconnect.ChainRenewalServiceClient
+	// KeyDir is the directory the new keys are written to, i.e. the Dir of
+	// the trust.KeyDir of the signer generator.
+	KeyDir string
+	// DB is the trust DB the renewed chains are verified against and
+	// inserted into.
+	DB trust.DB
+}
+
+var _ trust.Renewer = Renewer{}
+
+// Renew generates a new key and requests a chain for it, signing the request
+// with the current signer.
+func (r Renewer) Renew(ctx context.Context, signer trust.Signer) error {
+	key, err := pki.NewKey()
+	if err != nil {
+		return err
+	}
+	csr, err := pki.CreateCSR(signer.IA, key)
+	if err != nil {
+		return fmt.Errorf("creating CSR: %w", err)
+	}
+	req, err := signer.SignCMS(ctx, csr)
+	if err != nil {
+		return fmt.Errorf("signing renewal request: %w", err)
+	}
+	rep, err := r.Client.ChainRenewal(ctx,
+		connect.NewRequest(&cppb.ChainRenewalRequest{CmsSignedRequest: req}))
+	if err != nil {
+		return fmt.Errorf("requesting renewal: %w", err)
+	}
+	chain, err := pki.ParseRenewalResponse(rep.Msg.CmsSignedResponse)
+	if err != nil {
+		return err
+	}
+	if pub, ok := chain[0].PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(key.Public()) {
+		return errors.New("renewed certificate is not for the requested key")
+	}
+	if err := (trust.ChainVerifier{DB: r.DB}).Verify(ctx, chain, time.Now()); err != nil {
+		return fmt.Errorf("verifying renewed chain: %w", err)
+	}
+
+	// The key is written first, so the chain is never used without its key.
+	file := filepath.Join(r.KeyDir, fmt.Sprintf("%x.key", chain[0].SubjectKeyId))
+	if err := trust.WritePrivateKey(file, key); err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+	if _, err := r.DB.InsertChain(ctx, chain); err != nil {
+		return fmt.Errorf("inserting renewed chain: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package controlplane_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+func TestRenewer(t *testing.T) {
+	ctx := context.Background()
+	caIA, asIA := addr.MustParseIA("2-ff00:0:210"), addr.MustParseIA("2-ff00:0:211")
+	svc := newService(t, caIA)
+	isd := trusttest.NewISD(t, caIA)
+	if err := svc.PublishTRC(ctx, isd.TRC); err != nil {
+		t.Fatal(err)
+	}
+	svc.CA = &pki.CA{Credential: isd.CA, DB: svc.TrustDB, Signer: isd.Signer(caIA)}
+
+	// The current chain expires within the renewal period.
+	key, err := pki.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	cert, err := pki.CreateCertificate(cppki.AS, pki.Subject(asIA, cppki.AS), key.Public(),
+		cppki.Validity{NotBefore: now.Add(-time.Minute), NotAfter: now.Add(time.Hour)}, isd.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.TrustDB.InsertChain(ctx, []*x509.Certificate{cert, isd.CA.Cert}); err != nil {
+		t.Fatal(err)
+	}
+	keyDir := t.TempDir()
+	if err := trust.WritePrivateKey(filepath.Join(keyDir, "as.key"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &trust.SignerManager{
+		SignerGen: trust.KeySignerGen{IA: asIA, KeyRing: &trust.KeyDir{Dir: keyDir}, DB: svc.TrustDB},
+		Renewer:   controlplane.Renewer{Client: svc, KeyDir: keyDir, DB: svc.TrustDB},
+	}
+	if err := m.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	signer, err := m.Signer(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(signer.SubjectKeyID, cert.SubjectKeyId) {
+		t.Error("signer should use the renewed key")
+	}
+	if !signer.Expiration.After(cert.NotAfter) {
+		t.Errorf("renewed signer expires at %s, before %s", signer.Expiration, cert.NotAfter)
+	}
+	if keys, _ := filepath.Glob(filepath.Join(keyDir, "*.key")); len(keys) != 2 {
+		t.Errorf("expected the current and the renewed key, got %v", keys)
+	}
+	if _, err := m.Sign(ctx, []byte("msg")); err != nil {
+		t.Errorf("Sign failed: %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package controlplane
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 
 	"github.com/quic-go/quic-go/http3"
@@ -32,11 +35,34 @@ func NewServer(svc ControlPlane) *Server {
 	mux.Handle(control_planeconnect.NewChainRenewalServiceHandler(svc))
 
 	return &Server{
-		Handler: mux,
+		Handler: withPeerIA(mux),
 	}
 }
 
-// ListenAndServe starts the HTTP/3 server.
-func (s *Server) ListenAndServe(addr string, certFile, keyFile string) error {
-	return http3.ListenAndServeQUIC(addr, certFile, keyFile, s.Handler)
+// ListenAndServe starts the HTTP/3 server on the UDP address, usually with
+// ServerTLSConfig.
+func (s *Server) ListenAndServe(addr string, tlsConf *tls.Config) error {
+	srv := &http3.Server{
+		Addr:      addr,
+		Handler:   s.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConf),
+	}
+	return srv.ListenAndServe()
+}
+
+// Serve serves the control plane over QUIC on the connection, usually a SCION connection from
+// the host package, until the context is canceled. The connection is not closed. The TLS
+// configuration is usually ServerTLSConfig.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn, tlsConf *tls.Config) error {
+	srv := &http3.Server{
+		Handler:   s.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConf),
+	}
+	stop := context.AfterFunc(ctx, func() { srv.Close() })
+	defer stop()
+	err := srv.Serve(conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
@@ -0,0 +1,211 @@
+package controlplane_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/dataplane/host"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+func listenUDP(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newRouter starts the router of an AS with a single link and returns the
+// address of its internal interface.
+func newRouter(t *testing.T, ctx context.Context, ia addr.IA, key []byte, id uint16,
+	link net.PacketConn, peer net.Addr, lt dataplane.LinkType, neighbor addr.IA) net.Addr {
+
+	t.Helper()
+	internal := listenUDP(t)
+	r := dataplane.NewRouter(key)
+	r.AddInterface(dataplane.InternalInterface, dataplane.Interface{
+		Conn:       internal,
+		RemoteAddr: internal.LocalAddr(),
+		IA:         ia,
+	})
+	r.AddInterface(id, dataplane.Interface{Conn: link, RemoteAddr: peer, LinkType: lt, IA: neighbor})
+	go r.Run(ctx)
+	return internal.LocalAddr()
+}
+
+func newSCIONConn(t *testing.T, ia addr.IA, router net.Addr) *host.Conn {
+	t.Helper()
+	conn, err := host.NewConn(listenUDP(t), host.Config{LocalIA: ia, Router: router})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// signerGen generates a fixed set of signers.
+type signerGen []trust.Signer
+
+func (g signerGen) Generate(context.Context) ([]trust.Signer, error) {
+	return g, nil
+}
+
+func newTrustDB(t *testing.T, trcs ...cppki.SignedTRC) trust.DB {
+	t.Helper()
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, trc := range trcs {
+		if _, err := db.InsertTRC(context.Background(), trc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// peerService records the authenticated peer of the TRC requests.
+type peerService struct {
+	*controlplane.Service
+	peer atomic.Uint64
+}
+
+func (s *peerService) TRC(ctx context.Context,
+	req *connect.Request[cppb.TRCRequest]) (*connect.Response[cppb.TRCResponse], error) {
+
+	peer, _ := controlplane.PeerIA(ctx)
+	s.peer.Store(uint64(peer))
+	return s.Service.TRC(ctx, req)
+}
+
+func TestServerSCION(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	childIA := addr.MustParseIA("1-ff00:0:112")
+	coreKey, childKey := []byte("core-key"), []byte("child-key")
+	isd := trusttest.NewISD(t, coreIA, childIA)
+	rogue := trusttest.NewISD(t, coreIA, childIA)
+
+	// The core AS reaches the child on interface 1, the child reaches the
+	// core on interface 2.
+	coreLink, childLink := listenUDP(t), listenUDP(t)
+	coreRouter := newRouter(t, ctx, coreIA, coreKey, 1, coreLink, childLink.LocalAddr(),
+		dataplane.LinkChild, childIA)
+	childRouter := newRouter(t, ctx, childIA, childKey, 2, childLink, coreLink.LocalAddr(),
+		dataplane.LinkParent, coreIA)
+
+	// The path from the child to the core runs against the construction
+	// direction of the segment from the core to the child.
+	info := path.InfoField{SegID: 0x1234, Timestamp: uint32(time.Now().Unix())}
+	coreHop := path.HopField{ExpTime: 63, ConsEgress: 1}
+	coreHop.Mac = path.MAC(hmac.New(sha256.New, coreKey), info, coreHop, nil)
+	info.UpdateSegID(coreHop.Mac)
+	childHop := path.HopField{ExpTime: 63, ConsIngress: 2}
+	childHop.Mac = path.MAC(hmac.New(sha256.New, childKey), info, childHop, nil)
+	up, err := snetpath.NewSCIONFromDecoded(scion.Decoded{
+		Base: scion.Base{
+			PathMeta: scion.MetaHdr{SegLen: [3]uint8{2, 0, 0}},
+			NumINF:   1,
+			NumHops:  2,
+		},
+		InfoFields: []path.InfoField{info},
+		HopFields:  []path.HopField{childHop, coreHop},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &peerService{Service: newService(t, coreIA)}
+	serverTLS := controlplane.ServerTLSConfig(signerGen{isd.Signer(coreIA)}, newTrustDB(t, isd.TRC))
+	serverConn := newSCIONConn(t, coreIA, coreRouter)
+	go controlplane.NewServer(svc).Serve(ctx, serverConn, serverTLS)
+	remote := &snet.UDPAddr{
+		IA:   coreIA,
+		Path: up,
+		Host: serverConn.LocalAddr().(*snet.UDPAddr).Host,
+	}
+
+	tests := map[string]struct {
+		signer     trust.Signer
+		serverName string
+		wantErr    bool
+	}{
+		"valid": {
+			signer: isd.Signer(childIA),
+		},
+		"untrusted client": {
+			signer:  rogue.Signer(childIA),
+			wantErr: true,
+		},
+		"server name mismatch": {
+			signer:     isd.Signer(childIA),
+			serverName: core2IA.String(),
+			wantErr:    true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc.peer.Store(0)
+			clientTLS := controlplane.ClientTLSConfig(signerGen{tc.signer}, newTrustDB(t, isd.TRC))
+			clientTLS.ServerName = tc.serverName
+			clt := controlplane.Dial(newSCIONConn(t, childIA, childRouter), remote, clientTLS)
+			defer clt.Close()
+
+			reqCtx, reqCancel := context.WithTimeout(ctx, 5*time.Second)
+			defer reqCancel()
+			rep, err := clt.TRC(reqCtx, connect.NewRequest(&cppb.TRCRequest{Isd: 1}))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("TRC should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TRC failed: %v", err)
+			}
+			if len(rep.Msg.Trc) == 0 {
+				t.Error("expected TRC in response")
+			}
+			if peer := addr.IA(svc.peer.Load()); !peer.Equal(childIA) {
+				t.Errorf("handler saw peer %s, want %s", peer, childIA)
+			}
+			// The authenticated child cannot send beacons of another AS.
+			_, err = clt.Beacon(reqCtx, connect.NewRequest(&cppb.BeaconRequest{
+				Segment: seg.PathSegmentToPB(newSegment(t, []addr.IA{core2IA}, coreIA, 5)),
+			}))
+			if connect.CodeOf(err) != connect.CodePermissionDenied {
+				t.Errorf("beacon of another AS should be denied, got %v", err)
+			}
+
+			if err := clt.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+			if _, err := clt.TRC(reqCtx, connect.NewRequest(&cppb.TRCRequest{Isd: 1})); err == nil {
+				t.Error("TRC should fail after Close")
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	"github.com/scionproto/scion/pkg/scrypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// Interface is an inter-AS interface of the local AS.
+type Interface struct {
+	// IA is the ISD-AS of the neighbour.
+	IA addr.IA
+	// RemoteID is the ID of the interface on the neighbour's side of the link.
+	RemoteID uint16
+	// LinkType is the type of the link from the local AS's point of view.
+	LinkType dataplane.LinkType
+	// MTU is the MTU of the link.
+	MTU int
+	// Latency is the latency of the link. Zero means unknown.
+	Latency time.Duration
+}
+
+// Service implements the control plane RPCs of a single AS. As every AS is run
+// by a single node, the service answers from its local stores only.
+type Service struct {
+	// IA is the local ISD-AS.
+	IA addr.IA
+	// Interfaces are the inter-AS interfaces of the local AS, keyed by their ID.
+	Interfaces map[uint16]Interface
+	// TrustDB stores the TRCs and certificate chains.
+	TrustDB trust.DB
+	// PathDB stores the path segments.
+	PathDB pathdb.DB
+	// Beacons stores the received beacons.
+	Beacons beacon.DB
+	// Verifier verifies the signatures of received beacons and registered
+	// segments, usually a trust.Verifier. Nil rejects beacons, registrations
+	// and recursive lookups.
+	Verifier seg.Verifier
+	// Clients returns a client to the control service of the given core AS.
+	// Non-core ASes use it to resolve core and down segments recursively. Nil
+	// disables recursive resolution.
+	Clients func(addr.IA) (*Client, error)
+	// Recurser decides whether a client may trigger recursive resolution. Nil
+	// means trust.ASLocalRecurser for the local AS.
+	Recurser trust.Recurser
+	// CA renews the certificate chains of the ASes in the ISD, usually a
+	// pki.CA on core and authoritative ASes. Nil rejects renewal requests.
+	CA ChainRenewer
+	// MaterialLimit limits the TRC, chain and renewal requests of each peer.
+	// The zero value means DefaultMaterialLimit.
+	MaterialLimit RateLimit
+
+	materialLimiter limiter
+}
+
+var _ ControlPlane = (*Service)(nil)
+
+// Beacon handles a beacon received from a neighbour.
+func (s *Service) Beacon(ctx context.Context,
+	req *connect.Request[cppb.BeaconRequest]) (*connect.Response[cppb.BeaconResponse], error) {
+
+	if err := s.checkVerifier(); err != nil {
+		return nil, err
+	}
+	ps, err := seg.BeaconFromPB(req.Msg.Segment)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("parsing beacon: %w", err))
+	}
+	last := ps.ASEntries[ps.MaxIdx()]
+	if !last.Next.Equal(s.IA) {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("beacon is destined to %s, not %s", last.Next, s.IA))
+	}
+	if err := checkPeer(ctx, last.Local); err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(ps.ASEntries, func(e seg.ASEntry) bool { return e.Local.Equal(s.IA) }) {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("beacon already contains %s", s.IA))
+	}
+	ingress, ok := s.ingress(last.Local, last.HopEntry.HopField.ConsEgress)
+	if !ok {
+		return nil, connect.NewError(connect.CodeFailedPrecondition,
+			fmt.Errorf("no interface to %s#%d", last.Local, last.HopEntry.HopField.ConsEgress))
+	}
+	if lt := s.Interfaces[ingress].LinkType; lt != dataplane.LinkParent && lt != dataplane.LinkCore {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("beacon received on %s interface %d", lt, ingress))
+	}
+	if err := verifySegment(ctx, s.Verifier, ps); err != nil {
+		return nil, connect.NewError(connect.CodePermissionDenied,
+			fmt.Errorf("verifying beacon: %w", err))
+	}
+
+	if _, err := s.Beacons.Insert(ctx, beacon.Beacon{Segment: ps, InIfID: ingress}); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("inserting beacon: %w", err))
+	}
+	return connect.NewResponse(&cppb.BeaconResponse{}), nil
+}
+
+// SegmentsRegistration handles down segments registered by non-core ASes.
+// Up and core segments are only used by the AS that creates them and are
+// never registered remotely.
+func (s *Service) SegmentsRegistration(ctx context.Context,
+	req *connect.Request[cppb.SegmentsRegistrationRequest],
+) (*connect.Response[cppb.SegmentsRegistrationResponse], error) {
+
+	if err := s.checkVerifier(); err != nil {
+		return nil, err
+	}
+	core, err := s.isCore(ctx, s.IA)
+	if err != nil {
+		return nil, err
+	}
+	if !core {
+		return nil, connect.NewError(connect.CodeFailedPrecondition,
+			fmt.Errorf("segments can only be registered at core ASes"))
+	}
+
+	var metas []*seg.Meta
+	for t, segs := range req.Msg.Segments {
+		if seg.Type(t) != seg.TypeDown {
+			return nil, connect.NewError(connect.CodeInvalidArgument,
+				fmt.Errorf("unsupported segment type for registration: %s", seg.Type(t)))
+		}
+		for _, pb := range segs.GetSegments() {
+			ps, err := seg.SegmentFromPB(pb)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument,
+					fmt.Errorf("parsing segment: %w", err))
+			}
+			if !ps.FirstIA().Equal(s.IA) {
+				return nil, connect.NewError(connect.CodeInvalidArgument,
+					fmt.Errorf("segment starts at %s, not %s", ps.FirstIA(), s.IA))
+			}
+			if err := checkPeer(ctx, ps.LastIA()); err != nil {
+				return nil, err
+			}
+			if err := verifySegment(ctx, s.Verifier, ps); err != nil {
+				return nil, connect.NewError(connect.CodePermissionDenied,
+					fmt.Errorf("verifying segment: %w", err))
+			}
+			metas = append(metas, &seg.Meta{Segment: ps, Type: seg.TypeDown})
+		}
+	}
+	for _, m := range metas {
+		if _, err := s.PathDB.Insert(ctx, m); err != nil {
+			return nil, connect.NewError(connect.CodeInternal,
+				fmt.Errorf("inserting segment: %w", err))
+		}
+	}
+	return connect.NewResponse(&cppb.SegmentsRegistrationResponse{}), nil
+}
+
+// Segments looks up the segments between the source and the destination. The
+// type of the segments is determined by whether the source and destination
+// are core ASes.
+func (s *Service) Segments(ctx context.Context,
+	req *connect.Request[cppb.SegmentsRequest]) (*connect.Response[cppb.SegmentsResponse], error) {
+
+	src, dst := addr.IA(req.Msg.SrcIsdAs), addr.IA(req.Msg.DstIsdAs)
+	query, err := s.segmentsQuery(ctx, src, dst)
+	if err != nil {
+		return nil, err
+	}
+	metas, err := s.PathDB.Get(ctx, query)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("looking up segments: %w", err))
+	}
+	// Up segments are always local. Core and down segments are cached in the
+	// path DB until they expire, so only resolve them if none are known.
+	if len(metas) == 0 && !slices.Contains(query.SegTypes, seg.TypeUp) {
+		if metas, err = s.resolveSegments(ctx, req.Peer(), src, dst, query); err != nil {
+			return nil, err
+		}
+	}
+	return connect.NewResponse(segmentsToResponse(metas)), nil
+}
+
+// resolveSegments resolves the segments from the core ASes on behalf of a
+// non-core AS. The segments are requested from the source of the lookup, which
+// is a core AS and stores the core and down segments starting at it. Wildcard
+// sources are expanded to the core ASes reachable over the local up segments.
+func (s *Service) resolveSegments(ctx context.Context, peer connect.Peer, src, dst addr.IA,
+	query pathdb.Query) ([]*seg.Meta, error) {
+
+	if s.Clients == nil {
+		return nil, nil
+	}
+	if core, err := s.isCore(ctx, s.IA); err != nil || core {
+		return nil, err
+	}
+	recurser := s.Recurser
+	if recurser == nil {
+		recurser = trust.ASLocalRecurser{IA: s.IA}
+	}
+	if err := recurser.AllowRecursion(peerAddr(ctx, peer)); err != nil {
+		return nil, connect.NewError(connect.CodePermissionDenied,
+			fmt.Errorf("resolving segments: %w", err))
+	}
+	if err := s.checkVerifier(); err != nil {
+		return nil, err
+	}
+
+	cores := []addr.IA{src}
+	if src.IsWildcard() {
+		ups, err := s.PathDB.Get(ctx, pathdb.Query{
+			SegTypes: []seg.Type{seg.TypeUp},
+			StartsAt: []addr.IA{src},
+			EndsAt:   []addr.IA{s.IA},
+		})
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal,
+				fmt.Errorf("looking up up segments: %w", err))
+		}
+		cores = nil
+		for _, m := range ups {
+			if !slices.Contains(cores, m.Segment.FirstIA()) {
+				cores = append(cores, m.Segment.FirstIA())
+			}
+		}
+	}
+
+	var metas []*seg.Meta
+	var errs []error
+	for _, core := range cores {
+		fetched, err := s.fetchSegments(ctx, core, dst, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("core %s: %w", core, err))
+			continue
+		}
+		metas = append(metas, fetched...)
+	}
+	if len(metas) == 0 && len(errs) != 0 {
+		return nil, connect.NewError(connect.CodeUnavailable,
+			fmt.Errorf("resolving segments: %w", errors.Join(errs...)))
+	}
+	return metas, nil
+}
+
+// fetchSegments requests the segments from the core AS, and caches the
+// verified segments that match the query.
+func (s *Service) fetchSegments(ctx context.Context, core, dst addr.IA,
+	query pathdb.Query) ([]*seg.Meta, error) {
+
+	clt, err := s.Clients(core)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	rep, err := clt.Segments(ctx, connect.NewRequest(&cppb.SegmentsRequest{
+		SrcIsdAs: uint64(core),
+		DstIsdAs: uint64(dst),
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("requesting segments: %w", err)
+	}
+
+	var metas []*seg.Meta
+	for t, segs := range rep.Msg.Segments {
+		for _, pb := range segs.GetSegments() {
+			ps, err := seg.SegmentFromPB(pb)
+			if err != nil {
+				return nil, fmt.Errorf("parsing segment: %w", err)
+			}
+			m := &seg.Meta{Type: seg.Type(t), Segment: ps}
+			if !query.Match(m) {
+				return nil, fmt.Errorf("unexpected %s segment %s", m.Type, ps)
+			}
+			if err := verifySegment(ctx, s.Verifier, ps); err != nil {
+				return nil, fmt.Errorf("verifying segment: %w", err)
+			}
+			metas = append(metas, m)
+		}
+	}
+	for _, m := range metas {
+		if _, err := s.PathDB.Insert(ctx, m); err != nil {
+			return nil, fmt.Errorf("caching segment: %w", err)
+		}
+	}
+	return metas, nil
+}
+
+// segmentsQuery classifies the lookup from src to dst into the segment type
+// that connects them.
+func (s *Service) segmentsQuery(ctx context.Context, src, dst addr.IA) (pathdb.Query, error) {
+	if src.ISD() == 0 || dst.ISD() == 0 {
+		return pathdb.Query{}, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("wildcard ISD in request: src %s dst %s", src, dst))
+	}
+	srcCore, err := s.isCore(ctx, src)
+	if err != nil {
+		return pathdb.Query{}, err
+	}
+	dstCore, err := s.isCore(ctx, dst)
+	if err != nil {
+		return pathdb.Query{}, err
+	}
+
+	switch {
+	case !srcCore && dstCore:
+		return pathdb.Query{
+			SegTypes: []seg.Type{seg.TypeUp},
+			StartsAt: []addr.IA{dst},
+			EndsAt:   []addr.IA{src},
+		}, nil
+	case srcCore && dstCore:
+		return pathdb.Query{
+			SegTypes: []seg.Type{seg.TypeCore},
+			StartsAt: []addr.IA{dst},
+			EndsAt:   []addr.IA{src},
+		}, nil
+	case srcCore && !dstCore:
+		return pathdb.Query{
+			SegTypes: []seg.Type{seg.TypeDown},
+			StartsAt: []addr.IA{src},
+			EndsAt:   []addr.IA{dst},
+		}, nil
+	default:
+		return pathdb.Query{}, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("no segments between non-core ASes: src %s dst %s", src, dst))
+	}
+}
+
+// isCore reports whether the ISD-AS is a core AS according to the latest TRC
+// of its ISD. Wildcard ASes and ASes in remote ISDs are considered core, as
+// only core ASes are reachable across ISDs.
+func (s *Service) isCore(ctx context.Context, ia addr.IA) (bool, error) {
+	if ia.AS() == 0 || ia.ISD() != s.IA.ISD() {
+		return true, nil
+	}
+	trc, err := s.TrustDB.SignedTRC(ctx, cppki.TRCID{
+		ISD:    ia.ISD(),
+		Base:   scrypto.LatestVer,
+		Serial: scrypto.LatestVer,
+	})
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, fmt.Errorf("looking up TRC: %w", err))
+	}
+	if trc.IsZero() {
+		return false, connect.NewError(connect.CodeUnavailable,
+			fmt.Errorf("no TRC available for ISD %d", ia.ISD()))
+	}
+	return slices.Contains(trc.TRC.CoreASes, ia.AS()), nil
+}
+
+// ingress finds the local interface connected to the given interface of the
+// neighbour.
+func (s *Service) ingress(remote addr.IA, remoteID uint16) (uint16, bool) {
+	for id, intf := range s.Interfaces {
+		if intf.IA.Equal(remote) && intf.RemoteID == remoteID {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// peerAddr returns the address of the RPC peer as passed with the trust.Client
+// option. Local calls have no peer address. Authenticated peers get a SCION
+// address in their ISD-AS. Other IP peers are only known to be in the local AS
+// if they connect over the loopback interface. Their AS is unknown otherwise,
+// so that the recurser rejects them.
+func peerAddr(ctx context.Context, peer connect.Peer) net.Addr {
+	if peer.Addr == "" {
+		return nil
+	}
+	if a, err := snet.ParseUDPAddr(peer.Addr); err == nil {
+		return a
+	}
+	if a, err := netip.ParseAddrPort(peer.Addr); err == nil {
+		switch ia, ok := PeerIA(ctx); {
+		case ok:
+			return &snet.UDPAddr{IA: ia, Host: net.UDPAddrFromAddrPort(a)}
+		case a.Addr().Unmap().IsLoopback():
+			return net.TCPAddrFromAddrPort(a)
+		default:
+			return net.UDPAddrFromAddrPort(a)
+		}
+	}
+	return &net.UnixAddr{Name: peer.Addr, Net: peer.Protocol}
+}
+
+// checkVerifier returns an unimplemented error if the service has no verifier
+// for the segments it receives.
+func (s *Service) checkVerifier() error {
+	if s.Verifier == nil {
+		return connect.NewError(connect.CodeUnimplemented,
+			errors.New("segment verification is not configured"))
+	}
+	return nil
+}
+
+// verifySegment verifies the signatures of all AS entries of the segment. Each
+// entry must be signed by the AS it describes.
+func verifySegment(ctx context.Context, v seg.Verifier, ps *seg.PathSegment) error {
+	for i, entry := range ps.ASEntries {
+		hdr, err := signed.ExtractUnverifiedHeader(entry.Signed)
+		if err != nil {
+			return fmt.Errorf("AS entry %d: %w", i, err)
+		}
+		var keyID cppb.VerificationKeyID
+		if err := proto.Unmarshal(hdr.VerificationKeyID, &keyID); err != nil {
+			return fmt.Errorf("AS entry %d: parsing verification key ID: %w", i, err)
+		}
+		if ia := addr.IA(keyID.IsdAs); !ia.Equal(entry.Local) {
+			return fmt.Errorf("AS entry %d of %s signed by %s", i, entry.Local, ia)
+		}
+		if err := ps.VerifyASEntry(ctx, v, i); err != nil {
+			return fmt.Errorf("AS entry %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func segmentsToResponse(metas []*seg.Meta) *cppb.SegmentsResponse {
+	rep := &cppb.SegmentsResponse{
+		Segments: make(map[int32]*cppb.SegmentsResponse_Segments),
+	}
+	for _, m := range metas {
+		t := int32(m.Type)
+		if rep.Segments[t] == nil {
+			rep.Segments[t] = &cppb.SegmentsResponse_Segments{}
+		}
+		rep.Segments[t].Segments = append(rep.Segments[t].Segments, seg.PathSegmentToPB(m.Segment))
+	}
+	return rep
+}
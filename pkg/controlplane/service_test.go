@@ -0,0 +1,584 @@
+package controlplane_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/fancl20/cion/pkg/beacon"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+var (
+	coreIA  = addr.MustParseIA("1-ff00:0:110")
+	core2IA = addr.MustParseIA("1-ff00:0:111")
+	leafIA  = addr.MustParseIA("1-ff00:0:1")
+	leaf2IA = addr.MustParseIA("1-ff00:0:2")
+)
+
+// segmentKey signs the AS entries of all test segments.
+var segmentKey = func() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+type keyVerifier struct {
+	key crypto.PublicKey
+}
+
+func (v keyVerifier) Verify(_ context.Context, msg *cryptopb.SignedMessage,
+	associatedData ...[]byte) (*signed.Message, error) {
+
+	return signed.Verify(msg, v.key, associatedData...)
+}
+
+type memPathDB struct {
+	metas []*seg.Meta
+}
+
+func (db *memPathDB) Get(_ context.Context, q pathdb.Query) ([]*seg.Meta, error) {
+	var res []*seg.Meta
+	for _, m := range db.metas {
+		if q.Match(m) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (db *memPathDB) Insert(_ context.Context, m *seg.Meta) (bool, error) {
+	db.metas = append(db.metas, m)
+	return true, nil
+}
+
+func (db *memPathDB) Close() error { return nil }
+
+type memBeaconDB struct {
+	beacons []beacon.Beacon
+}
+
+func (db *memBeaconDB) Beacons(_ context.Context, origin addr.IA) ([]beacon.Beacon, error) {
+	return db.beacons, nil
+}
+
+func (db *memBeaconDB) Insert(_ context.Context, b beacon.Beacon) (bool, error) {
+	db.beacons = append(db.beacons, b)
+	return true, nil
+}
+
+func (db *memBeaconDB) Close() error { return nil }
+
+// newSegment creates a segment through the given ASes. If next is non-zero,
+// the segment is a beacon leaving the last AS on interface egress.
+func newSegment(t *testing.T, ias []addr.IA, next addr.IA, egress uint16) *seg.PathSegment {
+	t.Helper()
+	return newSignedSegment(t, segmentKey, ias, next, egress)
+}
+
+func newSignedSegment(t *testing.T, key *ecdsa.PrivateKey, ias []addr.IA, next addr.IA,
+	egress uint16) *seg.PathSegment {
+
+	t.Helper()
+	ps, err := seg.CreateSegment(time.Now(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ia := range ias {
+		entry := seg.ASEntry{
+			Local: ia,
+			MTU:   1472,
+			HopEntry: seg.HopEntry{
+				HopField: seg.HopField{ExpTime: 63, ConsIngress: uint16(10 + i), ConsEgress: uint16(20 + i)},
+			},
+		}
+		if i == 0 {
+			entry.HopEntry.HopField.ConsIngress = 0
+		}
+		if i == len(ias)-1 {
+			entry.Next, entry.HopEntry.HopField.ConsEgress = next, egress
+		} else {
+			entry.Next = ias[i+1]
+		}
+		signer := trust.Signer{
+			PrivateKey: key,
+			Algorithm:  signed.ECDSAWithSHA256,
+			IA:         ia,
+			Expiration: time.Now().Add(time.Hour),
+		}
+		if err := ps.AddASEntry(context.Background(), entry, signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ps
+}
+
+func newService(t *testing.T, ia addr.IA) *controlplane.Service {
+	t.Helper()
+
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	raw, err := os.ReadFile("../trust/impl/dbtest/testdata/ISD1-B1-S1.trc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trc, err := cppki.DecodeSignedTRC(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.InsertTRC(context.Background(), trc); err != nil {
+		t.Fatal(err)
+	}
+	return &controlplane.Service{
+		IA: ia,
+		Interfaces: map[uint16]controlplane.Interface{
+			1: {IA: core2IA, RemoteID: 5, LinkType: dataplane.LinkCore},
+			2: {IA: leafIA, RemoteID: 6, LinkType: dataplane.LinkChild},
+		},
+		TrustDB:  db,
+		PathDB:   &memPathDB{},
+		Beacons:  &memBeaconDB{},
+		Verifier: keyVerifier{key: segmentKey.Public()},
+	}
+}
+
+func TestServiceSegments(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t, coreIA)
+	svc.PathDB = &memPathDB{metas: []*seg.Meta{
+		{Type: seg.TypeCore, Segment: newSegment(t, []addr.IA{core2IA, coreIA}, 0, 0)},
+		{Type: seg.TypeDown, Segment: newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0)},
+		{Type: seg.TypeUp, Segment: newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0)},
+	}}
+
+	testCases := map[string]struct {
+		src, dst addr.IA
+		want     seg.Type
+		code     connect.Code
+	}{
+		"core":                  {src: coreIA, dst: core2IA, want: seg.TypeCore},
+		"down":                  {src: coreIA, dst: leafIA, want: seg.TypeDown},
+		"up":                    {src: leafIA, dst: coreIA, want: seg.TypeUp},
+		"up to any core":        {src: leafIA, dst: addr.MustParseIA("1-0"), want: seg.TypeUp},
+		"between non-core ASes": {src: leafIA, dst: leaf2IA, code: connect.CodeInvalidArgument},
+		"wildcard ISD":          {src: 0, dst: leafIA, code: connect.CodeInvalidArgument},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rep, err := svc.Segments(ctx, connect.NewRequest(&cppb.SegmentsRequest{
+				SrcIsdAs: uint64(tc.src),
+				DstIsdAs: uint64(tc.dst),
+			}))
+			if tc.code != 0 {
+				if connect.CodeOf(err) != tc.code {
+					t.Fatalf("expected code %s, got %v", tc.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Segments failed: %v", err)
+			}
+			if len(rep.Msg.Segments) != 1 || len(rep.Msg.Segments[int32(tc.want)].GetSegments()) != 1 {
+				t.Errorf("expected a single %s segment, got %v", tc.want, rep.Msg.Segments)
+			}
+		})
+	}
+}
+
+func TestServiceSegmentsRecursive(t *testing.T) {
+	ctx := context.Background()
+	core := newService(t, coreIA)
+	core.PathDB = &memPathDB{metas: []*seg.Meta{
+		{Type: seg.TypeCore, Segment: newSegment(t, []addr.IA{core2IA, coreIA}, 0, 0)},
+		{Type: seg.TypeDown, Segment: newSegment(t, []addr.IA{coreIA, leaf2IA}, 0, 0)},
+	}}
+	leaf := newService(t, leafIA)
+	leaf.PathDB = &memPathDB{metas: []*seg.Meta{
+		{Type: seg.TypeUp, Segment: newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0)},
+	}}
+	leaf.Clients = func(ia addr.IA) (*controlplane.Client, error) {
+		if !ia.Equal(coreIA) {
+			t.Errorf("unexpected lookup at %s", ia)
+		}
+		return &controlplane.Client{SegmentLookupServiceClient: core}, nil
+	}
+	lookup := func(src, dst addr.IA) int {
+		t.Helper()
+		rep, err := leaf.Segments(ctx, connect.NewRequest(&cppb.SegmentsRequest{
+			SrcIsdAs: uint64(src),
+			DstIsdAs: uint64(dst),
+		}))
+		if err != nil {
+			t.Fatalf("Segments failed: %v", err)
+		}
+		var n int
+		for _, segs := range rep.Msg.Segments {
+			n += len(segs.Segments)
+		}
+		return n
+	}
+
+	if n := lookup(coreIA, leaf2IA); n != 1 {
+		t.Errorf("expected 1 down segment, got %d", n)
+	}
+	if n := lookup(addr.MustParseIA("1-0"), core2IA); n != 1 {
+		t.Errorf("expected 1 core segment through any core, got %d", n)
+	}
+
+	// Resolved segments are cached until they expire.
+	core.PathDB = &memPathDB{}
+	if n := lookup(coreIA, leaf2IA); n != 1 {
+		t.Errorf("expected 1 cached down segment, got %d", n)
+	}
+
+	leaf.PathDB = &memPathDB{}
+	core.PathDB = &memPathDB{metas: []*seg.Meta{
+		{Type: seg.TypeDown, Segment: newSegment(t, []addr.IA{coreIA, leaf2IA}, 0, 0)},
+	}}
+	leaf.Recurser = trust.NeverRecurser{}
+	_, err := leaf.Segments(ctx, connect.NewRequest(&cppb.SegmentsRequest{
+		SrcIsdAs: uint64(coreIA),
+		DstIsdAs: uint64(leaf2IA),
+	}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("segments should not be resolved without recursion, got %v", err)
+	}
+}
+
+func TestServiceSegmentsRegistration(t *testing.T) {
+	ctx := context.Background()
+	register := func(svc *controlplane.Service, t seg.Type, ps *seg.PathSegment) error {
+		_, err := svc.SegmentsRegistration(ctx, connect.NewRequest(&cppb.SegmentsRegistrationRequest{
+			Segments: map[int32]*cppb.SegmentsRegistrationRequest_Segments{
+				int32(t): {Segments: []*cppb.PathSegment{seg.PathSegmentToPB(ps)}},
+			},
+		}))
+		return err
+	}
+
+	svc := newService(t, coreIA)
+	if err := register(svc, seg.TypeDown, newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0)); err != nil {
+		t.Fatalf("registering down segment failed: %v", err)
+	}
+	if metas, _ := svc.PathDB.Get(ctx, pathdb.Query{}); len(metas) != 1 {
+		t.Errorf("expected the segment to be stored, got %d segments", len(metas))
+	}
+
+	err := register(svc, seg.TypeUp, newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("registering up segment should be invalid, got %v", err)
+	}
+	err = register(svc, seg.TypeDown, newSegment(t, []addr.IA{core2IA, leafIA}, 0, 0))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("registering segment of another core should be invalid, got %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = register(svc, seg.TypeDown, newSignedSegment(t, otherKey, []addr.IA{coreIA, leaf2IA}, 0, 0))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("registering segment with invalid signature should be denied, got %v", err)
+	}
+	err = register(newService(t, leafIA), seg.TypeDown, newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0))
+	if connect.CodeOf(err) != connect.CodeFailedPrecondition {
+		t.Errorf("registering at non-core AS should fail, got %v", err)
+	}
+}
+
+func TestServiceNoVerifier(t *testing.T) {
+	ctx := context.Background()
+	core := newService(t, coreIA)
+	core.Verifier = nil
+	_, err := core.Beacon(ctx, connect.NewRequest(&cppb.BeaconRequest{
+		Segment: seg.PathSegmentToPB(newSegment(t, []addr.IA{core2IA}, coreIA, 5)),
+	}))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("Beacon should be unimplemented, got %v", err)
+	}
+	_, err = core.SegmentsRegistration(ctx, connect.NewRequest(&cppb.SegmentsRegistrationRequest{
+		Segments: map[int32]*cppb.SegmentsRegistrationRequest_Segments{
+			int32(seg.TypeDown): {Segments: []*cppb.PathSegment{
+				seg.PathSegmentToPB(newSegment(t, []addr.IA{coreIA, leafIA}, 0, 0)),
+			}},
+		},
+	}))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("SegmentsRegistration should be unimplemented, got %v", err)
+	}
+
+	core.PathDB = &memPathDB{metas: []*seg.Meta{
+		{Type: seg.TypeDown, Segment: newSegment(t, []addr.IA{coreIA, leaf2IA}, 0, 0)},
+	}}
+	leaf := newService(t, leafIA)
+	leaf.Verifier = nil
+	leaf.Clients = func(addr.IA) (*controlplane.Client, error) {
+		return &controlplane.Client{SegmentLookupServiceClient: core}, nil
+	}
+	_, err = leaf.Segments(ctx, connect.NewRequest(&cppb.SegmentsRequest{
+		SrcIsdAs: uint64(coreIA),
+		DstIsdAs: uint64(leaf2IA),
+	}))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("recursive Segments should be unimplemented, got %v", err)
+	}
+}
+
+func TestServiceBeacon(t *testing.T) {
+	ctx := context.Background()
+	send := func(svc *controlplane.Service, ps *seg.PathSegment) error {
+		_, err := svc.Beacon(ctx, connect.NewRequest(&cppb.BeaconRequest{
+			Segment: seg.PathSegmentToPB(ps),
+		}))
+		return err
+	}
+
+	svc := newService(t, coreIA)
+	if err := send(svc, newSegment(t, []addr.IA{core2IA}, coreIA, 5)); err != nil {
+		t.Fatalf("Beacon failed: %v", err)
+	}
+	beacons, _ := svc.Beacons.Beacons(ctx, 0)
+	if len(beacons) != 1 || beacons[0].InIfID != 1 {
+		t.Errorf("expected beacon received on interface 1, got %v", beacons)
+	}
+
+	err := send(svc, newSegment(t, []addr.IA{core2IA}, coreIA, 7))
+	if connect.CodeOf(err) != connect.CodeFailedPrecondition {
+		t.Errorf("beacon on unknown interface should fail, got %v", err)
+	}
+	err = send(svc, newSegment(t, []addr.IA{leafIA}, coreIA, 6))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("beacon from child should be invalid, got %v", err)
+	}
+	err = send(svc, newSegment(t, []addr.IA{core2IA}, leafIA, 5))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("beacon for another AS should be invalid, got %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = send(svc, newSignedSegment(t, otherKey, []addr.IA{core2IA}, coreIA, 5))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("beacon with invalid signature should be denied, got %v", err)
+	}
+}
+
+func TestServiceTrustMaterial(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t, coreIA)
+
+	rep, err := svc.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{Isd: 1}))
+	if err != nil {
+		t.Fatalf("TRC failed: %v", err)
+	}
+	if trc, err := cppki.DecodeSignedTRC(rep.Msg.Trc); err != nil || trc.TRC.ID.ISD != 1 {
+		t.Errorf("unexpected TRC: %v", err)
+	}
+	_, err = svc.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{Isd: 2}))
+	if connect.CodeOf(err) != connect.CodeNotFound {
+		t.Errorf("missing TRC should not be found, got %v", err)
+	}
+	_, err = svc.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{Isd: 0}))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("wildcard ISD should be invalid, got %v", err)
+	}
+
+	chain := trusttest.NewISD(t, coreIA).ASes[coreIA].Chain
+	if _, err := svc.TrustDB.InsertChain(ctx, chain); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		req      *cppb.ChainsRequest
+		wantCode connect.Code
+	}{
+		"found": {
+			req: &cppb.ChainsRequest{
+				IsdAs:             uint64(coreIA),
+				SubjectKeyId:      chain[0].SubjectKeyId,
+				AtLeastValidUntil: timestamppb.New(time.Now()),
+			},
+		},
+		"unknown AS": {
+			req:      &cppb.ChainsRequest{IsdAs: uint64(leafIA)},
+			wantCode: connect.CodeNotFound,
+		},
+		"expired": {
+			req: &cppb.ChainsRequest{
+				IsdAs:             uint64(coreIA),
+				AtLeastValidUntil: timestamppb.New(chain[0].NotAfter.Add(time.Hour)),
+			},
+			wantCode: connect.CodeNotFound,
+		},
+		"wildcard": {
+			req:      &cppb.ChainsRequest{IsdAs: uint64(addr.MustIAFrom(1, 0))},
+			wantCode: connect.CodeInvalidArgument,
+		},
+		"inverted validity": {
+			req: &cppb.ChainsRequest{
+				IsdAs:             uint64(coreIA),
+				AtLeastValidSince: timestamppb.New(time.Now()),
+				AtLeastValidUntil: timestamppb.New(time.Now().Add(-time.Hour)),
+			},
+			wantCode: connect.CodeInvalidArgument,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rep, err := svc.Chains(ctx, connect.NewRequest(tc.req))
+			if tc.wantCode != 0 {
+				if connect.CodeOf(err) != tc.wantCode {
+					t.Errorf("Chains returned %v, want %s", err, tc.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chains failed: %v", err)
+			}
+			if len(rep.Msg.Chains) != 1 {
+				t.Errorf("expected 1 chain, got %d", len(rep.Msg.Chains))
+			}
+		})
+	}
+
+	_, err = svc.ChainRenewal(ctx, connect.NewRequest(&cppb.ChainRenewalRequest{}))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("chain renewal without CA should be unimplemented, got %v", err)
+	}
+}
+
+func TestServicePublishTRC(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t, coreIA)
+	isd := trusttest.NewISD(t, addr.MustParseIA("2-ff00:0:210"))
+	base := isd.TRC
+	update := isd.Update(t, cppki.RegularUpdate, time.Now(), time.Hour)
+
+	if err := svc.PublishTRC(ctx, update); err == nil {
+		t.Error("publishing a TRC without its predecessor should fail")
+	}
+	for _, trc := range []cppki.SignedTRC{base, update} {
+		if err := svc.PublishTRC(ctx, trc); err != nil {
+			t.Fatalf("PublishTRC failed: %v", err)
+		}
+	}
+	rep, err := svc.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{Isd: 2}))
+	if err != nil {
+		t.Fatalf("TRC failed: %v", err)
+	}
+	if trc, err := cppki.DecodeSignedTRC(rep.Msg.Trc); err != nil || trc.TRC.ID != update.TRC.ID {
+		t.Errorf("published TRC should be served: %v", err)
+	}
+}
+
+func TestServiceChainRenewal(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t, coreIA)
+	asIA := addr.MustParseIA("2-ff00:0:211")
+	isd := trusttest.NewISD(t, addr.MustParseIA("2-ff00:0:210"), asIA)
+	if err := svc.PublishTRC(ctx, isd.TRC); err != nil {
+		t.Fatal(err)
+	}
+	svc.CA = &pki.CA{
+		Credential: isd.CA,
+		DB:         svc.TrustDB,
+		Signer:     isd.Signer(addr.MustParseIA("2-ff00:0:210")),
+	}
+
+	key, err := pki.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := pki.CreateCSR(asIA, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := isd.Signer(asIA).SignCMS(ctx, csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep, err := svc.ChainRenewal(ctx, connect.NewRequest(&cppb.ChainRenewalRequest{CmsSignedRequest: req}))
+	if err != nil {
+		t.Fatalf("ChainRenewal failed: %v", err)
+	}
+	if chain, err := pki.ParseRenewalResponse(rep.Msg.CmsSignedResponse); err != nil ||
+		chain[0].Subject.CommonName != pki.Subject(asIA, cppki.AS).CommonName {
+		t.Errorf("unexpected renewed chain: %v", err)
+	}
+
+	_, err = svc.ChainRenewal(ctx, connect.NewRequest(&cppb.ChainRenewalRequest{}))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("request without CMS should be invalid, got %v", err)
+	}
+	// The core AS may not renew the chain of another AS.
+	req, err = isd.Signer(addr.MustParseIA("2-ff00:0:210")).SignCMS(ctx, csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ChainRenewal(ctx, connect.NewRequest(&cppb.ChainRenewalRequest{CmsSignedRequest: req}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("request for other AS should be denied, got %v", err)
+	}
+}
+
+func TestServiceMaterialLimit(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t, coreIA)
+	svc.MaterialLimit = controlplane.RateLimit{Rate: 0.001, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.TRC(ctx, connect.NewRequest(&cppb.TRCRequest{Isd: 1})); err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+	}
+	_, err := svc.Chains(ctx, connect.NewRequest(&cppb.ChainsRequest{IsdAs: uint64(coreIA)}))
+	if connect.CodeOf(err) != connect.CodeResourceExhausted {
+		t.Errorf("request over the limit should be rejected, got %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	svc := newService(t, coreIA)
+	srv := httptest.NewServer(controlplane.NewServer(svc).Handler)
+	defer srv.Close()
+
+	clt := controlplane.NewClient(srv.Client(), srv.URL)
+	rep, err := clt.TRC(context.Background(), connect.NewRequest(&cppb.TRCRequest{Isd: 1}))
+	if err != nil {
+		t.Fatalf("TRC failed: %v", err)
+	}
+	if len(rep.Msg.Trc) == 0 {
+		t.Error("expected TRC in response")
+	}
+	_, err = clt.ChainRenewal(context.Background(), connect.NewRequest(&cppb.ChainRenewalRequest{}))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("chain renewal without CA should be unimplemented, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// ServerTLSConfig returns the TLS configuration of the control plane server.
+// The server presents the AS certificate chain of the current signer and
+// requires a client chain that verifies against the active TRCs in the
+// database.
+func ServerTLSConfig(signers trust.SignerGen, db trust.DB) *tls.Config {
+	loader := trust.TLSCertificateLoader{SignerGen: signers}
+	verifier := trust.NewTLSCryptoVerifier(db)
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		GetCertificate:        loader.GetCertificate,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: verifier.VerifyClientCertificate,
+	}
+}
+
+// ClientTLSConfig returns the TLS configuration of control plane clients. The
+// client presents the AS certificate chain of the current signer and requires
+// a server chain that verifies against the active TRCs in the database and
+// belongs to the ISD-AS in the server name.
+func ClientTLSConfig(signers trust.SignerGen, db trust.DB) *tls.Config {
+	loader := trust.TLSCertificateLoader{SignerGen: signers}
+	verifier := trust.NewTLSCryptoVerifier(db)
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS13,
+		GetClientCertificate: loader.GetClientCertificate,
+		// The server chain is verified against the TRCs instead of the
+		// system roots.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifier.VerifyServerCertificate,
+		VerifyConnection:      verifier.VerifyConnection,
+	}
+}
+
+type peerIAKey struct{}
+
+// PeerIA returns the ISD-AS of the authenticated peer of the RPC. It is only
+// available if the client presented a certificate chain, which is the case
+// with ServerTLSConfig.
+func PeerIA(ctx context.Context) (addr.IA, bool) {
+	ia, ok := ctx.Value(peerIAKey{}).(addr.IA)
+	return ia, ok
+}
+
+// checkPeer returns a permission denied error if the RPC comes from an
+// authenticated peer other than the ISD-AS.
+func checkPeer(ctx context.Context, ia addr.IA) error {
+	if peer, ok := PeerIA(ctx); ok && !peer.Equal(ia) {
+		return connect.NewError(connect.CodePermissionDenied,
+			fmt.Errorf("peer %s cannot act for %s", peer, ia))
+	}
+	return nil
+}
+
+// withPeerIA adds the ISD-AS of the verified client certificate to the
+// request context.
+func withPeerIA(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) != 0 {
+			if ia, err := cppki.ExtractIA(r.TLS.PeerCertificates[0].Subject); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), peerIAKey{}, ia))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
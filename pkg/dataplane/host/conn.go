@@ -0,0 +1,208 @@
+// Package host implements the SCION end host stack on top of the internal interface of the
+// router.
+//
+// Conn carries UDP datagrams in SCION packets. Packets to other ASes are sent to the internal
+// interface of the router on the path of the destination address, and packets to the local AS
+// are sent directly to the destination host. The router delivers packets for the local AS to the
+// host and port in the SCION header, so every Conn is reachable on its own underlay address.
+// Conn implements net.PacketConn with snet.UDPAddr addresses, so it can carry QUIC.
+package host
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path/empty"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+)
+
+// Config configures a SCION connection.
+type Config struct {
+	// LocalIA is the ISD-AS of the local AS.
+	LocalIA addr.IA
+	// Router is the underlay address of the internal interface of the router.
+	Router net.Addr
+}
+
+// Conn is a SCION/UDP connection. The underlay connection must be bound to a specific IP
+// address, which is used as the SCION host address.
+type Conn struct {
+	conn  net.PacketConn
+	cfg   Config
+	local *snet.UDPAddr
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewConn creates a SCION connection on the underlay connection.
+func NewConn(conn net.PacketConn, cfg Config) (*Conn, error) {
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unsupported underlay address %s", conn.LocalAddr())
+	}
+	if local.IP.IsUnspecified() {
+		return nil, fmt.Errorf("underlay address %s is not bound to an IP address", local)
+	}
+	return &Conn{
+		conn:  conn,
+		cfg:   cfg,
+		local: &snet.UDPAddr{IA: cfg.LocalIA, Host: local},
+		buf:   make([]byte, 65535),
+	}, nil
+}
+
+// WriteTo sends the datagram to the *snet.UDPAddr on its path. The path may be nil if the
+// destination is in the local AS.
+func (c *Conn) WriteTo(b []byte, a net.Addr) (int, error) {
+	dst, ok := a.(*snet.UDPAddr)
+	if !ok || dst.Host == nil {
+		return 0, fmt.Errorf("unsupported address %s", a)
+	}
+	dp, nextHop := dst.Path, c.cfg.Router
+	if dst.IA.Equal(c.cfg.LocalIA) {
+		dp, nextHop = snetpath.Empty{}, dst.Host
+	}
+	if dp == nil {
+		return 0, fmt.Errorf("no path to %s", dst)
+	}
+
+	s := &slayers.SCION{
+		NextHdr: slayers.L4UDP,
+		SrcIA:   c.cfg.LocalIA,
+		DstIA:   dst.IA,
+	}
+	if err := dp.SetPath(s); err != nil {
+		return 0, fmt.Errorf("setting path: %w", err)
+	}
+	// The raw path is shared with the address and is written to during serialization.
+	if raw, ok := s.Path.(*scion.Raw); ok {
+		raw.Raw = slices.Clone(raw.Raw)
+	}
+	if err := s.SetSrcAddr(addr.HostIP(c.local.Host.AddrPort().Addr().Unmap())); err != nil {
+		return 0, err
+	}
+	if err := s.SetDstAddr(addr.HostIP(dst.Host.AddrPort().Addr().Unmap())); err != nil {
+		return 0, err
+	}
+	udp := &slayers.UDP{SrcPort: uint16(c.local.Host.Port), DstPort: uint16(dst.Host.Port)}
+	udp.SetNetworkLayerForChecksum(s)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, s, udp, gopacket.Payload(b)); err != nil {
+		return 0, fmt.Errorf("serializing packet: %w", err)
+	}
+	if _, err := c.conn.WriteTo(buf.Bytes(), nextHop); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom reads a datagram. The returned *snet.UDPAddr contains the reversed path, so it can be
+// used to reply. Packets that are not valid SCION/UDP packets are dropped.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		n, from, err := c.conn.ReadFrom(c.buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		var s slayers.SCION
+		var udp slayers.UDP
+		if err := s.DecodeFromBytes(c.buf[:n], gopacket.NilDecodeFeedback); err != nil {
+			continue
+		}
+		if s.NextHdr != slayers.L4UDP {
+			continue
+		}
+		if err := udp.DecodeFromBytes(s.Payload, gopacket.NilDecodeFeedback); err != nil {
+			continue
+		}
+		src, err := s.SrcAddr()
+		if err != nil || src.Type() != addr.HostTypeIP {
+			continue
+		}
+		rp, err := replyPath(&s)
+		if err != nil {
+			continue
+		}
+		nextHop, _ := from.(*net.UDPAddr)
+		return copy(b, udp.Payload), &snet.UDPAddr{
+			IA:      s.SrcIA,
+			Path:    rp,
+			NextHop: nextHop,
+			Host:    &net.UDPAddr{IP: src.IP().AsSlice(), Port: int(udp.SrcPort)},
+		}, nil
+	}
+}
+
+// replyPath returns the reversed path of the packet.
+func replyPath(s *slayers.SCION) (snet.DataplanePath, error) {
+	// The path refers to the read buffer, so it is decoded from a copy.
+	raw := make([]byte, s.Path.Len())
+	if err := s.Path.SerializeTo(raw); err != nil {
+		return nil, err
+	}
+	var rev *scion.Decoded
+	switch s.PathType {
+	case empty.PathType:
+		return snetpath.Empty{}, nil
+	case scion.PathType:
+		rev = &scion.Decoded{}
+		if err := rev.DecodeFromBytes(raw); err != nil {
+			return nil, err
+		}
+		if _, err := rev.Reverse(); err != nil {
+			return nil, err
+		}
+	case onehop.PathType:
+		var ohp onehop.Path
+		if err := ohp.DecodeFromBytes(raw); err != nil {
+			return nil, err
+		}
+		p, err := ohp.Reverse()
+		if err != nil {
+			return nil, err
+		}
+		rev = p.(*scion.Decoded)
+	default:
+		return nil, fmt.Errorf("unsupported path type %s", s.PathType)
+	}
+	return snetpath.NewSCIONFromDecoded(*rev)
+}
+
+// LocalAddr returns the SCION address of the connection.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// Close closes the underlay connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetDeadline sets the read and write deadlines of the underlay connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlay connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlay connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
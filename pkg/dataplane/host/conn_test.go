@@ -0,0 +1,84 @@
+package host_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+
+	"github.com/fancl20/cion/pkg/dataplane/host"
+)
+
+var localIA = addr.MustParseIA("1-ff00:0:110")
+
+func newConn(t *testing.T, router net.Addr) *host.Conn {
+	t.Helper()
+	underlay, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := host.NewConn(underlay, host.Config{LocalIA: localIA, Router: router})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func read(t *testing.T, conn *host.Conn) (string, *snet.UDPAddr) {
+	t.Helper()
+	buf := make([]byte, 1500)
+	n, from, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n]), from.(*snet.UDPAddr)
+}
+
+func TestConnLocal(t *testing.T) {
+	a, b := newConn(t, nil), newConn(t, nil)
+
+	if _, err := a.WriteTo([]byte("ping"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	msg, from := read(t, b)
+	if msg != "ping" {
+		t.Errorf("received %q, want ping", msg)
+	}
+	if from.String() != a.LocalAddr().String() {
+		t.Errorf("received from %s, want %s", from, a.LocalAddr())
+	}
+
+	// The reply uses the returned address.
+	if _, err := b.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := read(t, a); msg != "pong" {
+		t.Errorf("received %q, want pong", msg)
+	}
+}
+
+func TestConnNoPath(t *testing.T) {
+	a := newConn(t, nil)
+	remote := &snet.UDPAddr{
+		IA:   addr.MustParseIA("1-ff00:0:111"),
+		Host: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 30041},
+	}
+	if _, err := a.WriteTo([]byte("ping"), remote); err == nil {
+		t.Error("WriteTo should fail without a path")
+	}
+}
+
+func TestNewConnUnspecified(t *testing.T) {
+	underlay, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer underlay.Close()
+	if _, err := host.NewConn(underlay, host.Config{LocalIA: localIA}); err == nil {
+		t.Error("NewConn should fail on an unspecified address")
+	}
+}
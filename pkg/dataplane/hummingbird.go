@@ -0,0 +1,223 @@
+package dataplane
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+
+	"github.com/fancl20/cion/pkg/dataplane/hummingbird"
+)
+
+var (
+	// FlyoverMaxSkew is the maximum difference between the send time of a packet on a
+	// reservation and the local time.
+	FlyoverMaxSkew = time.Second
+	// ReservationBurst is the burst allowed on a reservation, expressed as the time the
+	// reservation needs to transmit it at the reserved bandwidth.
+	ReservationBurst = 10 * time.Millisecond
+)
+
+func init() {
+	hummingbird.RegisterPath()
+}
+
+func (r *Router) processHummingbird(s *slayers.SCION, data []byte, recvID uint16) error {
+	rawPath, ok := s.Path.(*hummingbird.Raw)
+	if !ok {
+		return fmt.Errorf("failed to cast path to hummingbird.Raw")
+	}
+
+	info, err := rawPath.GetCurrentInfoField()
+	if err != nil {
+		return fmt.Errorf("failed to get info field: %w", err)
+	}
+
+	hop, err := rawPath.GetCurrentHopField()
+	if err != nil {
+		return fmt.Errorf("failed to get hop field: %w", err)
+	}
+
+	var ingressID, egressID uint16
+	if info.ConsDir {
+		ingressID = hop.HopField.ConsIngress
+		egressID = hop.HopField.ConsEgress
+	} else {
+		ingressID = hop.HopField.ConsEgress
+		egressID = hop.HopField.ConsIngress
+	}
+	if recvID != ingressID {
+		return fmt.Errorf("packet received on wrong interface: %d (expected ingress %d)", recvID, ingressID)
+	}
+
+	inIface := r.Interfaces[recvID]
+	// Packets from the internal interface originate in the local AS, which owns the first hop
+	// of the path.
+	local := recvID == InternalInterface
+	if local {
+		if !rawPath.IsFirstHop() || !s.SrcIA.Equal(inIface.IA) {
+			return fmt.Errorf("packet from the local AS not at the first hop of %s", s.SrcIA)
+		}
+	} else {
+		if err := validateIngressLink(inIface.LinkType, info.ConsDir); err != nil {
+			return fmt.Errorf("invalid ingress on interface %d: %w", recvID, err)
+		}
+		if rawPath.IsSecondHop() && !s.SrcIA.Equal(inIface.IA) {
+			return fmt.Errorf("source IA %s does not match neighbour IA %s on interface %d",
+				s.SrcIA, inIface.IA, recvID)
+		}
+	}
+
+	now := r.now()
+	expSeconds := (uint32(hop.HopField.ExpTime) + 1) * (24 * 60 * 60 / 256)
+	if now.After(time.Unix(int64(info.Timestamp)+int64(expSeconds), 0)) {
+		return fmt.Errorf("hop expired")
+	}
+
+	// Remove the flyover MAC from the aggregate to get the hop field MAC. An invalid flyover
+	// MAC results in an invalid hop field MAC, so the packet is dropped below.
+	meta := rawPath.PathMeta
+	hopMAC := hop.HopField.Mac
+	if hop.Flyover {
+		ak := hummingbird.AuthKey(hmac.New(sha256.New, r.Key), hop, meta.BaseTS)
+		flyoverMAC := hummingbird.FlyoverMAC(hmac.New(sha256.New, ak[:]), s.DstIA, s.PayloadLen,
+			meta.BaseTS, meta.HighResTS)
+		hopMAC = hummingbird.AggregateMAC(hopMAC, flyoverMAC)
+	}
+
+	// Locally originated packets already carry the SegID of the first hop.
+	if !info.ConsDir && !local {
+		info.UpdateSegID(hopMAC)
+	}
+	calcMAC := path.MAC(hmac.New(sha256.New, r.Key), info, hop.HopField, nil)
+	if !bytes.Equal(calcMAC[:], hopMAC[:]) {
+		return fmt.Errorf("MAC mismatch (Ingress)")
+	}
+
+	egIface, ok := r.Interfaces[egressID]
+	if !ok {
+		return fmt.Errorf("egress interface %d not found", egressID)
+	}
+	if egressID == InternalInterface {
+		// The packet is delivered to the local AS, which owns the last hop of the path.
+		if local || !rawPath.IsLastHop() || !s.DstIA.Equal(egIface.IA) {
+			return fmt.Errorf("packet to the local AS not at the last hop of %s", s.DstIA)
+		}
+		if err := rawPath.SetInfoField(info, int(meta.CurrINF)); err != nil {
+			return fmt.Errorf("failed to update info field: %w", err)
+		}
+	} else {
+		if !local {
+			if err := validateTransit(inIface.LinkType, egIface.LinkType); err != nil {
+				return fmt.Errorf("invalid transit from interface %d to %d: %w",
+					recvID, egressID, err)
+			}
+		}
+		if info.ConsDir {
+			info.UpdateSegID(hopMAC)
+		}
+		if err := rawPath.SetInfoField(info, int(meta.CurrINF)); err != nil {
+			return fmt.Errorf("failed to update info field: %w", err)
+		}
+		if err := rawPath.IncPath(); err != nil {
+			return fmt.Errorf("failed to increment path: %w", err)
+		}
+		if rawPath.IsLastHop() && !s.DstIA.Equal(egIface.IA) {
+			return fmt.Errorf("destination IA %s does not match neighbour IA %s on interface %d",
+				s.DstIA, egIface.IA, egressID)
+		}
+	}
+
+	// Packets outside of their reservation fall back to best-effort, also when they are
+	// delivered to the local AS.
+	class := classify(s, r.ControlPort)
+	if hop.Flyover && r.reservations.allow(hop, meta, len(data), now) {
+		class = ClassReserved
+	}
+	if !egIface.queue.enqueue(data, class) {
+		return fmt.Errorf("egress queue of interface %d full", egressID)
+	}
+	return nil
+}
+
+type reservationKey struct {
+	ingress, egress uint16
+	resID           uint32
+}
+
+type tokenBucket struct {
+	// tokens is the number of bits that can be sent.
+	tokens float64
+	last   time.Time
+	end    time.Time
+}
+
+// policer enforces the bandwidth of the reservations with a token bucket per reservation.
+type policer struct {
+	mu        sync.Mutex
+	buckets   map[reservationKey]*tokenBucket
+	nextSweep time.Time
+}
+
+func newPolicer() *policer {
+	return &policer{buckets: make(map[reservationKey]*tokenBucket)}
+}
+
+// allow reports whether a packet of the given size is within its reservation. The reservation
+// must be active and the packet must be recent and within the reserved bandwidth.
+func (p *policer) allow(hop hummingbird.FlyoverHopField, meta hummingbird.MetaHdr,
+	size int, now time.Time) bool {
+
+	start := time.Unix(int64(meta.BaseTS)+int64(hop.ResStartOffset), 0)
+	end := start.Add(time.Duration(hop.Duration) * time.Second)
+	if now.Before(start) || now.After(end) {
+		return false
+	}
+	sent := time.Unix(int64(meta.BaseTS), 0).Add(time.Duration(meta.HighResTS) * time.Millisecond)
+	if d := now.Sub(sent); d > FlyoverMaxSkew || d < -FlyoverMaxSkew {
+		return false
+	}
+
+	rate := float64(hop.Bw) * hummingbird.BwUnit
+	burst := max(rate*ReservationBurst.Seconds(), float64(size*8))
+	key := reservationKey{
+		ingress: hop.HopField.ConsIngress,
+		egress:  hop.HopField.ConsEgress,
+		resID:   hop.ResID,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sweep(now)
+	b, ok := p.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		p.buckets[key] = b
+	}
+	b.end = end
+	b.tokens = min(burst, b.tokens+rate*now.Sub(b.last).Seconds())
+	b.last = now
+	if b.tokens < float64(size*8) {
+		return false
+	}
+	b.tokens -= float64(size * 8)
+	return true
+}
+
+// sweep removes the buckets of expired reservations. p.mu must be held.
+func (p *policer) sweep(now time.Time) {
+	if now.Before(p.nextSweep) {
+		return
+	}
+	for k, b := range p.buckets {
+		if now.After(b.end) {
+			delete(p.buckets, k)
+		}
+	}
+	p.nextSweep = now.Add(time.Minute)
+}
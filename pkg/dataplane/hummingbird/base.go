@@ -0,0 +1,162 @@
+// Package hummingbird implements the Hummingbird path type. It extends the SCION path type with
+// flyover hop fields that carry a bandwidth reservation.
+//
+// The path starts with the meta header, followed by up to three info fields and the hop fields.
+// Standard hop fields are 12 bytes long, flyover hop fields are 20 bytes long. Positions in the
+// hop field area are counted in 4-byte lines.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	| C |    CurrHF     |R|   Seg0Len   |   Seg1Len   |   Seg2Len   |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                            BaseTS                             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                           HighResTS                           |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// BaseTS is the reference time in seconds for the reservations on the path and HighResTS is the
+// time the packet was sent, in milliseconds relative to BaseTS.
+package hummingbird
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/slayers/path"
+)
+
+const (
+	// PathType is the path type of Hummingbird paths.
+	PathType path.Type = 5
+	// MetaLen is the length of the meta header in bytes.
+	MetaLen = 12
+	// LineLen is the unit of hop field positions and segment lengths in bytes.
+	LineLen = 4
+	// HopLines is the length of a standard hop field in lines.
+	HopLines = path.HopLen / LineLen
+	// FlyoverLen is the length of a flyover hop field in bytes.
+	FlyoverLen = 20
+	// FlyoverLines is the length of a flyover hop field in lines.
+	FlyoverLines = FlyoverLen / LineLen
+	// MaxINFs is the maximum number of info fields.
+	MaxINFs = 3
+	// MaxSegLen is the maximum length of a segment in lines.
+	MaxSegLen = 0x7F
+)
+
+// RegisterPath registers the Hummingbird path type so that it is decoded into a Raw path.
+func RegisterPath() {
+	path.RegisterPath(path.Metadata{
+		Type: PathType,
+		Desc: "Hummingbird",
+		New: func() path.Path {
+			return &Raw{}
+		},
+	})
+}
+
+// MetaHdr is the meta header of a Hummingbird path.
+type MetaHdr struct {
+	CurrINF uint8
+	// CurrHF is the position of the current hop field in lines.
+	CurrHF uint8
+	// SegLen is the length of each segment in lines.
+	SegLen    [3]uint8
+	BaseTS    uint32
+	HighResTS uint32
+}
+
+// DecodeFromBytes populates the fields from a raw buffer. The buffer must be of length >=
+// MetaLen.
+func (m *MetaHdr) DecodeFromBytes(raw []byte) error {
+	if len(raw) < MetaLen {
+		return serrors.New("MetaHdr raw too short", "expected", MetaLen, "actual", len(raw))
+	}
+	line := binary.BigEndian.Uint32(raw)
+	m.CurrINF = uint8(line >> 30)
+	m.CurrHF = uint8(line >> 22)
+	m.SegLen[0] = uint8(line>>14) & MaxSegLen
+	m.SegLen[1] = uint8(line>>7) & MaxSegLen
+	m.SegLen[2] = uint8(line) & MaxSegLen
+	m.BaseTS = binary.BigEndian.Uint32(raw[4:8])
+	m.HighResTS = binary.BigEndian.Uint32(raw[8:12])
+	return nil
+}
+
+// SerializeTo writes the fields into the provided buffer. The buffer must be of length >=
+// MetaLen.
+func (m *MetaHdr) SerializeTo(b []byte) error {
+	if len(b) < MetaLen {
+		return serrors.New("buffer for MetaHdr too short", "expected", MetaLen, "actual", len(b))
+	}
+	line := uint32(m.CurrINF)<<30 | uint32(m.CurrHF)<<22
+	line |= uint32(m.SegLen[0]&MaxSegLen) << 14
+	line |= uint32(m.SegLen[1]&MaxSegLen) << 7
+	line |= uint32(m.SegLen[2] & MaxSegLen)
+	binary.BigEndian.PutUint32(b, line)
+	binary.BigEndian.PutUint32(b[4:8], m.BaseTS)
+	binary.BigEndian.PutUint32(b[8:12], m.HighResTS)
+	return nil
+}
+
+func (m MetaHdr) String() string {
+	return fmt.Sprintf("{CurrInf: %d, CurrHF: %d, SegLen: %v, BaseTS: %d, HighResTS: %d}",
+		m.CurrINF, m.CurrHF, m.SegLen, m.BaseTS, m.HighResTS)
+}
+
+// Base holds the basic information that is used by both raw and fully decoded paths.
+type Base struct {
+	// PathMeta is the Hummingbird path meta header.
+	PathMeta MetaHdr
+	// NumINF is the number of info fields in the path.
+	NumINF int
+	// NumLines is the length of all hop fields in lines.
+	NumLines int
+}
+
+// DecodeFromBytes decodes the meta header and derives the number of info fields and lines.
+func (s *Base) DecodeFromBytes(data []byte) error {
+	if err := s.PathMeta.DecodeFromBytes(data); err != nil {
+		return err
+	}
+	s.NumINF = 0
+	s.NumLines = 0
+	for i := 2; i >= 0; i-- {
+		if s.PathMeta.SegLen[i] == 0 && s.NumINF > 0 {
+			return serrors.New(
+				fmt.Sprintf("Meta.SegLen[%d] == 0, but Meta.SegLen[%d] > 0", i, s.NumINF-1))
+		}
+		if s.PathMeta.SegLen[i] > 0 && s.NumINF == 0 {
+			s.NumINF = i + 1
+		}
+		s.NumLines += int(s.PathMeta.SegLen[i])
+	}
+	if int(s.PathMeta.CurrINF) >= max(s.NumINF, 1) {
+		return serrors.New("CurrINF out of range",
+			"curr_inf", s.PathMeta.CurrINF, "num_inf", s.NumINF)
+	}
+	return nil
+}
+
+// Len returns the length of the path in bytes.
+func (s *Base) Len() int {
+	return MetaLen + s.NumINF*path.InfoLen + s.NumLines*LineLen
+}
+
+// Type returns the type of the path.
+func (s *Base) Type() path.Type {
+	return PathType
+}
+
+func (s *Base) infIndexForHF(hf uint8) uint8 {
+	switch {
+	case int(hf) < int(s.PathMeta.SegLen[0]):
+		return 0
+	case int(hf) < int(s.PathMeta.SegLen[0])+int(s.PathMeta.SegLen[1]):
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,78 @@
+package hummingbird
+
+import (
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/slayers/path"
+)
+
+// Decoded implements the Hummingbird path type with all fields decoded. It is used by end hosts
+// to build paths.
+type Decoded struct {
+	Base
+	// InfoFields contains all the info fields of the path.
+	InfoFields []path.InfoField
+	// HopFields contains all the hop fields of the path.
+	HopFields []FlyoverHopField
+}
+
+// DecodeFromBytes fully decodes the Hummingbird path into the corresponding fields.
+func (s *Decoded) DecodeFromBytes(data []byte) error {
+	if err := s.Base.DecodeFromBytes(data); err != nil {
+		return err
+	}
+	if minLen := s.Len(); len(data) < minLen {
+		return serrors.New("DecodedPath raw too short", "expected", minLen, "actual", len(data))
+	}
+
+	offset := MetaLen
+	s.InfoFields = make([]path.InfoField, s.NumINF)
+	for i := range s.InfoFields {
+		if err := s.InfoFields[i].DecodeFromBytes(data[offset : offset+path.InfoLen]); err != nil {
+			return err
+		}
+		offset += path.InfoLen
+	}
+	s.HopFields = s.HopFields[:0]
+	end := offset + s.NumLines*LineLen
+	for offset < end {
+		var hop FlyoverHopField
+		if err := hop.DecodeFromBytes(data[offset:end]); err != nil {
+			return err
+		}
+		s.HopFields = append(s.HopFields, hop)
+		offset += hop.Lines() * LineLen
+	}
+	return nil
+}
+
+// SerializeTo writes the path to a slice. The slice must be big enough to hold the entire data,
+// otherwise an error is returned.
+func (s *Decoded) SerializeTo(b []byte) error {
+	if len(b) < s.Len() {
+		return serrors.New("buffer too small to serialize path.", "expected", s.Len(),
+			"actual", len(b))
+	}
+	if err := s.PathMeta.SerializeTo(b[:MetaLen]); err != nil {
+		return err
+	}
+	offset := MetaLen
+	for _, info := range s.InfoFields {
+		if err := info.SerializeTo(b[offset : offset+path.InfoLen]); err != nil {
+			return err
+		}
+		offset += path.InfoLen
+	}
+	for _, hop := range s.HopFields {
+		if err := hop.SerializeTo(b[offset:]); err != nil {
+			return err
+		}
+		offset += hop.Lines() * LineLen
+	}
+	return nil
+}
+
+// Reverse is not supported. Reservations are unidirectional, so the reverse path has to be
+// built from the segments.
+func (s *Decoded) Reverse() (path.Path, error) {
+	return nil, serrors.New("reversing Hummingbird path not supported")
+}
@@ -0,0 +1,106 @@
+package hummingbird
+
+import (
+	"encoding/binary"
+
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/slayers/path"
+)
+
+const (
+	flyoverFlag = 0x80
+	// MaxResID is the largest reservation ID that fits into a flyover hop field.
+	MaxResID = 1<<22 - 1
+	// MaxBw is the largest bandwidth value that fits into a flyover hop field.
+	MaxBw = 1<<10 - 1
+)
+
+// FlyoverHopField is a hop field that optionally carries a reservation. For flyover hop fields
+// the MAC is the aggregate of the hop field MAC and the flyover MAC.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|F|r r r r r|I|E|    ExpTime    |           ConsIngress         |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|        ConsEgress             |                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               +
+//	|                              MAC                              |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                  ResID                    |        Bw         |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|        ResStartOffset         |           Duration            |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// The last two lines are only present if the flyover flag F is set.
+type FlyoverHopField struct {
+	// Flyover indicates that the hop field carries a reservation.
+	Flyover  bool
+	HopField path.HopField
+	// ResID identifies the reservation on the interface pair.
+	ResID uint32
+	// Bw is the reserved bandwidth in units of BwUnit.
+	Bw uint16
+	// ResStartOffset is the start of the reservation in seconds relative to BaseTS.
+	ResStartOffset uint16
+	// Duration is the duration of the reservation in seconds.
+	Duration uint16
+}
+
+// Lines returns the length of the hop field in lines.
+func (h *FlyoverHopField) Lines() int {
+	if h.Flyover {
+		return FlyoverLines
+	}
+	return HopLines
+}
+
+// DecodeFromBytes populates the fields from a raw buffer. The buffer must be long enough to
+// contain the hop field as indicated by the flyover flag.
+func (h *FlyoverHopField) DecodeFromBytes(raw []byte) error {
+	if len(raw) < path.HopLen {
+		return serrors.New("FlyoverHopField raw too short",
+			"expected", path.HopLen, "actual", len(raw))
+	}
+	if err := h.HopField.DecodeFromBytes(raw); err != nil {
+		return err
+	}
+	h.Flyover = raw[0]&flyoverFlag != 0
+	if !h.Flyover {
+		h.ResID, h.Bw, h.ResStartOffset, h.Duration = 0, 0, 0, 0
+		return nil
+	}
+	if len(raw) < FlyoverLen {
+		return serrors.New("FlyoverHopField raw too short",
+			"expected", FlyoverLen, "actual", len(raw))
+	}
+	res := binary.BigEndian.Uint32(raw[12:16])
+	h.ResID = res >> 10
+	h.Bw = uint16(res & MaxBw)
+	h.ResStartOffset = binary.BigEndian.Uint16(raw[16:18])
+	h.Duration = binary.BigEndian.Uint16(raw[18:20])
+	return nil
+}
+
+// SerializeTo writes the fields into the provided buffer. The buffer must be long enough to
+// contain the hop field as indicated by the flyover flag.
+func (h *FlyoverHopField) SerializeTo(b []byte) error {
+	if len(b) < h.Lines()*LineLen {
+		return serrors.New("buffer for FlyoverHopField too short",
+			"expected", h.Lines()*LineLen, "actual", len(b))
+	}
+	if err := h.HopField.SerializeTo(b); err != nil {
+		return err
+	}
+	if !h.Flyover {
+		return nil
+	}
+	if h.ResID > MaxResID || h.Bw > MaxBw {
+		return serrors.New("reservation out of range", "res_id", h.ResID, "bw", h.Bw)
+	}
+	b[0] |= flyoverFlag
+	binary.BigEndian.PutUint32(b[12:16], h.ResID<<10|uint32(h.Bw))
+	binary.BigEndian.PutUint16(b[16:18], h.ResStartOffset)
+	binary.BigEndian.PutUint16(b[18:20], h.Duration)
+	return nil
+}
@@ -0,0 +1,117 @@
+package hummingbird_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/scionproto/scion/pkg/slayers/path"
+
+	"github.com/fancl20/cion/pkg/dataplane/hummingbird"
+)
+
+func testPath() *hummingbird.Decoded {
+	hops := []hummingbird.FlyoverHopField{
+		{HopField: path.HopField{ExpTime: 63, ConsEgress: 1, Mac: [6]byte{1, 2, 3, 4, 5, 6}}},
+		{
+			Flyover:        true,
+			HopField:       path.HopField{ExpTime: 63, ConsIngress: 2, ConsEgress: 3},
+			ResID:          hummingbird.MaxResID,
+			Bw:             hummingbird.MaxBw,
+			ResStartOffset: 10,
+			Duration:       3600,
+		},
+		{HopField: path.HopField{ExpTime: 63, ConsIngress: 4}},
+		{
+			Flyover:  true,
+			HopField: path.HopField{ExpTime: 63, ConsEgress: 5},
+			ResID:    7,
+			Bw:       1,
+			Duration: 60,
+		},
+		{HopField: path.HopField{ExpTime: 63, ConsIngress: 6}},
+	}
+	return &hummingbird.Decoded{
+		Base: hummingbird.Base{
+			PathMeta: hummingbird.MetaHdr{
+				SegLen:    [3]uint8{11, 8, 0},
+				BaseTS:    1700000000,
+				HighResTS: 1234,
+			},
+			NumINF:   2,
+			NumLines: 19,
+		},
+		InfoFields: []path.InfoField{
+			{ConsDir: true, SegID: 1, Timestamp: 1700000000},
+			{ConsDir: false, SegID: 2, Timestamp: 1700000001},
+		},
+		HopFields: hops,
+	}
+}
+
+func TestDecodedRoundTrip(t *testing.T) {
+	want := testPath()
+	raw := make([]byte, want.Len())
+	if err := want.SerializeTo(raw); err != nil {
+		t.Fatalf("SerializeTo failed: %v", err)
+	}
+	got := &hummingbird.Decoded{}
+	if err := got.DecodeFromBytes(raw); err != nil {
+		t.Fatalf("DecodeFromBytes failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRawIncPath(t *testing.T) {
+	dec := testPath()
+	buf := make([]byte, dec.Len())
+	if err := dec.SerializeTo(buf); err != nil {
+		t.Fatalf("SerializeTo failed: %v", err)
+	}
+	raw := &hummingbird.Raw{}
+	if err := raw.DecodeFromBytes(buf); err != nil {
+		t.Fatalf("DecodeFromBytes failed: %v", err)
+	}
+
+	for i, want := range dec.HopFields {
+		hop, err := raw.GetCurrentHopField()
+		if err != nil {
+			t.Fatalf("hop %d: GetCurrentHopField failed: %v", i, err)
+		}
+		if diff := cmp.Diff(want, hop); diff != "" {
+			t.Errorf("hop %d mismatch (-want +got):\n%s", i, diff)
+		}
+		wantINF := 0
+		if i >= 3 {
+			wantINF = 1
+		}
+		if int(raw.PathMeta.CurrINF) != wantINF {
+			t.Errorf("hop %d: CurrINF %d, want %d", i, raw.PathMeta.CurrINF, wantINF)
+		}
+		if raw.IsSecondHop() != (i == 1) {
+			t.Errorf("hop %d: IsSecondHop %v", i, raw.IsSecondHop())
+		}
+		if raw.IsLastHop() != (i == len(dec.HopFields)-1) {
+			t.Errorf("hop %d: IsLastHop %v", i, raw.IsLastHop())
+		}
+		if i == len(dec.HopFields)-1 {
+			if err := raw.IncPath(); err == nil {
+				t.Error("IncPath should fail at the end of the path")
+			}
+			break
+		}
+		if err := raw.IncPath(); err != nil {
+			t.Fatalf("hop %d: IncPath failed: %v", i, err)
+		}
+	}
+
+	// The meta header changes are written back into the buffer.
+	var meta hummingbird.MetaHdr
+	if err := meta.DecodeFromBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	if meta.CurrHF != 16 || meta.CurrINF != 1 {
+		t.Errorf("serialized meta header not updated: %s", meta)
+	}
+}
@@ -0,0 +1,64 @@
+package hummingbird
+
+import (
+	"encoding/binary"
+	"hash"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers/path"
+)
+
+const (
+	// AuthKeyLen is the length of the reservation authentication key.
+	AuthKeyLen = 16
+	// BwUnit is the unit of the reserved bandwidth in bits per second.
+	BwUnit = 1_000_000
+)
+
+// AuthKey derives the authentication key of a reservation. The hash must be keyed with the
+// secret of the AS that grants the reservation. The key is handed to the source of the
+// reservation, which uses it to compute the flyover MAC of every packet.
+func AuthKey(h hash.Hash, hop FlyoverHopField, baseTS uint32) [AuthKeyLen]byte {
+	var buf [20]byte
+	binary.BigEndian.PutUint16(buf[0:2], hop.HopField.ConsIngress)
+	binary.BigEndian.PutUint16(buf[2:4], hop.HopField.ConsEgress)
+	binary.BigEndian.PutUint32(buf[4:8], hop.ResID)
+	binary.BigEndian.PutUint16(buf[8:10], hop.Bw)
+	binary.BigEndian.PutUint32(buf[10:14], baseTS+uint32(hop.ResStartOffset))
+	binary.BigEndian.PutUint16(buf[14:16], hop.Duration)
+
+	h.Reset()
+	h.Write(buf[:])
+	var key [AuthKeyLen]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// FlyoverMAC computes the per-packet flyover MAC. The hash must be keyed with the
+// authentication key of the reservation. The flyover MAC is aggregated with the hop field MAC by
+// XOR.
+func FlyoverMAC(h hash.Hash, dst addr.IA, pktLen uint16,
+	baseTS, highResTS uint32) [path.MacLen]byte {
+
+	var buf [18]byte
+	binary.BigEndian.PutUint64(buf[0:8], uint64(dst))
+	binary.BigEndian.PutUint16(buf[8:10], pktLen)
+	binary.BigEndian.PutUint32(buf[10:14], baseTS)
+	binary.BigEndian.PutUint32(buf[14:18], highResTS)
+
+	h.Reset()
+	h.Write(buf[:])
+	var mac [path.MacLen]byte
+	copy(mac[:], h.Sum(nil))
+	return mac
+}
+
+// AggregateMAC combines the hop field MAC and the flyover MAC. Applying it twice with the same
+// flyover MAC returns the original MAC.
+func AggregateMAC(mac, flyover [path.MacLen]byte) [path.MacLen]byte {
+	var agg [path.MacLen]byte
+	for i := range agg {
+		agg[i] = mac[i] ^ flyover[i]
+	}
+	return agg
+}
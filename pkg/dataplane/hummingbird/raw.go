@@ -0,0 +1,147 @@
+package hummingbird
+
+import (
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/slayers/path"
+)
+
+// Raw is a raw representation of the Hummingbird path type. It is designed to parse as little as
+// possible and should be used if performance matters.
+type Raw struct {
+	Base
+	Raw []byte
+}
+
+// DecodeFromBytes only decodes the meta header. Otherwise, the raw path is kept.
+func (s *Raw) DecodeFromBytes(data []byte) error {
+	if err := s.Base.DecodeFromBytes(data); err != nil {
+		return err
+	}
+	pathLen := s.Len()
+	if len(data) < pathLen {
+		return serrors.New("RawPath raw too short", "expected", pathLen, "actual", len(data))
+	}
+	s.Raw = data[:pathLen]
+	return nil
+}
+
+// SerializeTo writes the path to a slice. The slice must be big enough to hold the entire data,
+// otherwise an error is returned.
+func (s *Raw) SerializeTo(b []byte) error {
+	if s.Raw == nil {
+		return serrors.New("raw is nil")
+	}
+	if len(b) < s.Len() {
+		return serrors.New("buffer too small", "expected", s.Len(), "actual", len(b))
+	}
+	// XXX(roosd): This modifies the underlying buffer. Consider writing to data
+	// directly.
+	if err := s.PathMeta.SerializeTo(s.Raw[:MetaLen]); err != nil {
+		return err
+	}
+	copy(b, s.Raw)
+	return nil
+}
+
+// Reverse is not supported. Reservations are unidirectional, so the reverse path has to be
+// built from the segments.
+func (s *Raw) Reverse() (path.Path, error) {
+	return nil, serrors.New("reversing Hummingbird path not supported")
+}
+
+// GetInfoField returns the info field at the given index.
+func (s *Raw) GetInfoField(idx int) (path.InfoField, error) {
+	if idx >= s.NumINF {
+		return path.InfoField{}, serrors.New("InfoField index out of bounds",
+			"max", s.NumINF-1, "actual", idx)
+	}
+	infOffset := MetaLen + idx*path.InfoLen
+	var info path.InfoField
+	if err := info.DecodeFromBytes(s.Raw[infOffset : infOffset+path.InfoLen]); err != nil {
+		return path.InfoField{}, err
+	}
+	return info, nil
+}
+
+// GetCurrentInfoField is a convenience method that returns the current info field pointed to by
+// the CurrINF index in the path meta header.
+func (s *Raw) GetCurrentInfoField() (path.InfoField, error) {
+	return s.GetInfoField(int(s.PathMeta.CurrINF))
+}
+
+// SetInfoField updates the info field at the given index.
+func (s *Raw) SetInfoField(info path.InfoField, idx int) error {
+	if idx >= s.NumINF {
+		return serrors.New("InfoField index out of bounds",
+			"max", s.NumINF-1, "actual", idx)
+	}
+	infOffset := MetaLen + idx*path.InfoLen
+	return info.SerializeTo(s.Raw[infOffset : infOffset+path.InfoLen])
+}
+
+// GetHopField returns the hop field starting at the given line.
+func (s *Raw) GetHopField(line int) (FlyoverHopField, error) {
+	if line >= s.NumLines {
+		return FlyoverHopField{}, serrors.New("HopField index out of bounds",
+			"max", s.NumLines-1, "actual", line)
+	}
+	hopOffset := s.hopOffset(line)
+	var hop FlyoverHopField
+	if err := hop.DecodeFromBytes(s.Raw[hopOffset:]); err != nil {
+		return FlyoverHopField{}, err
+	}
+	if line+hop.Lines() > s.NumLines {
+		return FlyoverHopField{}, serrors.New("HopField exceeds path",
+			"line", line, "num_lines", s.NumLines)
+	}
+	return hop, nil
+}
+
+// GetCurrentHopField is a convenience method that returns the current hop field pointed to by
+// the CurrHF index in the path meta header.
+func (s *Raw) GetCurrentHopField() (FlyoverHopField, error) {
+	return s.GetHopField(int(s.PathMeta.CurrHF))
+}
+
+// IncPath moves CurrHF to the next hop field and updates CurrINF if appropriate.
+func (s *Raw) IncPath() error {
+	hop, err := s.GetCurrentHopField()
+	if err != nil {
+		return err
+	}
+	next := int(s.PathMeta.CurrHF) + hop.Lines()
+	if next >= s.NumLines {
+		return serrors.New("path already at end",
+			"curr_hf", s.PathMeta.CurrHF, "num_lines", s.NumLines)
+	}
+	s.PathMeta.CurrHF = uint8(next)
+	s.PathMeta.CurrINF = s.infIndexForHF(s.PathMeta.CurrHF)
+	return s.PathMeta.SerializeTo(s.Raw[:MetaLen])
+}
+
+// IsFirstHop returns whether the current hop is the first hop on the path.
+func (s *Raw) IsFirstHop() bool {
+	return s.PathMeta.CurrHF == 0
+}
+
+// IsSecondHop returns whether the current hop directly follows the hop of the source AS.
+func (s *Raw) IsSecondHop() bool {
+	if s.PathMeta.CurrHF == 0 {
+		return false
+	}
+	first := FlyoverHopField{Flyover: s.Raw[s.hopOffset(0)]&flyoverFlag != 0}
+	return int(s.PathMeta.CurrHF) == first.Lines()
+}
+
+// IsLastHop returns whether the current hop is the last hop on the path.
+func (s *Raw) IsLastHop() bool {
+	hop, err := s.GetCurrentHopField()
+	if err != nil {
+		return false
+	}
+	return int(s.PathMeta.CurrHF)+hop.Lines() == s.NumLines
+}
+
+func (s *Raw) hopOffset(line int) int {
+	return MetaLen + s.NumINF*path.InfoLen + line*LineLen
+}
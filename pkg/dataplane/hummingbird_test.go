@@ -0,0 +1,223 @@
+package dataplane
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+
+	"github.com/fancl20/cion/pkg/dataplane/hummingbird"
+)
+
+// newHummingbirdPacket returns a serialized packet over a single down segment of three hops,
+// as it arrives at the AS owning the middle hop. The middle hop carries the given reservation
+// unless it is nil.
+func newHummingbirdPacket(t testing.TB, res *hummingbird.FlyoverHopField, payload []byte) []byte {
+	return newHummingbirdPathPacket(t, srcIA, dstIA, 1, res, payload)
+}
+
+// newHummingbirdPathPacket returns a serialized packet from src to dst over a single down segment
+// of three hops, as it arrives at the AS owning the hop at index cur. That hop carries the given
+// reservation unless it is nil.
+func newHummingbirdPathPacket(t testing.TB, src, dst addr.IA, cur int,
+	res *hummingbird.FlyoverHopField, payload []byte) []byte {
+
+	t.Helper()
+
+	now := time.Now()
+	baseTS := uint32(now.Unix()) - 10
+	info := path.InfoField{ConsDir: true, SegID: 0x1234, Timestamp: uint32(now.Unix())}
+	hops := []hummingbird.FlyoverHopField{
+		{HopField: path.HopField{ExpTime: 63, ConsIngress: 0, ConsEgress: 1}},
+		{HopField: path.HopField{ExpTime: 63, ConsIngress: 2, ConsEgress: 3}},
+		{HopField: path.HopField{ExpTime: 63, ConsIngress: 4, ConsEgress: 0}},
+	}
+	hops[cur].HopField.Mac = path.MAC(hmac.New(sha256.New, testKey), info, hops[cur].HopField, nil)
+
+	meta := hummingbird.MetaHdr{
+		CurrHF:    uint8(cur * hummingbird.HopLines),
+		BaseTS:    baseTS,
+		HighResTS: uint32(now.Sub(time.Unix(int64(baseTS), 0)).Milliseconds()),
+	}
+	s := &slayers.SCION{
+		NextHdr:    slayers.L4UDP,
+		PathType:   hummingbird.PathType,
+		SrcIA:      src,
+		DstIA:      dst,
+		PayloadLen: uint16(len(payload)),
+	}
+	if res != nil {
+		hop := &hops[cur]
+		hop.Flyover = true
+		hop.ResID, hop.Bw = res.ResID, res.Bw
+		hop.ResStartOffset, hop.Duration = res.ResStartOffset, res.Duration
+		ak := hummingbird.AuthKey(hmac.New(sha256.New, testKey), *hop, baseTS)
+		flyoverMAC := hummingbird.FlyoverMAC(hmac.New(sha256.New, ak[:]), dst, s.PayloadLen,
+			meta.BaseTS, meta.HighResTS)
+		hop.HopField.Mac = hummingbird.AggregateMAC(hop.HopField.Mac, flyoverMAC)
+	}
+	var lines uint8
+	for _, hop := range hops {
+		lines += uint8(hop.Lines())
+	}
+	meta.SegLen[0] = lines
+	s.Path = &hummingbird.Decoded{
+		Base:       hummingbird.Base{PathMeta: meta, NumINF: 1, NumLines: int(lines)},
+		InfoFields: []path.InfoField{info},
+		HopFields:  hops,
+	}
+	if err := s.SetSrcAddr(addr.MustParseHost("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDstAddr(addr.MustParseHost("10.0.0.2")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, s, gopacket.Payload(payload)); err != nil {
+		t.Fatalf("serializing packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessHummingbird(t *testing.T) {
+	payload := make([]byte, 100)
+	newRouter := func() *Router {
+		r := NewRouter(testKey)
+		r.AddInterface(2, Interface{LinkType: LinkParent, IA: srcIA})
+		r.AddInterface(3, Interface{LinkType: LinkChild, IA: dstIA})
+		return r
+	}
+
+	t.Run("standard hop is best-effort", func(t *testing.T) {
+		r := newRouter()
+		if err := r.processPacket(newHummingbirdPacket(t, nil, payload), 2); err != nil {
+			t.Fatalf("processPacket failed: %v", err)
+		}
+		if stats, _ := r.QueueStats(3); stats.Data.Enqueued != 1 {
+			t.Errorf("packet should be queued as data, got %+v", stats)
+		}
+	})
+	t.Run("within reservation", func(t *testing.T) {
+		r := newRouter()
+		res := &hummingbird.FlyoverHopField{ResID: 42, Bw: 1, Duration: 60}
+		if err := r.processPacket(newHummingbirdPacket(t, res, payload), 2); err != nil {
+			t.Fatalf("processPacket failed: %v", err)
+		}
+		if stats, _ := r.QueueStats(3); stats.Reserved.Enqueued != 1 {
+			t.Errorf("packet should be queued as reserved, got %+v", stats)
+		}
+	})
+	t.Run("exceeding reservation falls back to best-effort", func(t *testing.T) {
+		r := newRouter()
+		// The burst of 1 Mbit/s over 10ms only fits a few of the packets.
+		res := &hummingbird.FlyoverHopField{ResID: 42, Bw: 1, Duration: 60}
+		for range 20 {
+			if err := r.processPacket(newHummingbirdPacket(t, res, payload), 2); err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+		}
+		stats, _ := r.QueueStats(3)
+		if stats.Reserved.Enqueued == 0 || stats.Data.Enqueued == 0 {
+			t.Errorf("packets should be split between reserved and data, got %+v", stats)
+		}
+		if stats.Reserved.Enqueued+stats.Data.Enqueued != 20 {
+			t.Errorf("all packets should be forwarded, got %+v", stats)
+		}
+	})
+	t.Run("reservation not started", func(t *testing.T) {
+		r := newRouter()
+		res := &hummingbird.FlyoverHopField{ResID: 42, Bw: 1, ResStartOffset: 3600, Duration: 60}
+		if err := r.processPacket(newHummingbirdPacket(t, res, payload), 2); err != nil {
+			t.Fatalf("processPacket failed: %v", err)
+		}
+		if stats, _ := r.QueueStats(3); stats.Data.Enqueued != 1 {
+			t.Errorf("packet should be queued as data, got %+v", stats)
+		}
+	})
+	t.Run("forged reservation", func(t *testing.T) {
+		r := newRouter()
+		pkt := newHummingbirdPacket(t, &hummingbird.FlyoverHopField{ResID: 42, Bw: 1, Duration: 60},
+			payload)
+		// Increase the bandwidth of the reservation without updating the MAC.
+		var s slayers.SCION
+		if err := s.DecodeFromBytes(pkt, gopacket.NilDecodeFeedback); err != nil {
+			t.Fatal(err)
+		}
+		raw := s.Path.(*hummingbird.Raw)
+		hop, err := raw.GetCurrentHopField()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hop.Bw = hummingbird.MaxBw
+		offset := hummingbird.MetaLen + path.InfoLen + int(raw.PathMeta.CurrHF)*hummingbird.LineLen
+		if err := hop.SerializeTo(raw.Raw[offset:]); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.processPacket(pkt, 2); err == nil {
+			t.Error("processPacket should return error")
+		}
+	})
+}
+
+func TestProcessHummingbirdLocal(t *testing.T) {
+	payload := make([]byte, 100)
+	res := &hummingbird.FlyoverHopField{ResID: 42, Bw: 1, Duration: 60}
+	tests := map[string]struct {
+		cur      int
+		src, dst addr.IA
+		res      *hummingbird.FlyoverHopField
+		wantErr  bool
+	}{
+		"from local AS":                  {cur: 0, src: localIA, dst: dstIA},
+		"from local AS with reservation": {cur: 0, src: localIA, dst: dstIA, res: res},
+		"to local AS":                    {cur: 2, src: srcIA, dst: localIA},
+		"to local AS with reservation":   {cur: 2, src: srcIA, dst: localIA, res: res},
+		"from foreign source":            {cur: 0, src: srcIA, dst: dstIA, wantErr: true},
+		"to foreign destination":         {cur: 2, src: srcIA, dst: dstIA, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRouter(testKey)
+			r.AddInterface(InternalInterface, Interface{IA: localIA})
+			var inID, outID uint16
+			if tc.cur == 0 {
+				outID = 1
+				r.AddInterface(outID, Interface{LinkType: LinkChild, IA: dstIA})
+			} else {
+				inID = 4
+				r.AddInterface(inID, Interface{LinkType: LinkParent, IA: srcIA})
+			}
+
+			pkt := newHummingbirdPathPacket(t, tc.src, tc.dst, tc.cur, tc.res, payload)
+			err := r.processPacket(pkt, inID)
+			stats, _ := r.QueueStats(outID)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("processPacket should return error")
+				}
+				if stats.Data.Enqueued+stats.Reserved.Enqueued != 0 {
+					t.Error("processPacket should not forward the packet")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+			want := stats.Data.Enqueued
+			if tc.res != nil {
+				want = stats.Reserved.Enqueued
+			}
+			if want != 1 || stats.Data.Enqueued+stats.Reserved.Enqueued != 1 {
+				t.Errorf("packet should be queued once in its class, got %+v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package dataplane
+
+import (
+	"fmt"
+)
+
+// LinkType describes the relationship with the neighbour AS on an inter-AS link.
+type LinkType uint8
+
+const (
+	// LinkUnset is used for interfaces without a configured link type.
+	LinkUnset LinkType = iota
+	// LinkCore connects two core ASes.
+	LinkCore
+	// LinkParent points towards the core of the ISD.
+	LinkParent
+	// LinkChild points away from the core of the ISD.
+	LinkChild
+	// LinkPeer connects two ASes with a peering relationship.
+	LinkPeer
+)
+
+func (l LinkType) String() string {
+	switch l {
+	case LinkUnset:
+		return "unset"
+	case LinkCore:
+		return "core"
+	case LinkParent:
+		return "parent"
+	case LinkChild:
+		return "child"
+	case LinkPeer:
+		return "peer"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(l))
+	}
+}
+
+// validateIngressLink checks that a packet may enter through a link of the given type while
+// travelling in the given direction. Beacons are propagated from parents to children, so a packet
+// travelling in construction direction must not enter from a child and a packet travelling
+// against construction direction must not enter from a parent.
+func validateIngressLink(lt LinkType, consDir bool) error {
+	switch {
+	case lt == LinkUnset:
+		return fmt.Errorf("ingress link type unset")
+	case lt == LinkChild && consDir:
+		return fmt.Errorf("packet in construction direction entered on child link")
+	case lt == LinkParent && !consDir:
+		return fmt.Errorf("packet against construction direction entered on parent link")
+	}
+	return nil
+}
+
+// validateTransit checks that the pair of ingress and egress link types within a single segment
+// follows the valley-free rules.
+func validateTransit(ingress, egress LinkType) error {
+	switch {
+	case ingress == LinkCore && egress == LinkCore:
+	case ingress == LinkChild && egress == LinkParent:
+	case ingress == LinkParent && egress == LinkChild:
+	case ingress == LinkChild && egress == LinkPeer:
+	case ingress == LinkPeer && egress == LinkChild:
+	default:
+		return fmt.Errorf("invalid transit from %s link to %s link", ingress, egress)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package dataplane
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
+)
+
+// processOneHop forwards a packet on a one-hop path. One-hop paths reach the direct neighbour on
+// a single link and are used before any path segment to the neighbour is available. The first
+// hop field is created by the local AS, which sends the packet through the internal interface.
+// The second hop field is filled in by the neighbour's router, which delivers the packet to its
+// internal interface.
+//
+// The neighbour IA of an interface may be unset while the neighbour is still unknown, in which
+// case one-hop packets from and to any IA are accepted on it.
+func (r *Router) processOneHop(s *slayers.SCION, data []byte, recvID uint16) error {
+	ohp, ok := s.Path.(*onehop.Path)
+	if !ok {
+		return fmt.Errorf("failed to cast path to onehop.Path")
+	}
+	if !ohp.Info.ConsDir {
+		return fmt.Errorf("one-hop path against construction direction")
+	}
+	// The second hop field is created with the expiration time of the first one, so both expire
+	// together.
+	expSeconds := (uint32(ohp.FirstHop.ExpTime) + 1) * (24 * 60 * 60 / 256)
+	if r.now().After(time.Unix(int64(ohp.Info.Timestamp)+int64(expSeconds), 0)) {
+		return fmt.Errorf("hop expired")
+	}
+	local, ok := r.Interfaces[InternalInterface]
+	if !ok {
+		return fmt.Errorf("internal interface not configured")
+	}
+
+	outID := InternalInterface
+	if recvID == InternalInterface {
+		// The packet leaves the local AS.
+		if ohp.FirstHop.ConsIngress != 0 {
+			return fmt.Errorf("one-hop path with ingress interface %d", ohp.FirstHop.ConsIngress)
+		}
+		if !s.SrcIA.Equal(local.IA) {
+			return fmt.Errorf("source IA %s is not the local IA %s", s.SrcIA, local.IA)
+		}
+		outID = ohp.FirstHop.ConsEgress
+		egIface, ok := r.Interfaces[outID]
+		if !ok || outID == InternalInterface {
+			return fmt.Errorf("egress interface %d not found", outID)
+		}
+		if !egIface.IA.IsZero() && !s.DstIA.Equal(egIface.IA) {
+			return fmt.Errorf("destination IA %s does not match neighbour IA %s on interface %d",
+				s.DstIA, egIface.IA, outID)
+		}
+		calcMAC := path.MAC(hmac.New(sha256.New, r.Key), ohp.Info, ohp.FirstHop, nil)
+		if !bytes.Equal(calcMAC[:], ohp.FirstHop.Mac[:]) {
+			return fmt.Errorf("MAC mismatch (one-hop first hop)")
+		}
+		ohp.Info.UpdateSegID(ohp.FirstHop.Mac)
+	} else {
+		// The packet enters the local AS from the neighbour.
+		if !s.DstIA.Equal(local.IA) && !s.DstIA.IsZero() {
+			return fmt.Errorf("destination IA %s is not the local IA %s", s.DstIA, local.IA)
+		}
+		inIface := r.Interfaces[recvID]
+		if !inIface.IA.IsZero() && !s.SrcIA.Equal(inIface.IA) {
+			return fmt.Errorf("source IA %s does not match neighbour IA %s on interface %d",
+				s.SrcIA, inIface.IA, recvID)
+		}
+		if ohp.SecondHop.ConsIngress != 0 {
+			return fmt.Errorf("one-hop path already completed")
+		}
+		ohp.SecondHop = path.HopField{
+			ConsIngress: recvID,
+			ExpTime:     ohp.FirstHop.ExpTime,
+		}
+		ohp.SecondHop.Mac = path.MAC(hmac.New(sha256.New, r.Key), ohp.Info, ohp.SecondHop, nil)
+	}
+
+	// The path is located after the common and the address header. Its length is unchanged, so
+	// it is updated in place.
+	if err := ohp.SerializeTo(data[slayers.CmnHdrLen+s.AddrHdrLen():]); err != nil {
+		return fmt.Errorf("failed to update path: %w", err)
+	}
+	if !r.Interfaces[outID].queue.enqueue(data, classify(s, r.ControlPort)) {
+		return fmt.Errorf("egress queue of interface %d full", outID)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package dataplane
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
+)
+
+// newOneHopPacket returns a serialized one-hop packet from src to dst leaving src on interface 1.
+// The first hop field is authenticated with key.
+func newOneHopPacket(t testing.TB, src, dst addr.IA, key []byte) []byte {
+	t.Helper()
+	return newOneHopPacketAt(t, src, dst, key, time.Now())
+}
+
+// newOneHopPacketAt is like newOneHopPacket, with the info field timestamp set to ts.
+func newOneHopPacketAt(t testing.TB, src, dst addr.IA, key []byte, ts time.Time) []byte {
+	t.Helper()
+
+	ohp := &onehop.Path{
+		Info:     path.InfoField{ConsDir: true, SegID: 0x1234, Timestamp: uint32(ts.Unix())},
+		FirstHop: path.HopField{ExpTime: 63, ConsEgress: 1},
+	}
+	ohp.FirstHop.Mac = path.MAC(hmac.New(sha256.New, key), ohp.Info, ohp.FirstHop, nil)
+	s := &slayers.SCION{
+		NextHdr:  slayers.L4UDP,
+		PathType: onehop.PathType,
+		SrcIA:    src,
+		DstIA:    dst,
+		Path:     ohp,
+	}
+	if err := s.SetSrcAddr(addr.MustParseHost("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDstAddr(addr.HostSVC(addr.SvcCS)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, s, gopacket.Payload("payload")); err != nil {
+		t.Fatalf("serializing packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decodeOneHop(t *testing.T, data []byte) *onehop.Path {
+	t.Helper()
+	var s slayers.SCION
+	if err := s.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	return s.Path.(*onehop.Path)
+}
+
+func TestProcessOneHopOutbound(t *testing.T) {
+	tests := map[string]struct {
+		src, dst addr.IA
+		key      []byte
+		neighbor addr.IA
+		expired  bool
+		wantErr  bool
+	}{
+		"valid": {
+			src: localIA, dst: dstIA, key: testKey, neighbor: dstIA,
+		},
+		"unknown neighbour": {
+			src: localIA, dst: addr.MustParseIA("0-0"), key: testKey,
+		},
+		"invalid MAC": {
+			src: localIA, dst: dstIA, key: []byte("other-key"), neighbor: dstIA, wantErr: true,
+		},
+		"foreign source": {
+			src: srcIA, dst: dstIA, key: testKey, neighbor: dstIA, wantErr: true,
+		},
+		"destination IA mismatch": {
+			src: localIA, dst: srcIA, key: testKey, neighbor: dstIA, wantErr: true,
+		},
+		"expired": {
+			src: localIA, dst: dstIA, key: testKey, neighbor: dstIA, expired: true, wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRouter(testKey)
+			r.AddInterface(InternalInterface, Interface{IA: localIA})
+			r.AddInterface(1, Interface{LinkType: LinkChild, IA: tc.neighbor})
+
+			ts := time.Now()
+			if tc.expired {
+				ts = ts.Add(-24 * time.Hour)
+			}
+			pkt := newOneHopPacketAt(t, tc.src, tc.dst, tc.key, ts)
+			err := r.processPacket(pkt, InternalInterface)
+			out, ok := r.Interfaces[1].queue.dequeue()
+			if tc.wantErr {
+				if err == nil {
+					t.Error("processPacket should return error")
+				}
+				if ok {
+					t.Error("processPacket should not forward the packet")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+			if !ok {
+				t.Fatal("processPacket should forward the packet on interface 1")
+			}
+			ohp := decodeOneHop(t, out)
+			want := path.InfoField{ConsDir: true, SegID: 0x1234, Timestamp: ohp.Info.Timestamp}
+			want.UpdateSegID(ohp.FirstHop.Mac)
+			if ohp.Info.SegID != want.SegID {
+				t.Errorf("SegID = %x, want %x", ohp.Info.SegID, want.SegID)
+			}
+		})
+	}
+}
+
+func TestProcessOneHopInbound(t *testing.T) {
+	neighborKey := []byte("neighbour-key")
+	tests := map[string]struct {
+		src, dst addr.IA
+		neighbor addr.IA
+		internal bool
+		complete bool
+		expired  bool
+		wantErr  bool
+	}{
+		"valid": {
+			src: srcIA, dst: localIA, neighbor: srcIA, internal: true,
+		},
+		"unknown neighbour": {
+			src: srcIA, dst: addr.MustParseIA("0-0"), internal: true,
+		},
+		"source IA mismatch": {
+			src: dstIA, dst: localIA, neighbor: srcIA, internal: true, wantErr: true,
+		},
+		"foreign destination": {
+			src: srcIA, dst: dstIA, neighbor: srcIA, internal: true, wantErr: true,
+		},
+		"completed path": {
+			src: srcIA, dst: localIA, neighbor: srcIA, internal: true, complete: true, wantErr: true,
+		},
+		"no internal interface": {
+			src: srcIA, dst: localIA, neighbor: srcIA, wantErr: true,
+		},
+		"expired": {
+			src: srcIA, dst: localIA, neighbor: srcIA, internal: true, expired: true, wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRouter(testKey)
+			if tc.internal {
+				r.AddInterface(InternalInterface, Interface{IA: localIA})
+			}
+			r.AddInterface(2, Interface{LinkType: LinkParent, IA: tc.neighbor})
+
+			ts := time.Now()
+			if tc.expired {
+				ts = ts.Add(-24 * time.Hour)
+			}
+			pkt := newOneHopPacketAt(t, tc.src, tc.dst, neighborKey, ts)
+			if tc.complete {
+				var s slayers.SCION
+				if err := s.DecodeFromBytes(pkt, gopacket.NilDecodeFeedback); err != nil {
+					t.Fatal(err)
+				}
+				ohp := s.Path.(*onehop.Path)
+				ohp.SecondHop.ConsIngress = 5
+				if err := ohp.SerializeTo(pkt[slayers.CmnHdrLen+s.AddrHdrLen():]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := r.processPacket(pkt, 2)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("processPacket should return error")
+				}
+				if tc.internal {
+					if _, ok := r.Interfaces[InternalInterface].queue.dequeue(); ok {
+						t.Error("processPacket should not deliver the packet")
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+			out, ok := r.Interfaces[InternalInterface].queue.dequeue()
+			if !ok {
+				t.Fatal("processPacket should deliver the packet on the internal interface")
+			}
+			ohp := decodeOneHop(t, out)
+			if ohp.SecondHop.ConsIngress != 2 || ohp.SecondHop.ExpTime != ohp.FirstHop.ExpTime {
+				t.Errorf("unexpected second hop field %+v", ohp.SecondHop)
+			}
+			if want := path.MAC(hmac.New(sha256.New, testKey), ohp.Info, ohp.SecondHop, nil); ohp.SecondHop.Mac != want {
+				t.Error("second hop field has invalid MAC")
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package dataplane
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/scionproto/scion/pkg/slayers"
+)
+
+var (
+	// DefaultControlQueueDepth is the default number of packets buffered in the control queue of
+	// each interface.
+	DefaultControlQueueDepth = 256
+	// DefaultReservedQueueDepth is the default number of packets buffered in the reserved queue
+	// of each interface.
+	DefaultReservedQueueDepth = 512
+	// DefaultDataQueueDepth is the default number of packets buffered in the data queue of each
+	// interface.
+	DefaultDataQueueDepth = 1024
+)
+
+// TrafficClass is the egress queue a packet is scheduled on.
+type TrafficClass uint8
+
+const (
+	// ClassData is bulk data traffic.
+	ClassData TrafficClass = iota
+	// ClassControl is control plane, SCMP and BFD traffic. It is scheduled with strict priority
+	// over all other traffic.
+	ClassControl
+	// ClassReserved is traffic within a bandwidth reservation. It is scheduled with priority over
+	// data traffic.
+	ClassReserved
+)
+
+func (c TrafficClass) String() string {
+	switch c {
+	case ClassControl:
+		return "control"
+	case ClassReserved:
+		return "reserved"
+	default:
+		return "data"
+	}
+}
+
+// QueueConfig configures the egress queues of every interface.
+type QueueConfig struct {
+	// ControlDepth is the maximum number of packets in the control queue.
+	ControlDepth int
+	// ReservedDepth is the maximum number of packets in the reserved queue.
+	ReservedDepth int
+	// DataDepth is the maximum number of packets in the data queue.
+	DataDepth int
+	// DataShare is the fraction of transmissions reserved for data traffic while data and a
+	// higher priority queue are backlogged, in the range [0, 1]. Zero means strict priority.
+	DataShare float64
+}
+
+// InitDefaults initializes the default values for the config.
+func (cfg *QueueConfig) InitDefaults() {
+	if cfg.ControlDepth == 0 {
+		cfg.ControlDepth = DefaultControlQueueDepth
+	}
+	if cfg.ReservedDepth == 0 {
+		cfg.ReservedDepth = DefaultReservedQueueDepth
+	}
+	if cfg.DataDepth == 0 {
+		cfg.DataDepth = DefaultDataQueueDepth
+	}
+	cfg.DataShare = min(max(cfg.DataShare, 0), 1)
+}
+
+// ClassStats holds the statistics of a single egress queue.
+type ClassStats struct {
+	// Depth is the number of packets currently in the queue.
+	Depth int
+	// Enqueued is the total number of packets accepted by the queue.
+	Enqueued uint64
+	// Dropped is the total number of packets dropped because the queue was full.
+	Dropped uint64
+}
+
+// QueueStats holds the statistics of the egress queues of an interface.
+type QueueStats struct {
+	Control  ClassStats
+	Reserved ClassStats
+	Data     ClassStats
+}
+
+type classQueue struct {
+	pkts  [][]byte
+	limit int
+	stats ClassStats
+}
+
+func (q *classQueue) push(pkt []byte) bool {
+	if len(q.pkts) >= q.limit {
+		q.stats.Dropped++
+		return false
+	}
+	q.pkts = append(q.pkts, pkt)
+	q.stats.Enqueued++
+	return true
+}
+
+func (q *classQueue) pop() []byte {
+	pkt := q.pkts[0]
+	q.pkts[0] = nil
+	q.pkts = q.pkts[1:]
+	return pkt
+}
+
+// egressQueue schedules the packets leaving through a single interface. Control traffic has
+// strict priority over reserved traffic, which has priority over data traffic, except for the
+// configured share of transmissions reserved for data.
+type egressQueue struct {
+	mu sync.Mutex
+	// ready is signalled after a packet is enqueued.
+	ready    chan struct{}
+	control  classQueue
+	reserved classQueue
+	data     classQueue
+	share    float64
+	credit   float64
+}
+
+func newEgressQueue(cfg QueueConfig) *egressQueue {
+	return &egressQueue{
+		ready:    make(chan struct{}, 1),
+		control:  classQueue{limit: cfg.ControlDepth},
+		reserved: classQueue{limit: cfg.ReservedDepth},
+		data:     classQueue{limit: cfg.DataDepth},
+		share:    cfg.DataShare,
+	}
+}
+
+// enqueue adds the packet to the queue of the given class. It returns false if the packet was
+// dropped.
+func (q *egressQueue) enqueue(pkt []byte, class TrafficClass) bool {
+	q.mu.Lock()
+	var ok bool
+	switch class {
+	case ClassControl:
+		ok = q.control.push(pkt)
+	case ClassReserved:
+		ok = q.reserved.push(pkt)
+	default:
+		ok = q.data.push(pkt)
+	}
+	q.mu.Unlock()
+
+	if ok {
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+	return ok
+}
+
+// dequeue returns the next packet to transmit, or false if all queues are empty.
+func (q *egressQueue) dequeue() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var high *classQueue
+	switch {
+	case len(q.control.pkts) != 0:
+		high = &q.control
+	case len(q.reserved.pkts) != 0:
+		high = &q.reserved
+	}
+	switch {
+	case high == nil && len(q.data.pkts) == 0:
+		return nil, false
+	case len(q.data.pkts) == 0:
+		return high.pop(), true
+	case high == nil:
+		return q.data.pop(), true
+	}
+	// Data and a higher priority queue are backlogged, data accumulates credit for its share.
+	q.credit += q.share
+	if q.credit >= 1 {
+		q.credit--
+		return q.data.pop(), true
+	}
+	return high.pop(), true
+}
+
+func (q *egressQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := QueueStats{Control: q.control.stats, Reserved: q.reserved.stats, Data: q.data.stats}
+	s.Control.Depth = len(q.control.pkts)
+	s.Reserved.Depth = len(q.reserved.pkts)
+	s.Data.Depth = len(q.data.pkts)
+	return s
+}
+
+// classify determines the traffic class of a packet. SCMP and BFD packets, as well as UDP
+// packets from or to the control service port, are control traffic.
+func classify(s *slayers.SCION, controlPort uint16) TrafficClass {
+	switch s.NextHdr {
+	case slayers.L4SCMP, slayers.L4BFD:
+		return ClassControl
+	case slayers.L4UDP:
+		if controlPort == 0 || len(s.Payload) < 4 {
+			return ClassData
+		}
+		src := binary.BigEndian.Uint16(s.Payload[0:2])
+		dst := binary.BigEndian.Uint16(s.Payload[2:4])
+		if src == controlPort || dst == controlPort {
+			return ClassControl
+		}
+	}
+	return ClassData
+}
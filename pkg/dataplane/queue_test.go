@@ -0,0 +1,91 @@
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/scionproto/scion/pkg/slayers"
+)
+
+func TestEgressQueue(t *testing.T) {
+	control, reserved, data := []byte("control"), []byte("reserved"), []byte("data")
+
+	t.Run("strict priority", func(t *testing.T) {
+		q := newEgressQueue(QueueConfig{ControlDepth: 4, ReservedDepth: 4, DataDepth: 4})
+		q.enqueue(data, ClassData)
+		q.enqueue(reserved, ClassReserved)
+		q.enqueue(control, ClassControl)
+		q.enqueue(control, ClassControl)
+
+		want := []string{"control", "control", "reserved", "data"}
+		for i, w := range want {
+			pkt, ok := q.dequeue()
+			if !ok || string(pkt) != w {
+				t.Fatalf("dequeue %d: got %q, want %q", i, pkt, w)
+			}
+		}
+		if _, ok := q.dequeue(); ok {
+			t.Error("dequeue should return false for empty queue")
+		}
+	})
+	t.Run("data share", func(t *testing.T) {
+		q := newEgressQueue(QueueConfig{ControlDepth: 100, DataDepth: 100, DataShare: 0.25})
+		for range 40 {
+			q.enqueue(control, ClassControl)
+			q.enqueue(data, ClassData)
+		}
+		var gotData int
+		for range 40 {
+			pkt, _ := q.dequeue()
+			if string(pkt) == "data" {
+				gotData++
+			}
+		}
+		if gotData != 10 {
+			t.Errorf("data should get a quarter of 40 transmissions, got %d", gotData)
+		}
+	})
+	t.Run("drops", func(t *testing.T) {
+		q := newEgressQueue(QueueConfig{ControlDepth: 1, ReservedDepth: 3, DataDepth: 2})
+		for range 3 {
+			q.enqueue(data, ClassData)
+			q.enqueue(reserved, ClassReserved)
+			q.enqueue(control, ClassControl)
+		}
+		want := QueueStats{
+			Control:  ClassStats{Depth: 1, Enqueued: 1, Dropped: 2},
+			Reserved: ClassStats{Depth: 3, Enqueued: 3},
+			Data:     ClassStats{Depth: 2, Enqueued: 2, Dropped: 1},
+		}
+		if got := q.stats(); got != want {
+			t.Errorf("stats: got %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestClassify(t *testing.T) {
+	udp := func(src, dst uint16) []byte {
+		return []byte{byte(src >> 8), byte(src), byte(dst >> 8), byte(dst), 0, 8, 0, 0}
+	}
+	tests := map[string]struct {
+		nextHdr slayers.L4ProtocolType
+		payload []byte
+		want    TrafficClass
+	}{
+		"SCMP":                {nextHdr: slayers.L4SCMP, want: ClassControl},
+		"BFD":                 {nextHdr: slayers.L4BFD, want: ClassControl},
+		"UDP data":            {nextHdr: slayers.L4UDP, payload: udp(40000, 443), want: ClassData},
+		"UDP to control":      {nextHdr: slayers.L4UDP, payload: udp(40000, 30252), want: ClassControl},
+		"UDP from control":    {nextHdr: slayers.L4UDP, payload: udp(30252, 40000), want: ClassControl},
+		"truncated UDP":       {nextHdr: slayers.L4UDP, payload: []byte{0x76}, want: ClassData},
+		"unknown L4 protocol": {nextHdr: slayers.L4TCP, want: ClassData},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &slayers.SCION{NextHdr: tc.nextHdr}
+			s.Payload = tc.payload
+			if got := classify(s, 30252); got != tc.want {
+				t.Errorf("classify: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,55 +2,106 @@ package dataplane
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"hash"
 	"net"
 	"time"
 
 	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
 	"github.com/scionproto/scion/pkg/slayers"
 	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
 	"github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"github.com/fancl20/cion/pkg/dataplane/hummingbird"
 )
 
+// InternalInterface is the ID of the interface connecting the router to the local AS. Packets
+// destined to the local AS are written to it, and packets read from it originate in the local
+// AS. Its IA is the local ISD-AS.
+const InternalInterface uint16 = 0
+
 // Interface represents a router interface.
 type Interface struct {
-	Conn       net.PacketConn
+	// Conn is the underlay connection to the neighbour. Wrap it with secure.NewConn to encrypt
+	// the link.
+	Conn net.PacketConn
+	// RemoteAddr is the underlay address of the neighbour. On the InternalInterface, UDP
+	// packets to IP hosts are delivered to the host and port in the SCION header instead, and
+	// only the other packets are sent to RemoteAddr.
 	RemoteAddr net.Addr
+	// LinkType is the relationship with the neighbour AS.
+	LinkType LinkType
+	// IA is the ISD-AS of the neighbour AS.
+	IA addr.IA
+
+	queue *egressQueue
 }
 
 // Router implements a SCION dataplane router.
 type Router struct {
 	// Interfaces maps the SCION Interface ID to the underlying connection and remote address.
+	// InternalInterface connects the router to the local AS.
 	Interfaces map[uint16]Interface
 	// Key is the secret key used for MAC verification (AES-CMAC usually, here HMAC-SHA256).
 	Key []byte
+	// Queue configures the egress queues. It must be set before interfaces are added.
+	Queue QueueConfig
+	// ControlPort is the UDP port of the control service. Packets from or to this port are
+	// scheduled as control traffic. Zero disables the classification by port.
+	ControlPort uint16
+
+	reservations *policer
+	// now returns the current time used to validate packets. It is replaced in benchmarks.
+	now func() time.Time
 }
 
 // NewRouter creates a new Router.
 func NewRouter(key []byte) *Router {
 	return &Router{
-		Interfaces: make(map[uint16]Interface),
-		Key:        key,
+		Interfaces:   make(map[uint16]Interface),
+		Key:          key,
+		reservations: newPolicer(),
+		now:          time.Now,
 	}
 }
 
 // AddInterface adds an interface to the router.
-func (r *Router) AddInterface(id uint16, conn net.PacketConn, remote net.Addr) {
-	r.Interfaces[id] = Interface{
-		Conn:       conn,
-		RemoteAddr: remote,
+func (r *Router) AddInterface(id uint16, iface Interface) {
+	cfg := r.Queue
+	cfg.InitDefaults()
+	iface.queue = newEgressQueue(cfg)
+	r.Interfaces[id] = iface
+}
+
+// QueueStats returns the egress queue statistics of the interface.
+func (r *Router) QueueStats(id uint16) (QueueStats, bool) {
+	iface, ok := r.Interfaces[id]
+	if !ok {
+		return QueueStats{}, false
 	}
+	return iface.queue.stats(), true
 }
 
 // Run starts the router. It reads from all interfaces sequentially and forwards packets.
-// This function blocks.
-func (r *Router) Run() {
+// Packets are written by one goroutine per interface that drains the egress queues.
+// This function blocks until the context is canceled.
+func (r *Router) Run(ctx context.Context) error {
 	buf := make([]byte, 65535) // Max payload size
 
+	for id, iface := range r.Interfaces {
+		go r.drain(ctx, id, iface)
+	}
+
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for id, iface := range r.Interfaces {
 			// Set a short read deadline to poll interfaces sequentially
 			iface.Conn.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
@@ -86,7 +137,14 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 		return fmt.Errorf("failed to decode SCION header: %w", err)
 	}
 
-	// We only handle SCION path type for now
+	switch s.PathType {
+	case hummingbird.PathType:
+		return r.processHummingbird(&s, data, recvID)
+	case onehop.PathType:
+		return r.processOneHop(&s, data, recvID)
+	}
+
+	// We only handle SCION, Hummingbird and one-hop path types for now
 	if s.PathType != scion.PathType {
 		return fmt.Errorf("unsupported path type: %v", s.PathType)
 	}
@@ -125,12 +183,31 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 
 	// --- Ingress Processing ---
 	if recvID == ingressID {
+		inIface := r.Interfaces[recvID]
+		// Packets from the internal interface originate in the local AS, which owns the first
+		// hop of the path.
+		local := recvID == InternalInterface
+		if local {
+			if rawPath.PathMeta.CurrHF != 0 || !s.SrcIA.Equal(inIface.IA) {
+				return fmt.Errorf("packet from the local AS not at the first hop of %s", s.SrcIA)
+			}
+		} else {
+			if err := validateIngressLink(inIface.LinkType, info.ConsDir); err != nil {
+				return fmt.Errorf("invalid ingress on interface %d: %w", recvID, err)
+			}
+			// The source AS is the only hop before us, so it must be our neighbour.
+			if rawPath.PathMeta.CurrHF == 1 && !s.SrcIA.Equal(inIface.IA) {
+				return fmt.Errorf("source IA %s does not match neighbour IA %s on interface %d",
+					s.SrcIA, inIface.IA, recvID)
+			}
+		}
+
 		// 1. Validate Expiry
 		// Expiration = Timestamp + (1+ExpTime) * (24h/256)
 		// Unit is approx 337.5 seconds
 		expSeconds := (uint32(hop.ExpTime) + 1) * (24 * 60 * 60 / 256)
 		expiry := time.Unix(int64(info.Timestamp)+int64(expSeconds), 0)
-		if time.Now().After(expiry) {
+		if r.now().After(expiry) {
 			return fmt.Errorf("hop expired")
 		}
 
@@ -138,7 +215,10 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 		if !info.ConsDir {
 			// Update Accumulator (SegID) first
 			// Acc = Acc XOR MAC
-			info.UpdateSegID(hop.Mac)
+			// Locally originated packets already carry the SegID of the first hop.
+			if !local {
+				info.UpdateSegID(hop.Mac)
+			}
 
 			// Verify MAC using the NEW Acc
 			calcMAC := path.MAC(macFactory(), info, hop, nil)
@@ -163,8 +243,22 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 		// Otherwise, we simply forward to the next hop (internal router).
 		// Since we only have 'Interfaces', we assume if ID is present, we own it.
 
-		if _, ok := r.Interfaces[egressID]; ok {
+		if egressID == InternalInterface {
+			if _, ok := r.Interfaces[InternalInterface]; !ok {
+				return fmt.Errorf("egress interface %d not found", egressID)
+			}
+			// The packet is delivered to the local AS, which owns the last hop of the path.
+			if local || !rawPath.IsLastHop() || !s.DstIA.Equal(r.Interfaces[InternalInterface].IA) {
+				return fmt.Errorf("packet to the local AS not at the last hop of %s", s.DstIA)
+			}
+		} else if egIface, ok := r.Interfaces[egressID]; ok {
 			// We are also the Egress Router
+			if !local {
+				if err := validateTransit(inIface.LinkType, egIface.LinkType); err != nil {
+					return fmt.Errorf("invalid transit from interface %d to %d: %w",
+						recvID, egressID, err)
+				}
+			}
 
 			if info.ConsDir {
 				// Verify MAC (again? Spec says Egress verifies)
@@ -186,6 +280,12 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 			if err := rawPath.IncPath(); err != nil {
 				return fmt.Errorf("failed to increment path: %w", err)
 			}
+
+			// The next hop is the destination AS, so it must be our neighbour.
+			if rawPath.IsLastHop() && !s.DstIA.Equal(egIface.IA) {
+				return fmt.Errorf("destination IA %s does not match neighbour IA %s on interface %d",
+					s.DstIA, egIface.IA, egressID)
+			}
 		}
 
 		// Serialize Path changes back to packet buffer
@@ -204,9 +304,8 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 		}
 
 		// Forward
-		_, err = outIface.Conn.WriteTo(data, outIface.RemoteAddr)
-		if err != nil {
-			return fmt.Errorf("failed to write to interface %d: %w", egressID, err)
+		if !outIface.queue.enqueue(data, classify(&s, r.ControlPort)) {
+			return fmt.Errorf("egress queue of interface %d full", egressID)
 		}
 
 		return nil
@@ -217,3 +316,42 @@ func (r *Router) processPacket(data []byte, recvID uint16) error {
 		return fmt.Errorf("packet received on wrong interface: %d (expected ingress %d)", recvID, ingressID)
 	}
 }
+
+// drain writes the packets queued on the interface until the context is canceled.
+func (r *Router) drain(ctx context.Context, id uint16, iface Interface) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-iface.queue.ready:
+		}
+		for pkt, ok := iface.queue.dequeue(); ok; pkt, ok = iface.queue.dequeue() {
+			dst := iface.RemoteAddr
+			if id == InternalInterface {
+				dst = hostAddr(pkt, iface.RemoteAddr)
+			}
+			if _, err := iface.Conn.WriteTo(pkt, dst); err != nil {
+				fmt.Printf("Error writing to interface %d: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// hostAddr returns the underlay address of the destination host of a packet delivered to the local
+// AS. UDP packets to an IP host are sent to the host and port in the SCION header, like on the
+// end host stack. Other packets, e.g. to service addresses, are sent to the fallback address.
+func hostAddr(pkt []byte, fallback net.Addr) net.Addr {
+	var s slayers.SCION
+	if err := s.DecodeFromBytes(pkt, gopacket.NilDecodeFeedback); err != nil {
+		return fallback
+	}
+	dst, err := s.DstAddr()
+	if err != nil || dst.Type() != addr.HostTypeIP || s.NextHdr != slayers.L4UDP ||
+		len(s.Payload) < 4 {
+		return fallback
+	}
+	return &net.UDPAddr{
+		IP:   dst.IP().AsSlice(),
+		Port: int(binary.BigEndian.Uint16(s.Payload[2:4])),
+	}
+}
@@ -0,0 +1,355 @@
+package dataplane
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+
+	"github.com/fancl20/cion/pkg/dataplane/hummingbird"
+)
+
+var (
+	benchHops     = []int{3, 16, 32}
+	benchPayload  = make([]byte, 1000)
+	benchPathType = []path.Type{scion.PathType, hummingbird.PathType}
+)
+
+// benchPacket holds a packet used as template for the benchmarks.
+type benchPacket struct {
+	raw  []byte
+	scn  *slayers.SCION
+	info path.InfoField
+	hop  hummingbird.FlyoverHopField
+	// sent is the send time of the packet.
+	sent time.Time
+}
+
+// newBenchPacket returns a packet over a single down segment with the given number of hops, as
+// it arrives at the AS owning the second hop. The second hop enters on interface in and leaves on
+// interface out. For Hummingbird paths the second hop carries a reservation.
+func newBenchPacket(b testing.TB, pathType path.Type, numHops int, in, out uint16) benchPacket {
+	b.Helper()
+
+	// Truncate the info field timestamp so that SCION packets built within the hour are
+	// identical. Hummingbird packets also carry the send time, which changes every second.
+	sent := time.Now()
+	info := path.InfoField{
+		ConsDir: true, SegID: 0x1234, Timestamp: uint32(sent.Truncate(time.Hour).Unix()),
+	}
+	hops := make([]hummingbird.FlyoverHopField, numHops)
+	for i := range hops {
+		hops[i].HopField = path.HopField{
+			ExpTime:     255,
+			ConsIngress: uint16(2 * i),
+			ConsEgress:  uint16(2*i + 1),
+		}
+	}
+	hops[0].HopField.ConsIngress = 0
+	hops[numHops-1].HopField.ConsEgress = 0
+	hops[1].HopField.ConsIngress, hops[1].HopField.ConsEgress = in, out
+	hops[1].HopField.Mac = path.MAC(hmac.New(sha256.New, testKey), info, hops[1].HopField, nil)
+
+	s := &slayers.SCION{
+		NextHdr:    slayers.L4UDP,
+		PathType:   pathType,
+		SrcIA:      srcIA,
+		DstIA:      dstIA,
+		PayloadLen: uint16(len(benchPayload)),
+	}
+	switch pathType {
+	case scion.PathType:
+		dec := &scion.Decoded{
+			Base: scion.Base{
+				PathMeta: scion.MetaHdr{CurrHF: 1, SegLen: [3]uint8{uint8(numHops), 0, 0}},
+				NumINF:   1,
+				NumHops:  numHops,
+			},
+			InfoFields: []path.InfoField{info},
+		}
+		for _, hop := range hops {
+			dec.HopFields = append(dec.HopFields, hop.HopField)
+		}
+		s.Path = dec
+	case hummingbird.PathType:
+		baseTS := uint32(sent.Unix())
+		meta := hummingbird.MetaHdr{
+			CurrHF:    hummingbird.HopLines,
+			BaseTS:    baseTS,
+			HighResTS: uint32(sent.Sub(time.Unix(int64(baseTS), 0)).Milliseconds()),
+		}
+		hops[1].Flyover = true
+		hops[1].ResID, hops[1].Bw, hops[1].Duration = 1, hummingbird.MaxBw, 3600
+		ak := hummingbird.AuthKey(hmac.New(sha256.New, testKey), hops[1], baseTS)
+		flyoverMAC := hummingbird.FlyoverMAC(hmac.New(sha256.New, ak[:]), dstIA, s.PayloadLen,
+			meta.BaseTS, meta.HighResTS)
+		hops[1].HopField.Mac = hummingbird.AggregateMAC(hops[1].HopField.Mac, flyoverMAC)
+		lines := numHops*hummingbird.HopLines + hummingbird.FlyoverLines - hummingbird.HopLines
+		meta.SegLen[0] = uint8(lines)
+		s.Path = &hummingbird.Decoded{
+			Base:       hummingbird.Base{PathMeta: meta, NumINF: 1, NumLines: lines},
+			InfoFields: []path.InfoField{info},
+			HopFields:  hops,
+		}
+	}
+	if err := s.SetSrcAddr(addr.MustParseHost("10.0.0.1")); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.SetDstAddr(addr.MustParseHost("10.0.0.2")); err != nil {
+		b.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, s, gopacket.Payload(benchPayload)); err != nil {
+		b.Fatalf("serializing packet: %v", err)
+	}
+	return benchPacket{raw: buf.Bytes(), scn: s, info: info, hop: hops[1], sent: sent}
+}
+
+// forEachPath runs the benchmark for every combination of path type and path length.
+func forEachPath(b *testing.B, f func(b *testing.B, pkt benchPacket)) {
+	for _, pt := range benchPathType {
+		for _, n := range benchHops {
+			b.Run(fmt.Sprintf("%s/hops=%d", pt, n), func(b *testing.B) {
+				f(b, newBenchPacket(b, pt, n, 2, 3))
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	forEachPath(b, func(b *testing.B, pkt benchPacket) {
+		var s slayers.SCION
+		b.ReportAllocs()
+		b.SetBytes(int64(len(pkt.raw)))
+		for b.Loop() {
+			if err := s.DecodeFromBytes(pkt.raw, gopacket.NilDecodeFeedback); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMACVerify(b *testing.B) {
+	b.Run("scion", func(b *testing.B) {
+		pkt := newBenchPacket(b, scion.PathType, 3, 2, 3)
+		mac := hmac.New(sha256.New, testKey)
+		buf := make([]byte, path.MACBufferSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			if path.MAC(mac, pkt.info, pkt.hop.HopField, buf) != pkt.hop.HopField.Mac {
+				b.Fatal("MAC mismatch")
+			}
+		}
+	})
+	b.Run("hummingbird", func(b *testing.B) {
+		pkt := newBenchPacket(b, hummingbird.PathType, 3, 2, 3)
+		meta := pkt.scn.Path.(*hummingbird.Decoded).PathMeta
+		mac := hmac.New(sha256.New, testKey)
+		buf := make([]byte, path.MACBufferSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			ak := hummingbird.AuthKey(mac, pkt.hop, meta.BaseTS)
+			flyoverMAC := hummingbird.FlyoverMAC(hmac.New(sha256.New, ak[:]), dstIA,
+				pkt.scn.PayloadLen, meta.BaseTS, meta.HighResTS)
+			hopMAC := hummingbird.AggregateMAC(pkt.hop.HopField.Mac, flyoverMAC)
+			if path.MAC(mac, pkt.info, pkt.hop.HopField, buf) != hopMAC {
+				b.Fatal("MAC mismatch")
+			}
+		}
+	})
+}
+
+func BenchmarkSegIDUpdate(b *testing.B) {
+	forEachPath(b, func(b *testing.B, pkt benchPacket) {
+		var s slayers.SCION
+		if err := s.DecodeFromBytes(pkt.raw, gopacket.NilDecodeFeedback); err != nil {
+			b.Fatal(err)
+		}
+		type infoPath interface {
+			GetCurrentInfoField() (path.InfoField, error)
+			SetInfoField(path.InfoField, int) error
+		}
+		p := s.Path.(infoPath)
+		b.ReportAllocs()
+		for b.Loop() {
+			info, err := p.GetCurrentInfoField()
+			if err != nil {
+				b.Fatal(err)
+			}
+			info.UpdateSegID(pkt.hop.HopField.Mac)
+			if err := p.SetInfoField(info, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	forEachPath(b, func(b *testing.B, pkt benchPacket) {
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true}
+		payload := gopacket.Payload(benchPayload)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(pkt.raw)))
+		for b.Loop() {
+			if err := gopacket.SerializeLayers(buf, opts, pkt.scn, payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkProcessPacket measures the processing of a single packet. The router clock starts at
+// the send time of the packet and advances by the transmission time of the packet at the largest
+// reservable bandwidth, so Hummingbird packets stay within their reservation. Before the clock
+// exceeds the allowed skew, it is reset together with the reservations outside the timed region.
+func BenchmarkProcessPacket(b *testing.B) {
+	forEachPath(b, func(b *testing.B, pkt benchPacket) {
+		r := NewRouter(testKey)
+		r.AddInterface(2, Interface{LinkType: LinkParent, IA: srcIA})
+		r.AddInterface(3, Interface{LinkType: LinkChild, IA: dstIA})
+		out := r.Interfaces[3].queue
+		data := make([]byte, len(pkt.raw))
+
+		now := pkt.sent
+		r.now = func() time.Time { return now }
+		rate := time.Duration(hummingbird.MaxBw * hummingbird.BwUnit)
+		step := time.Duration(len(pkt.raw)*8)*time.Second/rate + 1
+
+		var ops uint64
+		b.ReportAllocs()
+		b.SetBytes(int64(len(pkt.raw)))
+		for b.Loop() {
+			if now.Sub(pkt.sent) >= FlyoverMaxSkew/2 {
+				b.StopTimer()
+				now, r.reservations = pkt.sent, newPolicer()
+				b.StartTimer()
+			}
+			now = now.Add(step)
+			copy(data, pkt.raw)
+			if err := r.processPacket(data, 2); err != nil {
+				b.Fatal(err)
+			}
+			if _, ok := out.dequeue(); !ok {
+				b.Fatal("packet not forwarded")
+			}
+			ops++
+		}
+
+		stats := out.stats()
+		want := stats.Data.Enqueued
+		if pkt.scn.PathType == hummingbird.PathType {
+			want = stats.Reserved.Enqueued
+		}
+		if want != ops {
+			b.Fatalf("%d of %d packets enqueued in the expected class, stats: %+v",
+				want, ops, stats)
+		}
+	})
+}
+
+// BenchmarkRouterThroughput measures the forwarding throughput of a router over loopback UDP.
+// Each pair of interfaces carries one flow, sent by a neighbour on the ingress interface and
+// received by a neighbour on the egress interface. One op is one sent packet, timed until the last
+// packet is forwarded. Packets that are not forwarded are reported as loss.
+func BenchmarkRouterThroughput(b *testing.B) {
+	for _, pairs := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("interfaces=%d", 2*pairs), func(b *testing.B) {
+			benchmarkThroughput(b, pairs)
+		})
+	}
+}
+
+func benchmarkThroughput(b *testing.B, pairs int) {
+	listen := func() net.PacketConn {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	r := NewRouter(testKey)
+	senders := make([]net.PacketConn, pairs)
+	routerIn := make([]net.Addr, pairs)
+	templates := make([][]byte, pairs)
+	var received, lastReceived atomic.Int64
+	for i := range pairs {
+		in, out := uint16(2+4*i), uint16(4+4*i)
+		sender, receiver := listen(), listen()
+		inConn, outConn := listen(), listen()
+		r.AddInterface(in, Interface{
+			Conn: inConn, RemoteAddr: sender.LocalAddr(), LinkType: LinkParent, IA: srcIA,
+		})
+		r.AddInterface(out, Interface{
+			Conn: outConn, RemoteAddr: receiver.LocalAddr(), LinkType: LinkChild, IA: dstIA,
+		})
+		senders[i], routerIn[i] = sender, inConn.LocalAddr()
+		templates[i] = newBenchPacket(b, scion.PathType, 3, in, out).raw
+
+		go func() {
+			buf := make([]byte, 2048)
+			for {
+				if _, _, err := receiver.ReadFrom(buf); err != nil {
+					return
+				}
+				received.Add(1)
+				lastReceived.Store(time.Now().UnixNano())
+			}
+		}()
+	}
+
+	// Stop the router before the connections are closed by the cleanup.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx) //nolint:errcheck // stopped by cancel
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(templates[0])))
+	b.ResetTimer()
+	start := time.Now()
+	for i := range b.N {
+		pair := i % pairs
+		if _, err := senders[pair].WriteTo(templates[pair], routerIn[pair]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	// Wait for the router to catch up. Packets dropped by the kernel or the egress queues are
+	// not forwarded, so give up once the receive count stops growing. The timer is stopped while
+	// waiting, the time until the last packet was received is reported instead.
+	b.StopTimer()
+	last := int64(-1)
+	for n := received.Load(); n < int64(b.N) && n != last; n = received.Load() {
+		last = n
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	n := received.Load()
+	if n == 0 {
+		b.Fatal("no packets forwarded")
+	}
+	elapsed := time.Unix(0, lastReceived.Load()).Sub(start)
+	b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N), "ns/op")
+	b.ReportMetric(float64(n)/elapsed.Seconds(), "pkts/s")
+	b.ReportMetric(100*float64(int64(b.N)-n)/float64(b.N), "%loss")
+}
@@ -0,0 +1,266 @@
+package dataplane
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+)
+
+var (
+	testKey = []byte("test-router-key")
+	srcIA   = addr.MustParseIA("1-ff00:0:1")
+	localIA = addr.MustParseIA("1-ff00:0:2")
+	dstIA   = addr.MustParseIA("1-ff00:0:3")
+)
+
+// newTestPacket returns a serialized packet from src to dst over a single segment of three hops,
+// as it arrives at the AS owning the middle hop.
+func newTestPacket(t testing.TB, src, dst addr.IA, consDir bool) []byte {
+	return newPathPacket(t, src, dst, consDir, 1)
+}
+
+// newPathPacket returns a serialized packet from src to dst over a single segment of three hops,
+// as it arrives at the AS owning the hop at currHF. The AS owning the first hop is the source AS,
+// and the AS owning the last hop is the destination AS.
+func newPathPacket(t testing.TB, src, dst addr.IA, consDir bool, currHF uint8) []byte {
+	t.Helper()
+
+	info := path.InfoField{
+		ConsDir:   consDir,
+		SegID:     0x1234,
+		Timestamp: uint32(time.Now().Unix()),
+	}
+	hops := []path.HopField{
+		{ExpTime: 63, ConsIngress: 0, ConsEgress: 1},
+		{ExpTime: 63, ConsIngress: 2, ConsEgress: 3},
+		{ExpTime: 63, ConsIngress: 4, ConsEgress: 0},
+	}
+	if !consDir {
+		slices.Reverse(hops)
+	}
+	hops[currHF].Mac = path.MAC(hmac.New(sha256.New, testKey), info, hops[currHF], nil)
+	if !consDir && currHF != 0 {
+		// Against construction direction the ingress router updates the SegID before
+		// verification, so the packet carries the value before the update.
+		info.UpdateSegID(hops[currHF].Mac)
+	}
+
+	dec := &scion.Decoded{
+		Base: scion.Base{
+			PathMeta: scion.MetaHdr{CurrHF: currHF, SegLen: [3]uint8{3, 0, 0}},
+			NumINF:   1,
+			NumHops:  3,
+		},
+		InfoFields: []path.InfoField{info},
+		HopFields:  hops,
+	}
+	s := &slayers.SCION{
+		NextHdr:  slayers.L4UDP,
+		PathType: scion.PathType,
+		SrcIA:    src,
+		DstIA:    dst,
+		Path:     dec,
+	}
+	if err := s.SetSrcAddr(addr.MustParseHost("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDstAddr(addr.MustParseHost("10.0.0.2")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	udp := &slayers.UDP{SrcPort: 30041, DstPort: 30042}
+	if err := gopacket.SerializeLayers(buf, opts, s, udp, gopacket.Payload("payload")); err != nil {
+		t.Fatalf("serializing packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessPacketLinkValidation(t *testing.T) {
+	tests := map[string]struct {
+		consDir bool
+		ingress Interface
+		egress  Interface
+		wantErr bool
+	}{
+		"parent to child": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkParent, IA: srcIA},
+			egress:  Interface{LinkType: LinkChild, IA: dstIA},
+		},
+		"child to parent": {
+			consDir: false,
+			ingress: Interface{LinkType: LinkChild, IA: srcIA},
+			egress:  Interface{LinkType: LinkParent, IA: dstIA},
+		},
+		"core to core": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkCore, IA: srcIA},
+			egress:  Interface{LinkType: LinkCore, IA: dstIA},
+		},
+		"child ingress in construction direction": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkChild, IA: srcIA},
+			egress:  Interface{LinkType: LinkParent, IA: dstIA},
+			wantErr: true,
+		},
+		"parent ingress against construction direction": {
+			consDir: false,
+			ingress: Interface{LinkType: LinkParent, IA: srcIA},
+			egress:  Interface{LinkType: LinkChild, IA: dstIA},
+			wantErr: true,
+		},
+		"parent to parent": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkParent, IA: srcIA},
+			egress:  Interface{LinkType: LinkParent, IA: dstIA},
+			wantErr: true,
+		},
+		"core to child": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkCore, IA: srcIA},
+			egress:  Interface{LinkType: LinkChild, IA: dstIA},
+			wantErr: true,
+		},
+		"unset link type": {
+			consDir: true,
+			ingress: Interface{IA: srcIA},
+			egress:  Interface{LinkType: LinkChild, IA: dstIA},
+			wantErr: true,
+		},
+		"source IA mismatch": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkParent, IA: localIA},
+			egress:  Interface{LinkType: LinkChild, IA: dstIA},
+			wantErr: true,
+		},
+		"destination IA mismatch": {
+			consDir: true,
+			ingress: Interface{LinkType: LinkParent, IA: srcIA},
+			egress:  Interface{LinkType: LinkChild, IA: localIA},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRouter(testKey)
+			inID, outID := uint16(2), uint16(3)
+			if !tc.consDir {
+				inID, outID = outID, inID
+			}
+			r.AddInterface(inID, tc.ingress)
+			r.AddInterface(outID, tc.egress)
+
+			err := r.processPacket(newTestPacket(t, srcIA, dstIA, tc.consDir), inID)
+			stats, _ := r.QueueStats(outID)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("processPacket should return error")
+				}
+				if stats.Data.Enqueued != 0 {
+					t.Error("processPacket should not forward the packet")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+			if stats.Data.Enqueued != 1 {
+				t.Fatalf("processPacket should forward exactly one packet, got %d", stats.Data.Enqueued)
+			}
+		})
+	}
+}
+
+func TestProcessPacketLocal(t *testing.T) {
+	tests := map[string]struct {
+		consDir  bool
+		currHF   uint8
+		src, dst addr.IA
+		wantErr  bool
+	}{
+		"from local AS": {
+			consDir: true, currHF: 0, src: localIA, dst: dstIA,
+		},
+		"from local AS against construction direction": {
+			consDir: false, currHF: 0, src: localIA, dst: dstIA,
+		},
+		"to local AS": {
+			consDir: true, currHF: 2, src: srcIA, dst: localIA,
+		},
+		"to local AS against construction direction": {
+			consDir: false, currHF: 2, src: srcIA, dst: localIA,
+		},
+		"from foreign source": {
+			consDir: true, currHF: 0, src: srcIA, dst: dstIA, wantErr: true,
+		},
+		"to foreign destination": {
+			consDir: true, currHF: 2, src: srcIA, dst: dstIA, wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRouter(testKey)
+			r.AddInterface(InternalInterface, Interface{IA: localIA})
+			var inID, outID uint16
+			if tc.currHF == 0 {
+				outID = 1
+				if !tc.consDir {
+					outID = 4
+				}
+				r.AddInterface(outID, Interface{LinkType: LinkParent, IA: dstIA})
+			} else {
+				inID = 4
+				if !tc.consDir {
+					inID = 1
+				}
+				lt := LinkParent
+				if !tc.consDir {
+					lt = LinkChild
+				}
+				r.AddInterface(inID, Interface{LinkType: lt, IA: srcIA})
+			}
+
+			err := r.processPacket(newPathPacket(t, tc.src, tc.dst, tc.consDir, tc.currHF), inID)
+			stats, _ := r.QueueStats(outID)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("processPacket should return error")
+				}
+				if stats.Data.Enqueued != 0 {
+					t.Error("processPacket should not forward the packet")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPacket failed: %v", err)
+			}
+			if stats.Data.Enqueued != 1 {
+				t.Fatalf("processPacket should forward exactly one packet, got %d", stats.Data.Enqueued)
+			}
+		})
+	}
+}
+
+func TestHostAddr(t *testing.T) {
+	fallback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 30041}
+	pkt := newPathPacket(t, srcIA, localIA, true, 2)
+	got := hostAddr(pkt, fallback)
+	want := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 30042}
+	if got.String() != want.String() {
+		t.Errorf("hostAddr = %s, want %s", got, want)
+	}
+	if got := hostAddr(newOneHopPacket(t, srcIA, localIA, testKey), fallback); got != fallback {
+		t.Errorf("hostAddr of service address = %s, want %s", got, fallback)
+	}
+}
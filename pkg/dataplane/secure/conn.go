@@ -0,0 +1,486 @@
+// Package secure implements an encrypted underlay for inter-AS links.
+//
+// Both ends of a link authenticate an ephemeral X25519 key exchange with their AS keys. Handshake
+// messages are signed control plane messages, and the peer signature is verified with the AS
+// certificate found in the trust database. The derived session keys protect every SCION packet
+// with AES-GCM. Conn implements net.PacketConn, so the framing is transparent to the router.
+package secure
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/serrors"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+const (
+	msgInit     byte = 1
+	msgResponse byte = 2
+	msgData     byte = 3
+
+	// dataHdrLen is the length of the data header: type, session ID and counter.
+	dataHdrLen = 1 + 4 + 8
+	// bodyLen is the length of the signed handshake body: session ID, initiator IA,
+	// responder IA and the ephemeral public key.
+	bodyLen = 4 + 8 + 8 + 32
+	// windowSize is the number of counters tracked for replay protection.
+	windowSize = 64
+)
+
+var (
+	// DefaultRekeyAfter is the default age after which a new handshake is started.
+	DefaultRekeyAfter = 2 * time.Minute
+	// DefaultHandshakeTimeout is the default time after which a pending handshake is
+	// retransmitted.
+	DefaultHandshakeTimeout = time.Second
+	// DefaultMaxClockSkew is the default tolerance for handshake timestamps.
+	DefaultMaxClockSkew = 30 * time.Second
+
+	// ErrNoSession is returned by WriteTo when no session is established yet. A handshake is
+	// started in the background and the packet is dropped.
+	ErrNoSession = errors.New("no session established")
+
+	kdfInfo = "cion underlay v1"
+)
+
+// Signer signs handshake messages with the local AS key. trust.Signer implements it.
+type Signer interface {
+	Sign(ctx context.Context, msg []byte, associatedData ...[]byte) (*cryptopb.SignedMessage, error)
+}
+
+// Config configures an encrypted underlay connection.
+type Config struct {
+	// LocalIA is the ISD-AS of the local AS.
+	LocalIA addr.IA
+	// RemoteIA is the ISD-AS of the neighbour AS.
+	RemoteIA addr.IA
+	// RemoteAddr is the underlay address of the neighbour.
+	RemoteAddr net.Addr
+	// Signer signs the handshake messages with the local AS key.
+	Signer Signer
+	// DB provides the AS certificates used to verify the neighbour.
+	DB trust.DB
+
+	RekeyAfter       time.Duration
+	HandshakeTimeout time.Duration
+	MaxClockSkew     time.Duration
+}
+
+// InitDefaults initializes the default values for the config.
+func (cfg *Config) InitDefaults() {
+	if cfg.RekeyAfter == 0 {
+		cfg.RekeyAfter = DefaultRekeyAfter
+	}
+	if cfg.HandshakeTimeout == 0 {
+		cfg.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if cfg.MaxClockSkew == 0 {
+		cfg.MaxClockSkew = DefaultMaxClockSkew
+	}
+}
+
+type session struct {
+	id      uint32
+	created time.Time
+	send    cipher.AEAD
+	recv    cipher.AEAD
+	counter uint64
+
+	// Replay protection: highest counter received and a bitmap of the preceding counters.
+	highest uint64
+	window  uint64
+}
+
+type handshake struct {
+	id      uint32
+	key     *ecdh.PrivateKey
+	raw     []byte
+	started time.Time
+}
+
+// Conn is a net.PacketConn that encrypts all packets exchanged with a single neighbour.
+type Conn struct {
+	net.PacketConn
+	cfg Config
+
+	readMu sync.Mutex
+	rbuf   []byte
+
+	mu       sync.Mutex
+	current  *session
+	previous *session
+	pending  *handshake
+	// lastInit is the timestamp of the last accepted handshake initiation, used to reject
+	// replayed initiations.
+	lastInit time.Time
+}
+
+// NewConn wraps conn so that all packets exchanged with the neighbour are encrypted.
+func NewConn(conn net.PacketConn, cfg Config) *Conn {
+	cfg.InitDefaults()
+	return &Conn{
+		PacketConn: conn,
+		cfg:        cfg,
+	}
+}
+
+// WriteTo encrypts b and sends it to the neighbour. The address is ignored in favour of the
+// configured remote address.
+func (c *Conn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	c.mu.Lock()
+	s := c.current
+	now := time.Now()
+	if s == nil || now.Sub(s.created) > c.cfg.RekeyAfter {
+		c.startHandshake(now)
+	}
+	// Keep using an old session until the new one is established, but never beyond twice the
+	// rekey interval.
+	if s == nil || now.Sub(s.created) > 2*c.cfg.RekeyAfter {
+		c.mu.Unlock()
+		return 0, ErrNoSession
+	}
+	s.counter++
+	counter := s.counter
+	c.mu.Unlock()
+
+	pkt := make([]byte, dataHdrLen, dataHdrLen+len(b)+s.send.Overhead())
+	pkt[0] = msgData
+	binary.BigEndian.PutUint32(pkt[1:5], s.id)
+	binary.BigEndian.PutUint64(pkt[5:13], counter)
+	pkt = s.send.Seal(pkt, nonce(counter), b, pkt[:dataHdrLen])
+	if _, err := c.PacketConn.WriteTo(pkt, c.cfg.RemoteAddr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom reads the next data packet from the neighbour and decrypts it into b. Handshake
+// messages are handled internally and packets that fail authentication are dropped.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if need := len(b) + dataHdrLen + 16; len(c.rbuf) < need {
+		c.rbuf = make([]byte, need)
+	}
+	buf := c.rbuf
+	for {
+		n, from, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		switch buf[0] {
+		case msgInit:
+			c.handleInit(buf[1:n])
+		case msgResponse:
+			c.handleResponse(buf[1:n])
+		case msgData:
+			if m, ok := c.open(b, buf[:n]); ok {
+				return m, from, nil
+			}
+		}
+	}
+}
+
+// Handshake starts a handshake with the neighbour unless one is already in progress.
+func (c *Conn) Handshake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startHandshake(time.Now())
+}
+
+// startHandshake sends a handshake initiation. c.mu must be held.
+func (c *Conn) startHandshake(now time.Time) {
+	if c.pending != nil && now.Sub(c.pending.started) < c.cfg.HandshakeTimeout {
+		return
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	var idBuf [4]byte
+	if _, err := rand.Read(idBuf[:]); err != nil {
+		return
+	}
+	id := binary.BigEndian.Uint32(idBuf[:])
+	raw, err := c.sign(msgInit, encodeBody(id, c.cfg.LocalIA, c.cfg.RemoteIA, key.PublicKey()))
+	if err != nil {
+		return
+	}
+	c.pending = &handshake{id: id, key: key, raw: raw, started: now}
+	c.PacketConn.WriteTo(raw, c.cfg.RemoteAddr) //nolint:errcheck // retransmitted on timeout
+}
+
+func (c *Conn) handleInit(raw []byte) {
+	msg, err := c.verify(raw)
+	if err != nil {
+		return
+	}
+	id, initIA, respIA, peerKey, err := decodeBody(msg.Body)
+	if err != nil || !initIA.Equal(c.cfg.RemoteIA) || !respIA.Equal(c.cfg.LocalIA) {
+		return
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	resp, err := c.sign(msgResponse, encodeBody(id, c.cfg.LocalIA, c.cfg.RemoteIA, key.PublicKey()),
+		raw)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !msg.Header.Timestamp.After(c.lastInit) {
+		return
+	}
+	// On simultaneous initiation the handshake started by the lower ISD-AS wins. A handshake
+	// that timed out does not count, as its initiation may have been lost.
+	if c.pending != nil && time.Since(c.pending.started) < c.cfg.HandshakeTimeout &&
+		c.cfg.LocalIA < c.cfg.RemoteIA {
+		return
+	}
+	s, err := deriveSession(id, key, peerKey, slices.Concat([]byte{msgInit}, raw), resp, false)
+	if err != nil {
+		return
+	}
+	c.lastInit = msg.Header.Timestamp
+	c.pending = nil
+	c.install(s)
+	c.PacketConn.WriteTo(resp, c.cfg.RemoteAddr) //nolint:errcheck // initiator retransmits
+}
+
+func (c *Conn) handleResponse(raw []byte) {
+	c.mu.Lock()
+	pending := c.pending
+	c.mu.Unlock()
+	if pending == nil {
+		return
+	}
+	msg, err := c.verify(raw, pending.raw[1:])
+	if err != nil {
+		return
+	}
+	id, respIA, initIA, peerKey, err := decodeBody(msg.Body)
+	if err != nil || id != pending.id ||
+		!respIA.Equal(c.cfg.RemoteIA) || !initIA.Equal(c.cfg.LocalIA) {
+		return
+	}
+	s, err := deriveSession(id, pending.key, peerKey, pending.raw,
+		slices.Concat([]byte{msgResponse}, raw), true)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != pending {
+		return
+	}
+	c.pending = nil
+	c.install(s)
+}
+
+// install makes s the current session. c.mu must be held.
+func (c *Conn) install(s *session) {
+	c.previous, c.current = c.current, s
+}
+
+// open authenticates and decrypts the data packet in pkt into b.
+func (c *Conn) open(b, pkt []byte) (int, bool) {
+	if len(pkt) < dataHdrLen {
+		return 0, false
+	}
+	id := binary.BigEndian.Uint32(pkt[1:5])
+	counter := binary.BigEndian.Uint64(pkt[5:13])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var s *session
+	switch {
+	case c.current != nil && c.current.id == id:
+		s = c.current
+	case c.previous != nil && c.previous.id == id:
+		s = c.previous
+	default:
+		return 0, false
+	}
+	if !s.checkReplay(counter) {
+		return 0, false
+	}
+	out, err := s.recv.Open(b[:0], nonce(counter), pkt[dataHdrLen:], pkt[:dataHdrLen])
+	if err != nil {
+		return 0, false
+	}
+	s.markReplay(counter)
+	return len(out), true
+}
+
+// sign creates a signed handshake message of the given type.
+func (c *Conn) sign(typ byte, body []byte, associatedData ...[]byte) ([]byte, error) {
+	msg, err := c.cfg.Signer.Sign(context.Background(), body, associatedData...)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat([]byte{typ}, raw), nil
+}
+
+// verify verifies a signed handshake message with the neighbour AS certificate from the trust
+// database.
+func (c *Conn) verify(raw []byte, associatedData ...[]byte) (*signed.Message, error) {
+	var msg cryptopb.SignedMessage
+	if err := proto.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	hdr, err := signed.ExtractUnverifiedHeader(&msg)
+	if err != nil {
+		return nil, err
+	}
+	var keyID cppb.VerificationKeyID
+	if err := proto.Unmarshal(hdr.VerificationKeyID, &keyID); err != nil {
+		return nil, serrors.Wrap("parsing verification key ID", err)
+	}
+	if ia := addr.IA(keyID.IsdAs); !ia.Equal(c.cfg.RemoteIA) {
+		return nil, serrors.New("does not match neighbour ISD-AS",
+			"expected", c.cfg.RemoteIA, "actual", ia)
+	}
+	now := time.Now()
+	if d := now.Sub(hdr.Timestamp); d > c.cfg.MaxClockSkew || d < -c.cfg.MaxClockSkew {
+		return nil, serrors.New("handshake timestamp out of range", "timestamp", hdr.Timestamp)
+	}
+	chains, err := c.cfg.DB.Chains(context.Background(), trust.ChainQuery{
+		IA:           c.cfg.RemoteIA,
+		SubjectKeyID: keyID.SubjectKeyId,
+		Validity:     cppki.Validity{NotBefore: now, NotAfter: now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, chain := range chains {
+		if m, err := signed.Verify(&msg, chain[0].PublicKey, associatedData...); err == nil {
+			return m, nil
+		}
+	}
+	return nil, serrors.New("no chain in database can verify handshake",
+		"isd_as", c.cfg.RemoteIA, "subject_key_id", fmt.Sprintf("%x", keyID.SubjectKeyId))
+}
+
+func deriveSession(id uint32, key *ecdh.PrivateKey, peer *ecdh.PublicKey,
+	init, resp []byte, initiator bool) (*session, error) {
+
+	secret, err := key.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(init)
+	h.Write(resp)
+	keys, err := hkdf.Key(sha256.New, secret, h.Sum(nil), kdfInfo, 64)
+	if err != nil {
+		return nil, err
+	}
+	i2r, err := newAEAD(keys[:32])
+	if err != nil {
+		return nil, err
+	}
+	r2i, err := newAEAD(keys[32:])
+	if err != nil {
+		return nil, err
+	}
+	s := &session{id: id, created: time.Now(), send: r2i, recv: i2r}
+	if initiator {
+		s.send, s.recv = i2r, r2i
+	}
+	return s, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *session) checkReplay(counter uint64) bool {
+	switch {
+	case counter == 0:
+		return false
+	case counter > s.highest:
+		return true
+	case s.highest-counter >= windowSize:
+		return false
+	default:
+		return s.window&(1<<(s.highest-counter)) == 0
+	}
+}
+
+func (s *session) markReplay(counter uint64) {
+	if counter > s.highest {
+		shift := counter - s.highest
+		if shift >= windowSize {
+			s.window = 0
+		} else {
+			s.window <<= shift
+		}
+		s.highest = counter
+	}
+	s.window |= 1 << (s.highest - counter)
+}
+
+func nonce(counter uint64) []byte {
+	var n [12]byte
+	binary.BigEndian.PutUint64(n[4:], counter)
+	return n[:]
+}
+
+func encodeBody(id uint32, from, to addr.IA, key *ecdh.PublicKey) []byte {
+	b := make([]byte, bodyLen)
+	binary.BigEndian.PutUint32(b[0:4], id)
+	binary.BigEndian.PutUint64(b[4:12], uint64(from))
+	binary.BigEndian.PutUint64(b[12:20], uint64(to))
+	copy(b[20:], key.Bytes())
+	return b
+}
+
+func decodeBody(b []byte) (uint32, addr.IA, addr.IA, *ecdh.PublicKey, error) {
+	if len(b) != bodyLen {
+		return 0, 0, 0, nil, serrors.New("invalid handshake body length", "length", len(b))
+	}
+	key, err := ecdh.X25519().NewPublicKey(b[20:])
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint32(b[0:4]),
+		addr.IA(binary.BigEndian.Uint64(b[4:12])),
+		addr.IA(binary.BigEndian.Uint64(b[12:20])),
+		key, nil
+}
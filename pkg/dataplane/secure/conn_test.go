@@ -0,0 +1,267 @@
+package secure_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+
+	"github.com/fancl20/cion/pkg/dataplane/secure"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+)
+
+// newSigner creates an AS key with a chain issued by a fresh CA and inserts the chain into db.
+func newSigner(t *testing.T, db trust.DB, ia addr.IA) trust.Signer {
+	t.Helper()
+
+	subject := pkix.Name{
+		CommonName: ia.String(),
+		ExtraNames: []pkix.AttributeTypeAndValue{{Type: cppki.OIDNameIA, Value: ia.String()}},
+	}
+	now := time.Now()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               subject,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caRaw, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      subject,
+		SubjectKeyId: []byte(ia.String()),
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	asRaw, err := x509.CreateCertificate(rand.Reader, asTmpl, ca, asKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err := x509.ParseCertificate(asRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.InsertChain(context.Background(), []*x509.Certificate{as, ca}); err != nil {
+		t.Fatalf("InsertChain failed: %v", err)
+	}
+	return trust.Signer{
+		PrivateKey:   asKey,
+		Algorithm:    signed.ECDSAWithSHA256,
+		IA:           ia,
+		Subject:      subject,
+		Chain:        []*x509.Certificate{as, ca},
+		SubjectKeyID: as.SubjectKeyId,
+		Expiration:   as.NotAfter,
+	}
+}
+
+// readLoop forwards all decrypted packets read from conn to the returned channel.
+func readLoop(conn net.PacketConn) <-chan []byte {
+	ch := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				close(ch)
+				return
+			}
+			ch <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	return ch
+}
+
+func TestConn(t *testing.T) {
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatalf("failed to create trust database: %v", err)
+	}
+	defer db.Close()
+
+	iaA, iaB := addr.MustParseIA("1-ff00:0:110"), addr.MustParseIA("1-ff00:0:111")
+	signerA, signerB := newSigner(t, db, iaA), newSigner(t, db, iaB)
+
+	rawA, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawB, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := secure.NewConn(rawA, secure.Config{
+		LocalIA: iaA, RemoteIA: iaB, RemoteAddr: rawB.LocalAddr(), Signer: signerA, DB: db,
+		HandshakeTimeout: 50 * time.Millisecond,
+	})
+	b := secure.NewConn(rawB, secure.Config{
+		LocalIA: iaB, RemoteIA: iaA, RemoteAddr: rawA.LocalAddr(), Signer: signerB, DB: db,
+		HandshakeTimeout: 50 * time.Millisecond,
+	})
+	defer a.Close()
+	defer b.Close()
+	recvA, recvB := readLoop(a), readLoop(b)
+
+	// The first write triggers the handshake and is dropped.
+	if _, err := a.WriteTo([]byte("early"), nil); !errors.Is(err, secure.ErrNoSession) {
+		t.Fatalf("WriteTo before handshake should fail with ErrNoSession, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := a.WriteTo([]byte("ping"), nil)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, secure.ErrNoSession) || time.Now().After(deadline) {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case got := <-recvB:
+		if !bytes.Equal(got, []byte("ping")) {
+			t.Errorf("received %q, want %q", got, "ping")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+
+	// The responder can use the session right away.
+	if _, err := b.WriteTo([]byte("pong"), nil); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	select {
+	case got := <-recvA:
+		if !bytes.Equal(got, []byte("pong")) {
+			t.Errorf("received %q, want %q", got, "pong")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+
+	// Packets that are not encrypted with the session are dropped.
+	forged := []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'x'}
+	if _, err := rawA.WriteTo(forged, rawB.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.WriteTo([]byte("again"), nil); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	select {
+	case got := <-recvB:
+		if !bytes.Equal(got, []byte("again")) {
+			t.Errorf("received %q, want %q", got, "again")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+}
+
+// dropInitConn drops the first handshake initiations written to the connection.
+type dropInitConn struct {
+	net.PacketConn
+	drop atomic.Int32
+}
+
+func (c *dropInitConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > 0 && b[0] == 1 && c.drop.Add(-1) >= 0 {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestConnLostInit(t *testing.T) {
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatalf("failed to create trust database: %v", err)
+	}
+	defer db.Close()
+
+	iaA, iaB := addr.MustParseIA("1-ff00:0:110"), addr.MustParseIA("1-ff00:0:111")
+	signerA, signerB := newSigner(t, db, iaA), newSigner(t, db, iaB)
+
+	udpA, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawA := &dropInitConn{PacketConn: udpA}
+	rawA.drop.Store(1)
+	rawB, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := secure.NewConn(rawA, secure.Config{
+		LocalIA: iaA, RemoteIA: iaB, RemoteAddr: rawB.LocalAddr(), Signer: signerA, DB: db,
+		HandshakeTimeout: 50 * time.Millisecond,
+	})
+	b := secure.NewConn(rawB, secure.Config{
+		LocalIA: iaB, RemoteIA: iaA, RemoteAddr: udpA.LocalAddr(), Signer: signerB, DB: db,
+		HandshakeTimeout: 50 * time.Millisecond,
+	})
+	defer a.Close()
+	defer b.Close()
+	recvA := readLoop(a)
+	// The responses to the neighbour are handled by its read loop.
+	readLoop(b)
+
+	// The initiation of the lower ISD-AS is lost and never retransmitted, so the handshake
+	// started by the neighbour must win once it timed out.
+	a.Handshake()
+	time.Sleep(100 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := b.WriteTo([]byte("ping"), nil)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, secure.ErrNoSession) || time.Now().After(deadline) {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case got := <-recvA:
+		if !bytes.Equal(got, []byte("ping")) {
+			t.Errorf("received %q, want %q", got, "ping")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+}
@@ -0,0 +1,633 @@
+// Package discovery discovers the neighbour ASes on the direct links of the
+// local AS.
+//
+// Each AS periodically announces itself on every interface over a one-hop
+// path. An announcement is signed with the AS key and carries the certificate
+// chain of the AS, which is verified against the TRC of the neighbour's ISD.
+// Once the neighbour is known, the announcements also carry a one-hop beacon.
+// The receiver terminates the beacon, which turns the link into a path
+// segment to the neighbour, and echoes it back so that both ends of a
+// parent-child link obtain a segment.
+package discovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/log"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/onehop"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	// DefaultInterval is the default interval between two announcements.
+	DefaultInterval = 5 * time.Second
+	// DefaultPort is the default UDP port of the announcements.
+	DefaultPort uint16 = 30043
+	// MaxAnnouncementAge is the maximum age of an accepted announcement.
+	MaxAnnouncementAge = time.Minute
+)
+
+// Neighbor is a neighbour AS discovered on a direct link.
+type Neighbor struct {
+	// IA is the ISD-AS of the neighbour.
+	IA addr.IA
+	// RemoteID is the interface ID of the link in the neighbour AS.
+	RemoteID uint16
+	// Chain is the verified certificate chain of the neighbour.
+	Chain []*x509.Certificate
+	// LastSeen is the time the last announcement was received.
+	LastSeen time.Time
+}
+
+// Discovery announces the local AS on all interfaces and learns the
+// neighbours from their announcements.
+type Discovery struct {
+	// Extender creates the one-hop beacons. Its interfaces are the direct
+	// links, where the neighbour IA and remote ID may be unset.
+	Extender *beaconing.Extender
+	// Chain is the certificate chain of the local AS, which is sent with the
+	// announcements.
+	Chain []*x509.Certificate
+	// TrustDB provides the TRCs to verify the neighbour chains. Verified
+	// chains are inserted.
+	TrustDB trust.DB
+	// PathDB stores the one-hop segments.
+	PathDB pathdb.DB
+	// Conn is connected to the internal interface of the router.
+	Conn net.PacketConn
+	// Router is the address of the internal interface of the router.
+	Router net.Addr
+	// Port is the UDP port of the announcements. Zero means DefaultPort.
+	Port uint16
+	// Interval is the interval between two announcements. Zero means
+	// DefaultInterval.
+	Interval time.Duration
+
+	mu        sync.Mutex
+	neighbors map[uint16]Neighbor
+	// echoes are the terminated beacons of the neighbours, which are sent
+	// back to them with the next announcement.
+	echoes map[uint16]*seg.PathSegment
+}
+
+// Neighbors returns the discovered neighbours, keyed by the ID of the local
+// interface.
+func (d *Discovery) Neighbors() map[uint16]Neighbor {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return maps.Clone(d.neighbors)
+}
+
+// Run announces the local AS periodically and handles the announcements of
+// the neighbours. This function blocks until the context is canceled.
+func (d *Discovery) Run(ctx context.Context) error {
+	interval := d.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	stop := context.AfterFunc(ctx, func() { d.Conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := d.Announce(ctx); err != nil {
+				log.FromCtx(ctx).Error("Announcing", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := d.Conn.ReadFrom(buf)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("reading announcement: %w", err)
+		}
+		if err := d.handle(ctx, buf[:n]); err != nil {
+			log.FromCtx(ctx).Error("Handling announcement", "err", err)
+		}
+	}
+}
+
+// Announce sends an announcement on every interface.
+func (d *Discovery) Announce(ctx context.Context) error {
+	var errs []error
+	for _, id := range slices.Sorted(maps.Keys(d.Extender.Interfaces)) {
+		if err := d.announce(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("interface %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Discovery) announce(ctx context.Context, id uint16) error {
+	d.mu.Lock()
+	intf := d.intf(id)
+	echo := d.echoes[id]
+	d.mu.Unlock()
+
+	body := protowire.AppendTag(nil, 1, protowire.VarintType)
+	body = protowire.AppendVarint(body, uint64(id))
+	body = protowire.AppendTag(body, 2, protowire.VarintType)
+	body = protowire.AppendVarint(body, uint64(intf.IA))
+	// The beacon can only be created once the neighbour is known, because
+	// it must name the next AS.
+	if !intf.IA.IsZero() {
+		ps, err := seg.CreateSegment(time.Now(), uint16(rand.Uint32()))
+		if err != nil {
+			return fmt.Errorf("creating beacon: %w", err)
+		}
+		ext := *d.Extender
+		ext.Interfaces = map[uint16]controlplane.Interface{id: intf}
+		if err := ext.Extend(ctx, ps, 0, id, nil); err != nil {
+			return fmt.Errorf("extending beacon: %w", err)
+		}
+		body, err = appendSegment(body, 3, ps)
+		if err != nil {
+			return err
+		}
+	}
+	if echo != nil {
+		var err error
+		if body, err = appendSegment(body, 4, echo); err != nil {
+			return err
+		}
+	}
+	msg, err := d.Extender.Signer.Sign(ctx, body)
+	if err != nil {
+		return fmt.Errorf("signing announcement: %w", err)
+	}
+	rawMsg, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encoding announcement: %w", err)
+	}
+	payload := protowire.AppendTag(nil, 1, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, rawMsg)
+	if len(d.Chain) == 2 {
+		rawChain, err := proto.Marshal(&cppb.Chain{AsCert: d.Chain[0].Raw, CaCert: d.Chain[1].Raw})
+		if err != nil {
+			return fmt.Errorf("encoding chain: %w", err)
+		}
+		payload = protowire.AppendTag(payload, 2, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, rawChain)
+	}
+
+	pkt, err := d.packet(id, intf.IA, payload)
+	if err != nil {
+		return err
+	}
+	if _, err := d.Conn.WriteTo(pkt, d.Router); err != nil {
+		return fmt.Errorf("sending announcement: %w", err)
+	}
+	return nil
+}
+
+// packet creates a SCION/UDP packet on a one-hop path leaving the local AS on
+// the interface.
+func (d *Discovery) packet(id uint16, dst addr.IA, payload []byte) ([]byte, error) {
+	ohp := &onehop.Path{
+		Info: path.InfoField{
+			ConsDir:   true,
+			SegID:     uint16(rand.Uint32()),
+			Timestamp: uint32(time.Now().Unix()),
+		},
+		// The packet is only used once, the minimal expiration time is
+		// sufficient.
+		FirstHop: path.HopField{ConsEgress: id},
+	}
+	ohp.FirstHop.Mac = path.MAC(hmac.New(sha256.New, d.Extender.Key), ohp.Info, ohp.FirstHop, nil)
+
+	s := &slayers.SCION{
+		NextHdr:  slayers.L4UDP,
+		PathType: onehop.PathType,
+		SrcIA:    d.Extender.IA,
+		DstIA:    dst,
+		Path:     ohp,
+	}
+	if err := s.SetDstAddr(addr.HostSVC(addr.SvcCS)); err != nil {
+		return nil, err
+	}
+	local, ok := d.Conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unsupported local address %s", d.Conn.LocalAddr())
+	}
+	if err := s.SetSrcAddr(addr.HostIP(local.AddrPort().Addr().Unmap())); err != nil {
+		return nil, err
+	}
+	udp := &slayers.UDP{SrcPort: d.port(), DstPort: d.port()}
+	udp.SetNetworkLayerForChecksum(s)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, s, udp, gopacket.Payload(payload)); err != nil {
+		return nil, fmt.Errorf("serializing packet: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// handle verifies an announcement received from the router and records the
+// neighbour.
+func (d *Discovery) handle(ctx context.Context, data []byte) error {
+	var s slayers.SCION
+	var udp slayers.UDP
+	if err := s.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return fmt.Errorf("decoding SCION header: %w", err)
+	}
+	ohp, ok := s.Path.(*onehop.Path)
+	if !ok {
+		return fmt.Errorf("unexpected path type %s", s.PathType)
+	}
+	if s.NextHdr != slayers.L4UDP {
+		return fmt.Errorf("unexpected next header %s", s.NextHdr)
+	}
+	if err := udp.DecodeFromBytes(s.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return fmt.Errorf("decoding UDP header: %w", err)
+	}
+	if udp.DstPort != d.port() {
+		return fmt.Errorf("unexpected port %d", udp.DstPort)
+	}
+
+	// The second hop field was filled in by the local router and identifies
+	// the interface on which the announcement arrived.
+	ingress := ohp.SecondHop.ConsIngress
+	mac := path.MAC(hmac.New(sha256.New, d.Extender.Key), ohp.Info, ohp.SecondHop, nil)
+	if !hmac.Equal(mac[:], ohp.SecondHop.Mac[:]) {
+		return fmt.Errorf("MAC mismatch (one-hop second hop)")
+	}
+	intf, ok := d.Extender.Interfaces[ingress]
+	if !ok || ingress == dataplane.InternalInterface {
+		return fmt.Errorf("ingress interface %d not found", ingress)
+	}
+	if !intf.IA.IsZero() && !intf.IA.Equal(s.SrcIA) {
+		return fmt.Errorf("source IA %s does not match neighbour IA %s", s.SrcIA, intf.IA)
+	}
+
+	a, err := decodeAnnouncement(udp.Payload)
+	if err != nil {
+		return err
+	}
+	chain, err := d.verifyChain(ctx, s.SrcIA, a.chain)
+	if err != nil {
+		return err
+	}
+	msg, err := signed.Verify(a.msg, chain[0].PublicKey)
+	if err != nil {
+		return fmt.Errorf("verifying announcement: %w", err)
+	}
+	if age := time.Since(msg.Header.Timestamp); age > MaxAnnouncementAge || age < -MaxAnnouncementAge {
+		return fmt.Errorf("announcement timestamp %s out of range", msg.Header.Timestamp)
+	}
+	body, err := decodeBody(msg.Body)
+	if err != nil {
+		return err
+	}
+	if body.egress != ohp.FirstHop.ConsEgress {
+		return fmt.Errorf("announced interface %d does not match path interface %d",
+			body.egress, ohp.FirstHop.ConsEgress)
+	}
+	if !body.next.IsZero() && !body.next.Equal(d.Extender.IA) {
+		return fmt.Errorf("announcement is for %s", body.next)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.neighbors == nil {
+		d.neighbors = make(map[uint16]Neighbor)
+		d.echoes = make(map[uint16]*seg.PathSegment)
+	}
+	d.neighbors[ingress] = Neighbor{
+		IA:       s.SrcIA,
+		RemoteID: body.egress,
+		Chain:    chain,
+		LastSeen: time.Now(),
+	}
+	if _, err := d.TrustDB.InsertChain(ctx, chain); err != nil {
+		return fmt.Errorf("inserting chain: %w", err)
+	}
+
+	verifier := chainVerifier{chain: chain}
+	if body.beacon != nil {
+		if err := d.handleBeacon(ctx, ingress, verifier, body.beacon); err != nil {
+			return err
+		}
+	}
+	if body.echo != nil {
+		if err := d.handleEcho(ctx, ingress, verifier, body.echo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleBeacon terminates the one-hop beacon of the neighbour. The resulting
+// segment is echoed back to the neighbour and, unless the neighbour is a
+// child, published as a segment towards the neighbour. Must be called with
+// the lock held.
+func (d *Discovery) handleBeacon(ctx context.Context, ingress uint16,
+	verifier chainVerifier, pb *cppb.PathSegment) error {
+
+	ps, err := seg.BeaconFromPB(pb)
+	if err != nil {
+		return fmt.Errorf("parsing beacon: %w", err)
+	}
+	n := d.neighbors[ingress]
+	if len(ps.ASEntries) != 1 {
+		return fmt.Errorf("beacon with %d AS entries", len(ps.ASEntries))
+	}
+	entry := ps.ASEntries[0]
+	switch {
+	case !entry.Local.Equal(n.IA):
+		return fmt.Errorf("beacon originated by %s", entry.Local)
+	case !entry.Next.Equal(d.Extender.IA):
+		return fmt.Errorf("beacon for %s", entry.Next)
+	case entry.HopEntry.HopField.ConsEgress != n.RemoteID:
+		return fmt.Errorf("beacon leaves on interface %d", entry.HopEntry.HopField.ConsEgress)
+	case time.Now().After(ps.MaxExpiry()):
+		return fmt.Errorf("beacon expired")
+	}
+	if err := ps.VerifyASEntry(ctx, verifier, 0); err != nil {
+		return fmt.Errorf("verifying beacon: %w", err)
+	}
+
+	ext := *d.Extender
+	ext.Interfaces = map[uint16]controlplane.Interface{ingress: d.intf(ingress)}
+	if err := ext.Extend(ctx, ps, ingress, 0, nil); err != nil {
+		return fmt.Errorf("terminating beacon: %w", err)
+	}
+	d.echoes[ingress] = ps
+
+	var typ seg.Type
+	switch d.intf(ingress).LinkType {
+	case dataplane.LinkParent, dataplane.LinkPeer:
+		typ = seg.TypeUp
+	case dataplane.LinkCore:
+		typ = seg.TypeCore
+	default:
+		return nil
+	}
+	if _, err := d.PathDB.Insert(ctx, &seg.Meta{Segment: ps, Type: typ}); err != nil {
+		return fmt.Errorf("inserting segment: %w", err)
+	}
+	return nil
+}
+
+// handleEcho verifies the segment created from the local beacon by the
+// neighbour and publishes it as a segment towards a child. Must be called
+// with the lock held.
+func (d *Discovery) handleEcho(ctx context.Context, ingress uint16,
+	verifier chainVerifier, pb *cppb.PathSegment) error {
+
+	if d.intf(ingress).LinkType != dataplane.LinkChild {
+		return nil
+	}
+	ps, err := seg.SegmentFromPB(pb)
+	if err != nil {
+		return fmt.Errorf("parsing echoed segment: %w", err)
+	}
+	n := d.neighbors[ingress]
+	if len(ps.ASEntries) != 2 {
+		return fmt.Errorf("echoed segment with %d AS entries", len(ps.ASEntries))
+	}
+	first, last := ps.ASEntries[0], ps.ASEntries[1]
+	switch {
+	case !first.Local.Equal(d.Extender.IA):
+		return fmt.Errorf("echoed segment originated by %s", first.Local)
+	case !last.Local.Equal(n.IA):
+		return fmt.Errorf("echoed segment terminated by %s", last.Local)
+	case first.HopEntry.HopField.ConsEgress != ingress:
+		return fmt.Errorf("echoed segment leaves on interface %d",
+			first.HopEntry.HopField.ConsEgress)
+	case time.Now().After(ps.MaxExpiry()):
+		return fmt.Errorf("echoed segment expired")
+	}
+	// The own hop field authenticates the origin of the segment.
+	hop := first.HopEntry.HopField
+	mac := path.MAC(hmac.New(sha256.New, d.Extender.Key),
+		path.InfoField{SegID: ps.Info.SegmentID, Timestamp: uint32(ps.Info.Timestamp.Unix())},
+		path.HopField{ExpTime: hop.ExpTime, ConsIngress: hop.ConsIngress, ConsEgress: hop.ConsEgress},
+		nil)
+	if !hmac.Equal(mac[:], hop.MAC[:]) {
+		return fmt.Errorf("MAC mismatch (echoed segment)")
+	}
+	if err := ps.VerifyASEntry(ctx, verifier, 1); err != nil {
+		return fmt.Errorf("verifying echoed segment: %w", err)
+	}
+	if _, err := d.PathDB.Insert(ctx, &seg.Meta{Segment: ps, Type: seg.TypeDown}); err != nil {
+		return fmt.Errorf("inserting segment: %w", err)
+	}
+	return nil
+}
+
+// verifyChain verifies the chain of the neighbour against the active TRCs of
+// its ISD.
+func (d *Discovery) verifyChain(ctx context.Context, ia addr.IA,
+	pb *cppb.Chain) ([]*x509.Certificate, error) {
+
+	if pb == nil {
+		return nil, fmt.Errorf("announcement without chain")
+	}
+	var chain []*x509.Certificate
+	for _, raw := range [][]byte{pb.AsCert, pb.CaCert} {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing chain: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	certIA, err := cppki.ExtractIA(chain[0].Subject)
+	if err != nil {
+		return nil, fmt.Errorf("extracting ISD-AS from chain: %w", err)
+	}
+	if !certIA.Equal(ia) {
+		return nil, fmt.Errorf("chain of %s used by %s", certIA, ia)
+	}
+	if err := (trust.ChainVerifier{DB: d.TrustDB}).Verify(ctx, chain, time.Now()); err != nil {
+		return nil, fmt.Errorf("verifying chain of %s: %w", ia, err)
+	}
+	return chain, nil
+}
+
+// intf returns the interface completed with the discovered neighbour. Must be
+// called with the lock held.
+func (d *Discovery) intf(id uint16) controlplane.Interface {
+	intf := d.Extender.Interfaces[id]
+	if n, ok := d.neighbors[id]; ok {
+		if intf.IA.IsZero() {
+			intf.IA = n.IA
+		}
+		if intf.RemoteID == 0 {
+			intf.RemoteID = n.RemoteID
+		}
+	}
+	return intf
+}
+
+func (d *Discovery) port() uint16 {
+	if d.Port == 0 {
+		return DefaultPort
+	}
+	return d.Port
+}
+
+// chainVerifier verifies the AS entry signatures with the key of a chain.
+type chainVerifier struct {
+	chain []*x509.Certificate
+}
+
+func (v chainVerifier) Verify(_ context.Context, msg *cryptopb.SignedMessage,
+	associatedData ...[]byte) (*signed.Message, error) {
+
+	return signed.Verify(msg, v.chain[0].PublicKey, associatedData...)
+}
+
+// announcement is the payload of an announcement. It consists of the signed
+// body (field 1) and the certificate chain of the sender (field 2).
+type announcement struct {
+	msg   *cryptopb.SignedMessage
+	chain *cppb.Chain
+}
+
+// body is the signed body of an announcement. It consists of the local
+// interface of the sender (field 1), the neighbour IA if known (field 2), the
+// one-hop beacon (field 3) and the echoed segment (field 4).
+type body struct {
+	egress uint16
+	next   addr.IA
+	beacon *cppb.PathSegment
+	echo   *cppb.PathSegment
+}
+
+func decodeAnnouncement(b []byte) (announcement, error) {
+	var a announcement
+	err := decodeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			a.msg = &cryptopb.SignedMessage{}
+			return proto.Unmarshal(v, a.msg)
+		case 2:
+			a.chain = &cppb.Chain{}
+			return proto.Unmarshal(v, a.chain)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return announcement{}, fmt.Errorf("decoding announcement: %w", err)
+	}
+	if a.msg == nil {
+		return announcement{}, fmt.Errorf("announcement without signed body")
+	}
+	return a, nil
+}
+
+func decodeBody(b []byte) (body, error) {
+	var bd body
+	err := decodeFields(b, func(num protowire.Number, v []byte) error {
+		var pb *cppb.PathSegment
+		switch num {
+		case 3:
+			bd.beacon = &cppb.PathSegment{}
+			pb = bd.beacon
+		case 4:
+			bd.echo = &cppb.PathSegment{}
+			pb = bd.echo
+		default:
+			return nil
+		}
+		return proto.Unmarshal(v, pb)
+	}, func(num protowire.Number, v uint64) {
+		switch num {
+		case 1:
+			bd.egress = uint16(v)
+		case 2:
+			bd.next = addr.IA(v)
+		}
+	})
+	if err != nil {
+		return body{}, fmt.Errorf("decoding announcement body: %w", err)
+	}
+	return bd, nil
+}
+
+// decodeFields calls bytesFn and varintFn for the fields of the encoded
+// message. Fields of other types are skipped.
+func decodeFields(b []byte, bytesFn func(protowire.Number, []byte) error,
+	varintFn func(protowire.Number, uint64)) error {
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := bytesFn(num, v); err != nil {
+				return err
+			}
+			b = b[n:]
+		case typ == protowire.VarintType && varintFn != nil:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			varintFn(num, v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+func appendSegment(b []byte, num protowire.Number, ps *seg.PathSegment) ([]byte, error) {
+	raw, err := proto.Marshal(seg.PathSegmentToPB(ps))
+	if err != nil {
+		return nil, fmt.Errorf("encoding segment: %w", err)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, raw), nil
+}
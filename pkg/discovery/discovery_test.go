@@ -0,0 +1,227 @@
+package discovery_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/beaconing"
+	"github.com/fancl20/cion/pkg/controlplane"
+	"github.com/fancl20/cion/pkg/dataplane"
+	"github.com/fancl20/cion/pkg/discovery"
+	"github.com/fancl20/cion/pkg/pathdb"
+	pathbbolt "github.com/fancl20/cion/pkg/pathdb/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust"
+	trustbbolt "github.com/fancl20/cion/pkg/trust/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+var (
+	parentIA = addr.MustParseIA("1-ff00:0:110")
+	childIA  = addr.MustParseIA("1-ff00:0:111")
+)
+
+// node is an AS with a router and a discovery service.
+type node struct {
+	disc    *discovery.Discovery
+	pathDB  pathdb.DB
+	trustDB trust.DB
+}
+
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newNode starts an AS with a single link. The link connects to the peer
+// address, and the neighbour is configured in the data plane and the control
+// plane if neighbor is non-zero. The TRCs are inserted into the trust DB in
+// order.
+func newNode(t *testing.T, ctx context.Context, trcs []cppki.SignedTRC, signer trust.Signer,
+	id uint16, link net.PacketConn, peer net.Addr, lt dataplane.LinkType,
+	neighbor addr.IA) *node {
+
+	t.Helper()
+	key := []byte(signer.IA.String() + "-key")
+	trustDB, err := trustbbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustDB.Close() })
+	for _, trc := range trcs {
+		if _, err := (trust.TRCVerifier{DB: trustDB}).Insert(ctx, trc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pathDB, err := pathbbolt.New(filepath.Join(t.TempDir(), "path.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pathDB.Close() })
+
+	internal, conn := listen(t), listen(t)
+	r := dataplane.NewRouter(key)
+	r.AddInterface(dataplane.InternalInterface, dataplane.Interface{
+		Conn:       internal,
+		RemoteAddr: conn.LocalAddr(),
+		IA:         signer.IA,
+	})
+	r.AddInterface(id, dataplane.Interface{
+		Conn:       link,
+		RemoteAddr: peer,
+		LinkType:   lt,
+		IA:         neighbor,
+	})
+	go r.Run(ctx)
+
+	n := &node{
+		disc: &discovery.Discovery{
+			Extender: &beaconing.Extender{
+				IA: signer.IA,
+				Interfaces: map[uint16]controlplane.Interface{
+					id: {IA: neighbor, LinkType: lt, MTU: 1400},
+				},
+				Key:    key,
+				Signer: signer,
+			},
+			Chain:    signer.Chain,
+			TrustDB:  trustDB,
+			PathDB:   pathDB,
+			Conn:     conn,
+			Router:   internal.LocalAddr(),
+			Interval: 50 * time.Millisecond,
+		},
+		pathDB:  pathDB,
+		trustDB: trustDB,
+	}
+	go n.disc.Run(ctx)
+	return n
+}
+
+func (n *node) segments(t *testing.T, typ seg.Type) []*seg.Meta {
+	t.Helper()
+	metas, err := n.pathDB.Get(context.Background(), pathdb.Query{SegTypes: []seg.Type{typ}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metas
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	isd := trusttest.NewISD(t, parentIA, childIA)
+
+	parentLink, childLink := listen(t), listen(t)
+	// The parent is configured with the child, but the child does not know its
+	// parent in advance.
+	parent := newNode(t, ctx, []cppki.SignedTRC{isd.TRC}, isd.Signer(parentIA), 1, parentLink, childLink.LocalAddr(),
+		dataplane.LinkChild, childIA)
+	child := newNode(t, ctx, []cppki.SignedTRC{isd.TRC}, isd.Signer(childIA), 2, childLink, parentLink.LocalAddr(),
+		dataplane.LinkParent, 0)
+
+	waitFor(t, func() bool {
+		return len(child.segments(t, seg.TypeUp)) > 0 && len(parent.segments(t, seg.TypeDown)) > 0
+	})
+
+	if n := child.disc.Neighbors()[2]; !n.IA.Equal(parentIA) || n.RemoteID != 1 {
+		t.Errorf("child learned neighbour %s#%d, want %s#1", n.IA, n.RemoteID, parentIA)
+	}
+	if n := parent.disc.Neighbors()[1]; !n.IA.Equal(childIA) || n.RemoteID != 2 {
+		t.Errorf("parent learned neighbour %s#%d, want %s#2", n.IA, n.RemoteID, childIA)
+	}
+	for name, metas := range map[string][]*seg.Meta{
+		"up":   child.segments(t, seg.TypeUp),
+		"down": parent.segments(t, seg.TypeDown),
+	} {
+		ps := metas[0].Segment
+		if !ps.FirstIA().Equal(parentIA) || !ps.LastIA().Equal(childIA) {
+			t.Errorf("%s segment %s -> %s, want %s -> %s",
+				name, ps.FirstIA(), ps.LastIA(), parentIA, childIA)
+		}
+		if hop := ps.ASEntries[0].HopEntry.HopField; hop.ConsEgress != 1 {
+			t.Errorf("%s segment leaves parent on interface %d, want 1", name, hop.ConsEgress)
+		}
+		if hop := ps.ASEntries[1].HopEntry.HopField; hop.ConsIngress != 2 {
+			t.Errorf("%s segment enters child on interface %d, want 2", name, hop.ConsIngress)
+		}
+	}
+	chains, err := child.trustDB.Chains(ctx, trust.ChainQuery{IA: parentIA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 {
+		t.Errorf("child stored %d chains of the parent, want 1", len(chains))
+	}
+}
+
+func TestDiscoveryUntrusted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	isd := trusttest.NewISD(t, parentIA, childIA)
+	// The rogue child has a chain for the same ISD-AS that is not issued under
+	// the TRC known to the parent.
+	rogue := trusttest.NewISD(t, parentIA, childIA)
+
+	parentLink, childLink := listen(t), listen(t)
+	parent := newNode(t, ctx, []cppki.SignedTRC{isd.TRC}, isd.Signer(parentIA), 1, parentLink, childLink.LocalAddr(),
+		dataplane.LinkChild, 0)
+	child := newNode(t, ctx, []cppki.SignedTRC{isd.TRC}, rogue.Signer(childIA), 2, childLink, parentLink.LocalAddr(),
+		dataplane.LinkParent, 0)
+
+	// The child learns the parent, so the rogue announcements must have
+	// reached the parent a few times as well.
+	waitFor(t, func() bool { return len(child.disc.Neighbors()) > 0 })
+	time.Sleep(200 * time.Millisecond)
+	if n, ok := parent.disc.Neighbors()[1]; ok {
+		t.Errorf("parent learned untrusted neighbour %s", n.IA)
+	}
+	if metas := parent.segments(t, seg.TypeDown); len(metas) != 0 {
+		t.Errorf("parent stored %d down segments, want 0", len(metas))
+	}
+}
+
+func TestDiscoveryGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	isd := trusttest.NewISD(t, parentIA, childIA)
+	base := isd.TRC
+	// The child still uses the chain issued under the base TRC, which is only
+	// valid during the grace period of the update.
+	childSigner := isd.Signer(childIA)
+	update := isd.Update(t, cppki.SensitiveUpdate, time.Now().Add(-10*time.Minute), time.Hour)
+	trcs := []cppki.SignedTRC{base, update}
+
+	parentLink, childLink := listen(t), listen(t)
+	parent := newNode(t, ctx, trcs, isd.Signer(parentIA), 1, parentLink, childLink.LocalAddr(),
+		dataplane.LinkChild, 0)
+	newNode(t, ctx, trcs, childSigner, 2, childLink, parentLink.LocalAddr(),
+		dataplane.LinkParent, 0)
+
+	waitFor(t, func() bool { return len(parent.disc.Neighbors()) > 0 })
+	if n := parent.disc.Neighbors()[1]; !n.IA.Equal(childIA) {
+		t.Errorf("parent learned neighbour %s, want %s", n.IA, childIA)
+	}
+}
@@ -0,0 +1,63 @@
+package pathdb
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/scionproto/scion/pkg/addr"
+	seg "github.com/scionproto/scion/pkg/segment"
+)
+
+// Query identifies a set of path segments that need to be looked up. Empty
+// fields do not restrict the result.
+type Query struct {
+	// SegIDs are the IDs of the segments.
+	SegIDs [][]byte
+	// SegTypes are the types of the segments.
+	SegTypes []seg.Type
+	// StartsAt are the ISD-AS identifiers of the first AS entry of the
+	// segments. Wildcard identifiers are allowed.
+	StartsAt []addr.IA
+	// EndsAt are the ISD-AS identifiers of the last AS entry of the segments.
+	// Wildcard identifiers are allowed.
+	EndsAt []addr.IA
+}
+
+// Match reports whether the segment fulfills the query.
+func (q Query) Match(m *seg.Meta) bool {
+	if len(q.SegIDs) != 0 && !slices.ContainsFunc(q.SegIDs, func(id []byte) bool {
+		return bytes.Equal(id, m.Segment.ID())
+	}) {
+		return false
+	}
+	if len(q.SegTypes) != 0 && !slices.Contains(q.SegTypes, m.Type) {
+		return false
+	}
+	if len(q.StartsAt) != 0 && !slices.ContainsFunc(q.StartsAt, matchIA(m.Segment.FirstIA())) {
+		return false
+	}
+	if len(q.EndsAt) != 0 && !slices.ContainsFunc(q.EndsAt, matchIA(m.Segment.LastIA())) {
+		return false
+	}
+	return true
+}
+
+func matchIA(ia addr.IA) func(addr.IA) bool {
+	return func(pattern addr.IA) bool {
+		return (pattern.ISD() == 0 || pattern.ISD() == ia.ISD()) &&
+			(pattern.AS() == 0 || pattern.AS() == ia.AS())
+	}
+}
+
+// DB is the database interface for path segments.
+type DB interface {
+	// Get looks up all segments that match the query.
+	Get(context.Context, Query) ([]*seg.Meta, error)
+	// Insert inserts the given segment. A segment with the same ID and type
+	// is replaced if the given segment is more recent. Returns true if the
+	// segment was inserted or replaced an older one.
+	Insert(context.Context, *seg.Meta) (bool, error)
+
+	Close() error
+}
@@ -0,0 +1,253 @@
+package bbolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fancl20/cion/pkg/pathdb"
+
+	"github.com/scionproto/scion/pkg/addr"
+	cppb "github.com/scionproto/scion/pkg/proto/control_plane"
+	seg "github.com/scionproto/scion/pkg/segment"
+	"go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+// The segments are stored in the "segments" bucket keyed by type and segment
+// ID. The "starts", "ends" and "expiry" buckets index the segments by the
+// first ISD-AS, the last ISD-AS and the expiration time respectively.
+var (
+	segmentsBucket = []byte("segments")
+	startsBucket   = []byte("starts")
+	endsBucket     = []byte("ends")
+	expiryBucket   = []byte("expiry")
+)
+
+type bboltDB struct {
+	db *bbolt.DB
+}
+
+func New(path string, opts *bbolt.Options) (pathdb.DB, error) {
+	db, err := bbolt.Open(path, 0600, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, s := range [][]byte{segmentsBucket, startsBucket, endsBucket, expiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &bboltDB{
+		db: db,
+	}, nil
+}
+
+// Get looks up all segments that match the query. Expired segments are never
+// returned.
+func (b *bboltDB) Get(ctx context.Context, query pathdb.Query) ([]*seg.Meta, error) {
+	now := time.Now()
+	var metas []*seg.Meta
+	if err := b.db.View(func(tx *bbolt.Tx) error {
+		segments := tx.Bucket(segmentsBucket)
+		for _, key := range candidates(tx, query) {
+			v := segments.Get(key)
+			if v == nil {
+				continue
+			}
+			ps, err := decodeSegment(v)
+			if err != nil {
+				return err
+			}
+			m := &seg.Meta{Type: seg.Type(key[0]), Segment: ps}
+			if ps.MinExpiry().After(now) && query.Match(m) {
+				metas = append(metas, m)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
+// Insert inserts the given segment. Expired segments are removed from the DB
+// on every insert.
+func (b *bboltDB) Insert(ctx context.Context, m *seg.Meta) (bool, error) {
+	now := time.Now()
+	if m.Segment.MinExpiry().Before(now) {
+		return false, nil
+	}
+	raw, err := proto.Marshal(seg.PathSegmentToPB(m.Segment))
+	if err != nil {
+		return false, fmt.Errorf("encoding segment: %w", err)
+	}
+
+	var inserted bool
+	if err := b.db.Update(func(tx *bbolt.Tx) error {
+		if err := deleteExpired(tx, now); err != nil {
+			return err
+		}
+		key := segmentKey(m.Type, m.Segment.ID())
+		if v := tx.Bucket(segmentsBucket).Get(key); v != nil {
+			existing, err := decodeSegment(v)
+			if err != nil {
+				return err
+			}
+			if !m.Segment.Info.Timestamp.After(existing.Info.Timestamp) {
+				return nil
+			}
+			if err := deleteSegment(tx, key, existing); err != nil {
+				return err
+			}
+		}
+		inserted = true
+		return putSegment(tx, key, m.Segment, raw)
+	}); err != nil {
+		return false, err
+	}
+	return inserted, nil
+}
+
+func (b *bboltDB) Close() error {
+	return b.db.Close()
+}
+
+// candidates returns the keys of the segments that potentially match the
+// query, using the most selective index available.
+func candidates(tx *bbolt.Tx, query pathdb.Query) [][]byte {
+	types := query.SegTypes
+	if len(types) == 0 {
+		types = []seg.Type{seg.TypeUp, seg.TypeDown, seg.TypeCore}
+	}
+	if len(query.SegIDs) != 0 {
+		var keys [][]byte
+		for _, id := range query.SegIDs {
+			for _, t := range types {
+				keys = append(keys, segmentKey(t, id))
+			}
+		}
+		return keys
+	}
+
+	var index *bbolt.Bucket
+	var ias []addr.IA
+	switch {
+	case len(query.StartsAt) != 0:
+		index, ias = tx.Bucket(startsBucket), query.StartsAt
+	case len(query.EndsAt) != 0:
+		index, ias = tx.Bucket(endsBucket), query.EndsAt
+	default:
+		var keys [][]byte
+		c := tx.Bucket(segmentsBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, slices.Clone(k))
+		}
+		return keys
+	}
+	var keys [][]byte
+	for _, ia := range ias {
+		prefix := iaPrefix(ia)
+		c := index.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			key := slices.Clone(k[8:])
+			if !slices.ContainsFunc(keys, func(o []byte) bool { return bytes.Equal(o, key) }) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func putSegment(tx *bbolt.Tx, key []byte, ps *seg.PathSegment, raw []byte) error {
+	if err := tx.Bucket(segmentsBucket).Put(key, raw); err != nil {
+		return err
+	}
+	if err := tx.Bucket(startsBucket).Put(indexKey(ps.FirstIA(), key), nil); err != nil {
+		return err
+	}
+	if err := tx.Bucket(endsBucket).Put(indexKey(ps.LastIA(), key), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(expiryBucket).Put(expiryKey(ps.MinExpiry(), key), nil)
+}
+
+func deleteSegment(tx *bbolt.Tx, key []byte, ps *seg.PathSegment) error {
+	if err := tx.Bucket(segmentsBucket).Delete(key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(startsBucket).Delete(indexKey(ps.FirstIA(), key)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(endsBucket).Delete(indexKey(ps.LastIA(), key)); err != nil {
+		return err
+	}
+	return tx.Bucket(expiryBucket).Delete(expiryKey(ps.MinExpiry(), key))
+}
+
+// deleteExpired removes all segments that expired before now.
+func deleteExpired(tx *bbolt.Tx, now time.Time) error {
+	var expired [][]byte
+	c := tx.Bucket(expiryBucket).Cursor()
+	for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) < now.Unix(); k, _ = c.Next() {
+		expired = append(expired, slices.Clone(k[8:]))
+	}
+	for _, key := range expired {
+		v := tx.Bucket(segmentsBucket).Get(key)
+		if v == nil {
+			continue
+		}
+		ps, err := decodeSegment(v)
+		if err != nil {
+			return err
+		}
+		if err := deleteSegment(tx, key, ps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeSegment(raw []byte) (*seg.PathSegment, error) {
+	var pb cppb.PathSegment
+	if err := proto.Unmarshal(raw, &pb); err != nil {
+		return nil, err
+	}
+	return seg.SegmentFromPB(&pb)
+}
+
+func segmentKey(t seg.Type, id []byte) []byte {
+	return slices.Concat([]byte{byte(t)}, id)
+}
+
+func indexKey(ia addr.IA, key []byte) []byte {
+	return slices.Concat(binary.BigEndian.AppendUint64(nil, uint64(ia)), key)
+}
+
+func expiryKey(t time.Time, key []byte) []byte {
+	return slices.Concat(binary.BigEndian.AppendUint64(nil, uint64(t.Unix())), key)
+}
+
+// iaPrefix returns the prefix of the index keys matching the ISD-AS. Wildcard
+// ISD-AS identifiers result in shorter prefixes.
+func iaPrefix(ia addr.IA) []byte {
+	raw := binary.BigEndian.AppendUint64(nil, uint64(ia))
+	switch {
+	case ia.ISD() == 0:
+		return nil
+	case ia.AS() == 0:
+		return raw[:2]
+	default:
+		return raw
+	}
+}
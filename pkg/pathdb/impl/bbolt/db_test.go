@@ -0,0 +1,27 @@
+package bbolt_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/pathdb/impl/bbolt"
+	"github.com/fancl20/cion/pkg/pathdb/impl/dbtest"
+)
+
+type testDB struct {
+	pathdb.DB
+}
+
+func (db *testDB) Prepare(t *testing.T, ctx context.Context) {
+	b, err := bbolt.New(filepath.Join(t.TempDir(), "test.db"), nil)
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	db.DB = b
+}
+
+func TestDB(t *testing.T) {
+	dbtest.Run(t, &testDB{}, dbtest.Config{})
+}
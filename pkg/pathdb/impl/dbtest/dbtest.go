@@ -0,0 +1,273 @@
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+	seg "github.com/scionproto/scion/pkg/segment"
+
+	"github.com/fancl20/cion/pkg/pathdb"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	// DefaultTimeout is the default timeout for running the test harness.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config holds the configuration for the path database testing harness.
+type Config struct {
+	Timeout time.Duration
+}
+
+// InitDefaults initializes the default values for the config.
+func (cfg *Config) InitDefaults() {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+}
+
+// TestableDB extends the path db interface with methods that are needed for testing.
+type TestableDB interface {
+	pathdb.DB
+	// Prepare should reset the internal state so that the db is empty and is ready to be tested.
+	Prepare(*testing.T, context.Context)
+}
+
+// Run should be used to test any implementation of the pathdb.DB interface.
+// An implementation interface should at least have one test method that calls
+// this test-suite.
+func Run(t *testing.T, db TestableDB, cfg Config) {
+	cfg.InitDefaults()
+	tests := map[string]func(*testing.T, pathdb.DB, Config){
+		"test insert": testInsert,
+		"test get":    testGet,
+		"test expiry": testExpiry,
+	}
+	// Run test suite on DB directly.
+	for name, test := range tests {
+		t.Run("DB: "+name, func(t *testing.T) {
+			ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+			defer cancelF()
+			db.Prepare(t, ctx)
+			test(t, db, cfg)
+			db.Close()
+		})
+	}
+}
+
+func testInsert(t *testing.T, db pathdb.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	now := time.Now().Truncate(time.Second)
+	ias := []addr.IA{addr.MustParseIA("1-ff00:0:110"), addr.MustParseIA("1-ff00:0:1")}
+	down := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now.Add(-time.Minute), ias...)}
+
+	in, err := db.Insert(ctx, down)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if !in {
+		t.Fatal("Insert should return true for new segment")
+	}
+	t.Run("Insert existing", func(t *testing.T) {
+		in, err := db.Insert(ctx, down)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if in {
+			t.Error("Insert should return false for existing segment")
+		}
+	})
+	t.Run("Insert older", func(t *testing.T) {
+		older := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now.Add(-time.Hour), ias...)}
+		in, err := db.Insert(ctx, older)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if in {
+			t.Error("Insert should return false for older segment")
+		}
+	})
+	t.Run("Insert other type", func(t *testing.T) {
+		up := &seg.Meta{Type: seg.TypeUp, Segment: down.Segment}
+		in, err := db.Insert(ctx, up)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if !in {
+			t.Error("Insert should return true for segment with new type")
+		}
+	})
+	t.Run("Insert newer", func(t *testing.T) {
+		newer := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now, ias...)}
+		in, err := db.Insert(ctx, newer)
+		if err != nil {
+			t.Errorf("Insert failed: %v", err)
+		}
+		if !in {
+			t.Error("Insert should return true for newer segment")
+		}
+		metas, err := db.Get(ctx, pathdb.Query{SegTypes: []seg.Type{seg.TypeDown}})
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if len(metas) != 1 || !metas[0].Segment.Info.Timestamp.Equal(now) {
+			t.Errorf("Get should return only the newer segment, got %v", metas)
+		}
+	})
+}
+
+func testGet(t *testing.T, db pathdb.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	var (
+		core110 = addr.MustParseIA("1-ff00:0:110")
+		core111 = addr.MustParseIA("1-ff00:0:111")
+		core210 = addr.MustParseIA("2-ff00:0:210")
+		leaf1   = addr.MustParseIA("1-ff00:0:1")
+		leaf2   = addr.MustParseIA("1-ff00:0:2")
+		leaf3   = addr.MustParseIA("2-ff00:0:3")
+	)
+	now := time.Now()
+	core := &seg.Meta{Type: seg.TypeCore, Segment: NewSegment(t, now, core111, core110)}
+	down1 := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now, core110, leaf1)}
+	down2 := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now, core110, leaf2)}
+	up2 := &seg.Meta{Type: seg.TypeUp, Segment: NewSegment(t, now, core111, leaf2)}
+	down3 := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, now, core210, leaf3)}
+	for _, m := range []*seg.Meta{core, down1, down2, up2, down3} {
+		if _, err := db.Insert(ctx, m); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	tests := map[string]struct {
+		query pathdb.Query
+		want  []*seg.Meta
+	}{
+		"all":             {query: pathdb.Query{}, want: []*seg.Meta{core, down1, down2, up2, down3}},
+		"by type":         {query: pathdb.Query{SegTypes: []seg.Type{seg.TypeCore, seg.TypeUp}}, want: []*seg.Meta{core, up2}},
+		"by ID":           {query: pathdb.Query{SegIDs: [][]byte{down1.Segment.ID()}}, want: []*seg.Meta{down1}},
+		"by ID and type":  {query: pathdb.Query{SegIDs: [][]byte{down1.Segment.ID()}, SegTypes: []seg.Type{seg.TypeUp}}},
+		"starts at":       {query: pathdb.Query{StartsAt: []addr.IA{core110}}, want: []*seg.Meta{down1, down2}},
+		"starts at many":  {query: pathdb.Query{StartsAt: []addr.IA{core110, core210}}, want: []*seg.Meta{down1, down2, down3}},
+		"starts at ISD":   {query: pathdb.Query{StartsAt: []addr.IA{addr.MustParseIA("2-0")}}, want: []*seg.Meta{down3}},
+		"starts at any":   {query: pathdb.Query{StartsAt: []addr.IA{0}}, want: []*seg.Meta{core, down1, down2, up2, down3}},
+		"ends at":         {query: pathdb.Query{EndsAt: []addr.IA{leaf2}}, want: []*seg.Meta{down2, up2}},
+		"starts and ends": {query: pathdb.Query{StartsAt: []addr.IA{core111}, EndsAt: []addr.IA{leaf2}}, want: []*seg.Meta{up2}},
+		"no match":        {query: pathdb.Query{StartsAt: []addr.IA{leaf1}}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			metas, err := db.Get(ctx, tc.query)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if !metasEqual(metas, tc.want) {
+				t.Errorf("Get returned %v, want %v", metas, tc.want)
+			}
+		})
+	}
+}
+
+func testExpiry(t *testing.T, db pathdb.DB, cfg Config) {
+	ctx, cancelF := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancelF()
+
+	ias := []addr.IA{addr.MustParseIA("1-ff00:0:110"), addr.MustParseIA("1-ff00:0:1")}
+	// The hop fields of the test segments are valid for 6 hours.
+	expired := &seg.Meta{Type: seg.TypeDown, Segment: NewSegment(t, time.Now().Add(-7*time.Hour), ias...)}
+	in, err := db.Insert(ctx, expired)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if in {
+		t.Error("Insert should return false for expired segment")
+	}
+	metas, err := db.Get(ctx, pathdb.Query{})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(metas) != 0 {
+		t.Errorf("Get should not return expired segments, got %v", metas)
+	}
+}
+
+// NewSegment creates a signed segment through the given ASes, created at the
+// given time. The hop fields are valid for 6 hours.
+func NewSegment(t *testing.T, timestamp time.Time, ias ...addr.IA) *seg.PathSegment {
+	t.Helper()
+	return NewBeacon(t, timestamp, 0, 0, ias...)
+}
+
+// NewBeacon creates a signed beacon through the given ASes, created at the
+// given time. The beacon leaves the last AS on interface egress towards next.
+// If next is zero, the beacon is terminated and is a valid segment.
+func NewBeacon(t *testing.T, timestamp time.Time, next addr.IA, egress uint16,
+	ias ...addr.IA) *seg.PathSegment {
+
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := seg.CreateSegment(timestamp, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ia := range ias {
+		entry := seg.ASEntry{
+			Local: ia,
+			MTU:   1472,
+			HopEntry: seg.HopEntry{
+				HopField: seg.HopField{ExpTime: 63, ConsIngress: uint16(10 + i), ConsEgress: uint16(20 + i)},
+			},
+		}
+		if i == 0 {
+			entry.HopEntry.HopField.ConsIngress = 0
+		}
+		if i == len(ias)-1 {
+			entry.Next, entry.HopEntry.HopField.ConsEgress = next, egress
+		} else {
+			entry.Next = ias[i+1]
+		}
+		signer := trust.Signer{
+			PrivateKey: key,
+			Algorithm:  signed.ECDSAWithSHA256,
+			IA:         ia,
+			Expiration: time.Now().Add(time.Hour),
+		}
+		if err := ps.AddASEntry(context.Background(), entry, signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ps
+}
+
+// metasEqual compares two slices of segments for equality, ignoring order.
+func metasEqual(a, b []*seg.Meta) bool {
+	f := func(i, j *seg.Meta) int {
+		if i.Type != j.Type {
+			return int(i.Type) - int(j.Type)
+		}
+		return bytes.Compare(i.Segment.FullID(), j.Segment.FullID())
+	}
+
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, f)
+	slices.SortFunc(b, f)
+
+	return slices.EqualFunc(a, b, func(i, j *seg.Meta) bool {
+		return f(i, j) == 0 && i.Segment.Info.Timestamp.Unix() == j.Segment.Info.Timestamp.Unix()
+	})
+}
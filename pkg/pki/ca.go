@@ -0,0 +1,216 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/scionproto/scion/pkg/scrypto/cms/protocol"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// ErrInvalidRenewal is returned for renewal requests that the CA rejects.
+var ErrInvalidRenewal = errors.New("invalid renewal request")
+
+// ValidityPolicy decides the validity of the AS certificates issued by a CA.
+type ValidityPolicy struct {
+	// Validity is the validity period of issued certificates. Zero means
+	// DefaultValidity[cppki.AS].
+	Validity time.Duration
+	// Backdate moves the start of the validity before the time of issuance to
+	// tolerate clock skew.
+	Backdate time.Duration
+	// MinValidity is the shortest validity the CA issues. The validity is cut
+	// short at the expiry of the CA certificate, and requests are rejected when
+	// less than MinValidity remains. Zero means any validity.
+	MinValidity time.Duration
+}
+
+// validity returns the validity of a certificate issued at the given time.
+func (p ValidityPolicy) validity(now time.Time, ca *x509.Certificate) (cppki.Validity, error) {
+	d := p.Validity
+	if d == 0 {
+		d = DefaultValidity[cppki.AS]
+	}
+	now = now.Truncate(time.Second)
+	v := cppki.Validity{NotBefore: now.Add(-p.Backdate), NotAfter: now.Add(d)}
+	if v.NotBefore.Before(ca.NotBefore) {
+		v.NotBefore = ca.NotBefore
+	}
+	if v.NotAfter.After(ca.NotAfter) {
+		v.NotAfter = ca.NotAfter
+	}
+	if remaining := v.NotAfter.Sub(now); remaining <= 0 || remaining < p.MinValidity {
+		return cppki.Validity{}, fmt.Errorf("CA certificate expires at %s", ca.NotAfter)
+	}
+	return v, nil
+}
+
+// CMSSigner signs messages with the key of the local AS, usually a
+// trust.SignerManager.
+type CMSSigner interface {
+	SignCMS(ctx context.Context, msg []byte) ([]byte, error)
+}
+
+// CA issues renewed AS certificates of the ASes in its ISD. It runs on core
+// and authoritative ASes, which hold a CA certificate.
+type CA struct {
+	// Credential is the CA certificate and key that issue the AS certificates.
+	Credential Credential
+	// DB holds the TRCs that the chains of the requesters are verified against.
+	DB trust.DB
+	// Signer signs the responses with the AS key of the local AS.
+	Signer CMSSigner
+	// Policy is the validity policy of the issued certificates.
+	Policy ValidityPolicy
+	// Log records the issued certificates. Nil disables the log.
+	Log IssuanceLog
+}
+
+// RenewChain handles a renewal request. The request is a CMS signed PKCS #10
+// request for the new key, signed with the current AS key of the requester
+// and carrying its certificate chain. It returns the CMS signed response with
+// the renewed chain, which is the concatenation of the DER encoded AS and CA
+// certificates. Rejected requests return an error wrapping ErrInvalidRenewal.
+func (ca *CA) RenewChain(ctx context.Context, req []byte) ([]byte, error) {
+	chain, err := ca.Renew(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var raw []byte
+	for _, cert := range chain {
+		raw = append(raw, cert.Raw...)
+	}
+	return ca.Signer.SignCMS(ctx, raw)
+}
+
+// Renew verifies the CMS signed renewal request and returns the renewed chain.
+func (ca *CA) Renew(ctx context.Context, req []byte) ([]*x509.Certificate, error) {
+	now := time.Now()
+	csr, requester, err := ca.verifyRequest(ctx, req, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRenewal, err)
+	}
+	ia, err := cppki.ExtractIA(requester[0].Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: extracting ISD-AS of requester: %w", ErrInvalidRenewal, err)
+	}
+	if csrIA, err := cppki.ExtractIA(csr.Subject); err != nil || csrIA != ia {
+		return nil, fmt.Errorf("%w: request for %s signed by %s", ErrInvalidRenewal, csr.Subject, ia)
+	}
+	caIA, err := cppki.ExtractIA(ca.Credential.Cert.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("extracting ISD-AS of CA: %w", err)
+	}
+	if ia.ISD() != caIA.ISD() {
+		return nil, fmt.Errorf("%w: requester %s not in ISD %d", ErrInvalidRenewal, ia, caIA.ISD())
+	}
+
+	validity, err := ca.Policy.validity(now, ca.Credential.Cert)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := CreateCertificate(cppki.AS, Subject(ia, cppki.AS), csr.PublicKey, validity,
+		ca.Credential)
+	if err != nil {
+		return nil, err
+	}
+	if ca.Log != nil {
+		if err := ca.Log.Record(ctx, Issuance{
+			Time:         now,
+			IA:           ia,
+			SerialNumber: cert.SerialNumber,
+			SubjectKeyID: cert.SubjectKeyId,
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			RequesterKey: requester[0].SubjectKeyId,
+			Certificate:  cert.Raw,
+		}); err != nil {
+			return nil, fmt.Errorf("recording issuance: %w", err)
+		}
+	}
+	return []*x509.Certificate{cert, ca.Credential.Cert}, nil
+}
+
+// verifyRequest verifies the signature of the request and the chain of its
+// signer, and returns the certificate signing request and the chain.
+func (ca *CA) verifyRequest(ctx context.Context, req []byte,
+	now time.Time) (*x509.CertificateRequest, []*x509.Certificate, error) {
+
+	ci, err := protocol.ParseContentInfo(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing request: %w", err)
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing request: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, fmt.Errorf("request with %d signatures", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	certs, err := sd.X509Certificates()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing certificates: %w", err)
+	}
+	signer, err := si.FindCertificate(certs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding signer: %w", err)
+	}
+	chain := []*x509.Certificate{signer}
+	for _, cert := range certs {
+		if bytes.Equal(cert.SubjectKeyId, signer.AuthorityKeyId) {
+			chain = append(chain, cert)
+			break
+		}
+	}
+	if err := (trust.ChainVerifier{DB: ca.DB}).Verify(ctx, chain, now); err != nil {
+		return nil, nil, fmt.Errorf("verifying chain of signer: %w", err)
+	}
+	payload, err := sd.EncapContentInfo.DataEContent()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading request content: %w", err)
+	}
+	if err := verifySignerInfo(payload, signer, si); err != nil {
+		return nil, nil, fmt.Errorf("verifying signature: %w", err)
+	}
+	csr, err := x509.ParseCertificateRequest(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing certificate signing request: %w", err)
+	}
+	// The signature of the CSR proves the possession of the new key.
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("verifying certificate signing request: %w", err)
+	}
+	return csr, chain, nil
+}
+
+// ParseRenewalResponse parses the renewed chain of a response returned by
+// RenewChain. The signature of the response is not verified.
+func ParseRenewalResponse(resp []byte) ([]*x509.Certificate, error) {
+	ci, err := protocol.ParseContentInfo(resp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	raw, err := sd.EncapContentInfo.DataEContent()
+	if err != nil {
+		return nil, fmt.Errorf("reading response content: %w", err)
+	}
+	chain, err := x509.ParseCertificates(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing chain: %w", err)
+	}
+	if err := cppki.ValidateChain(chain); err != nil {
+		return nil, fmt.Errorf("validating chain: %w", err)
+	}
+	return chain, nil
+}
@@ -0,0 +1,157 @@
+package pki_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+func TestCA(t *testing.T) {
+	ctx := context.Background()
+	isd := trusttest.NewISD(t, coreIA, leafIA)
+	other := trusttest.NewISD(t, addr.MustParseIA("2-ff00:0:210"))
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.InsertTRC(ctx, isd.TRC); err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := pki.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		signer  trust.Signer
+		csrIA   addr.IA
+		csr     []byte
+		tamper  bool
+		policy  pki.ValidityPolicy
+		wantErr bool
+		// wantInvalid is set for requests rejected with ErrInvalidRenewal.
+		wantInvalid bool
+	}{
+		"renewal": {
+			signer: isd.Signer(leafIA),
+			csrIA:  leafIA,
+			policy: pki.ValidityPolicy{Validity: time.Hour, Backdate: time.Minute},
+		},
+		"default validity cut by CA": {
+			signer: isd.Signer(leafIA),
+			csrIA:  leafIA,
+		},
+		"request for other AS": {
+			signer:      isd.Signer(leafIA),
+			csrIA:       coreIA,
+			wantErr:     true,
+			wantInvalid: true,
+		},
+		"chain of other ISD": {
+			signer:      other.Signer(addr.MustParseIA("2-ff00:0:210")),
+			csrIA:       addr.MustParseIA("2-ff00:0:210"),
+			wantErr:     true,
+			wantInvalid: true,
+		},
+		"invalid signature": {
+			signer:      isd.Signer(leafIA),
+			csrIA:       leafIA,
+			tamper:      true,
+			wantErr:     true,
+			wantInvalid: true,
+		},
+		"invalid CSR": {
+			signer:      isd.Signer(leafIA),
+			csr:         []byte("csr"),
+			wantErr:     true,
+			wantInvalid: true,
+		},
+		"CA expiring": {
+			signer:  isd.Signer(leafIA),
+			csrIA:   leafIA,
+			policy:  pki.ValidityPolicy{MinValidity: 48 * time.Hour},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			log := &pki.FileIssuanceLog{Path: filepath.Join(t.TempDir(), "issuance.log")}
+			ca := &pki.CA{
+				Credential: isd.CA,
+				DB:         db,
+				Signer:     isd.Signer(coreIA),
+				Policy:     tc.policy,
+				Log:        log,
+			}
+			csr := tc.csr
+			if csr == nil {
+				var err error
+				if csr, err = pki.CreateCSR(tc.csrIA, newKey); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req, err := tc.signer.SignCMS(ctx, csr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.tamper {
+				// The signature is at the end of the request.
+				req[len(req)-1] ^= 0xff
+			}
+			rep, err := ca.RenewChain(ctx, req)
+			issuances, logErr := log.Issuances()
+			if logErr != nil {
+				t.Fatal(logErr)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("RenewChain should fail")
+				}
+				if errors.Is(err, pki.ErrInvalidRenewal) != tc.wantInvalid {
+					t.Errorf("RenewChain returned %v, want invalid renewal %t", err, tc.wantInvalid)
+				}
+				if len(issuances) != 0 {
+					t.Errorf("%d issuances logged for rejected request", len(issuances))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenewChain failed: %v", err)
+			}
+
+			chain, err := pki.ParseRenewalResponse(rep)
+			if err != nil {
+				t.Fatalf("ParseRenewalResponse failed: %v", err)
+			}
+			if !chain[0].PublicKey.(*ecdsa.PublicKey).Equal(newKey.Public()) {
+				t.Error("renewed certificate is not for the new key")
+			}
+			if err := (trust.ChainVerifier{DB: db}).Verify(ctx, chain, time.Now()); err != nil {
+				t.Errorf("verifying renewed chain: %v", err)
+			}
+			if tc.policy.Validity != 0 {
+				want := tc.policy.Validity + tc.policy.Backdate
+				if got := chain[0].NotAfter.Sub(chain[0].NotBefore); got != want {
+					t.Errorf("validity %s, want %s", got, want)
+				}
+			} else if !chain[0].NotAfter.Equal(isd.CA.Cert.NotAfter) {
+				t.Errorf("certificate valid until %s, want %s", chain[0].NotAfter, isd.CA.Cert.NotAfter)
+			}
+			if len(issuances) != 1 || issuances[0].IA != leafIA ||
+				issuances[0].SerialNumber.Cmp(chain[0].SerialNumber) != 0 {
+				t.Errorf("unexpected issuance log %v", issuances)
+			}
+		})
+	}
+}
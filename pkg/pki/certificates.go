@@ -0,0 +1,342 @@
+// Package pki generates the keys and certificates of the control plane PKI.
+// The certificates follow the CP-PKI profiles of the SCION specification.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// DefaultValidity is the default validity period per certificate type. It is
+// the recommended maximum validity period of the specification.
+var DefaultValidity = map[cppki.CertType]time.Duration{
+	cppki.Sensitive: 5 * 365 * 24 * time.Hour,
+	cppki.Regular:   365 * 24 * time.Hour,
+	cppki.Root:      365 * 24 * time.Hour,
+	cppki.CA:        11 * 24 * time.Hour,
+	cppki.AS:        3 * 24 * time.Hour,
+}
+
+// templates are the certificate templates per certificate type.
+var templates = map[cppki.CertType]x509.Certificate{
+	cppki.Sensitive: {
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageSensitive},
+	},
+	cppki.Regular: {
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageRegular},
+	},
+	cppki.Root: {
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageRoot},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	},
+	cppki.CA: {
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	},
+	cppki.AS: {
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+			x509.ExtKeyUsageTimeStamping,
+		},
+	},
+}
+
+// Credential is a private key and its certificate.
+type Credential struct {
+	Key  crypto.Signer
+	Cert *x509.Certificate
+}
+
+// IsZero reports whether the credential is empty.
+func (c Credential) IsZero() bool {
+	return c.Key == nil && c.Cert == nil
+}
+
+// Config configures the generation of the keys and certificates of an AS.
+type Config struct {
+	// IA is the ISD-AS of the AS.
+	IA addr.IA
+	// Type is the type of the AS. It determines the generated certificates.
+	Type trust.ASType
+	// NotBefore is the start of the validity period of the certificates. The
+	// zero value means now.
+	NotBefore time.Time
+	// Validity overrides the validity period per certificate type. Missing
+	// types use DefaultValidity.
+	Validity map[cppki.CertType]time.Duration
+	// Root issues the CA certificate of an authoritative AS. Authoritative
+	// ASes hold no root key, so the root is held by a core AS of the ISD.
+	// It is ignored for other types.
+	Root Credential
+}
+
+// Certificates are the keys and certificates of an AS. Credentials that are
+// not generated for the type of the AS are zero.
+type Certificates struct {
+	IA   addr.IA
+	Type trust.ASType
+
+	// Sensitive is the sensitive voting credential of a core AS.
+	Sensitive Credential
+	// Regular is the regular voting credential of a core or authoritative
+	// AS.
+	Regular Credential
+	// Root is the root credential of a core AS.
+	Root Credential
+	// CA is the CA credential of a core or authoritative AS.
+	CA Credential
+	// AS is the AS credential. The certificate is nil for a normal AS, whose
+	// AS certificate is issued by a CA from the CSR.
+	AS Credential
+	// CSR is the DER encoded certificate signing request for the AS
+	// certificate of a normal AS.
+	CSR []byte
+}
+
+// Chain returns the AS certificate chain, or nil if the AS certificate is not
+// issued yet.
+func (c *Certificates) Chain() []*x509.Certificate {
+	if c.AS.Cert == nil || c.CA.Cert == nil {
+		return nil
+	}
+	return []*x509.Certificate{c.AS.Cert, c.CA.Cert}
+}
+
+// Generate generates the keys and certificates of an AS according to its
+// type. A core AS gets sensitive and regular voting, root, CA and AS
+// credentials, with the CA certificate issued by its own root. An
+// authoritative AS gets regular voting, CA and AS credentials, with the CA
+// certificate issued by the root in the config. A normal AS gets an AS key and
+// a CSR for its AS certificate.
+func Generate(cfg Config) (*Certificates, error) {
+	notBefore := cfg.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+	notBefore = notBefore.Truncate(time.Second)
+	issue := func(typ cppki.CertType, issuer Credential) (Credential, error) {
+		d, ok := cfg.Validity[typ]
+		if !ok {
+			d = DefaultValidity[typ]
+		}
+		validity := cppki.Validity{NotBefore: notBefore, NotAfter: notBefore.Add(d)}
+		return NewCredential(typ, cfg.IA, validity, issuer)
+	}
+
+	c := &Certificates{IA: cfg.IA, Type: cfg.Type}
+	var err error
+	switch cfg.Type {
+	case trust.ASTypeCore:
+		if c.Sensitive, err = issue(cppki.Sensitive, Credential{}); err != nil {
+			return nil, err
+		}
+		if c.Root, err = issue(cppki.Root, Credential{}); err != nil {
+			return nil, err
+		}
+		cfg.Root = c.Root
+		fallthrough
+	case trust.ASTypeAuthoritative:
+		if cfg.Root.IsZero() {
+			return nil, errors.New("authoritative AS requires a root to issue its CA certificate")
+		}
+		if c.Regular, err = issue(cppki.Regular, Credential{}); err != nil {
+			return nil, err
+		}
+		if c.CA, err = issue(cppki.CA, cfg.Root); err != nil {
+			return nil, err
+		}
+		if c.AS, err = issue(cppki.AS, c.CA); err != nil {
+			return nil, err
+		}
+	case trust.ASTypeNormal:
+		if c.AS.Key, err = NewKey(); err != nil {
+			return nil, err
+		}
+		if c.CSR, err = CreateCSR(cfg.IA, c.AS.Key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported AS type %s", cfg.Type)
+	}
+	return c, nil
+}
+
+// NewCredential generates a key and a certificate of the given type for the
+// AS. Root and voting certificates are self-signed, and the issuer must be
+// zero. CA and AS certificates are issued by the issuer.
+func NewCredential(typ cppki.CertType, ia addr.IA, validity cppki.Validity,
+	issuer Credential) (Credential, error) {
+
+	key, err := NewKey()
+	if err != nil {
+		return Credential{}, err
+	}
+	if selfSigned(typ) {
+		if !issuer.IsZero() {
+			return Credential{}, fmt.Errorf("self-signed %s certificate with issuer", typ)
+		}
+		issuer = Credential{Key: key}
+	}
+	cert, err := CreateCertificate(typ, Subject(ia, typ), key.Public(), validity, issuer)
+	if err != nil {
+		return Credential{}, err
+	}
+	return Credential{Key: key, Cert: cert}, nil
+}
+
+// NewKey generates a P-256 ECDSA key.
+func NewKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Subject returns the subject of the certificate of the given type for the
+// AS.
+func Subject(ia addr.IA, typ cppki.CertType) pkix.Name {
+	return pkix.Name{
+		CommonName: fmt.Sprintf("%s %s", ia, typ),
+		ExtraNames: []pkix.AttributeTypeAndValue{{Type: cppki.OIDNameIA, Value: ia.String()}},
+	}
+}
+
+// CreateCertificate creates a certificate of the given type for the public
+// key. CA and AS certificates are issued by the issuer, whose certificate must
+// cover the validity period. Root and voting certificates are self-signed, so
+// the issuer holds the private key of the public key and no certificate. The
+// certificate is validated against the profile of its type.
+func CreateCertificate(typ cppki.CertType, subject pkix.Name, pub crypto.PublicKey,
+	validity cppki.Validity, issuer Credential) (*x509.Certificate, error) {
+
+	tmpl, ok := templates[typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported certificate type %s", typ)
+	}
+	if issuer.Key == nil {
+		return nil, fmt.Errorf("%s certificate without issuer key", typ)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return nil, fmt.Errorf("creating serial number: %w", err)
+	}
+	skid, err := cppki.SubjectKeyID(pub)
+	if err != nil {
+		return nil, fmt.Errorf("computing subject key ID: %w", err)
+	}
+	tmpl.SerialNumber = serial
+	tmpl.Subject = subject
+	tmpl.SubjectKeyId = skid
+	tmpl.NotBefore = validity.NotBefore
+	tmpl.NotAfter = validity.NotAfter
+
+	parent := &tmpl
+	if selfSigned(typ) {
+		if issuer.Cert != nil {
+			return nil, fmt.Errorf("self-signed %s certificate with issuer certificate", typ)
+		}
+	} else {
+		if issuer.Cert == nil {
+			return nil, fmt.Errorf("%s certificate without issuer certificate", typ)
+		}
+		caValidity := cppki.Validity{NotBefore: issuer.Cert.NotBefore, NotAfter: issuer.Cert.NotAfter}
+		if !caValidity.Covers(validity) {
+			return nil, fmt.Errorf("%s certificate validity %s not covered by issuer validity %s",
+				typ, validity, caValidity)
+		}
+		tmpl.AuthorityKeyId = issuer.Cert.SubjectKeyId
+		parent = issuer.Cert
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, &tmpl, parent, pub, issuer.Key)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s certificate: %w", typ, err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s certificate: %w", typ, err)
+	}
+	ct, err := cppki.ValidateCert(cert)
+	if err != nil {
+		return nil, fmt.Errorf("validating %s certificate: %w", typ, err)
+	}
+	if ct != typ {
+		return nil, fmt.Errorf("created %s certificate instead of %s", ct, typ)
+	}
+	return cert, nil
+}
+
+// CreateCSR creates a DER encoded certificate signing request for the AS
+// certificate of the AS, signed with the AS key.
+func CreateCSR(ia addr.IA, key crypto.Signer) ([]byte, error) {
+	tmpl := templates[cppki.AS]
+	skid, err := cppki.SubjectKeyID(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("computing subject key ID: %w", err)
+	}
+	exts, err := csrExtensions(tmpl, skid)
+	if err != nil {
+		return nil, err
+	}
+	return x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         Subject(ia, cppki.AS),
+		ExtraExtensions: exts,
+	}, key)
+}
+
+// csrExtensions encodes the key usage, extended key usage and subject key ID
+// extensions requested for an AS certificate.
+func csrExtensions(tmpl x509.Certificate, skid []byte) ([]pkix.Extension, error) {
+	// digitalSignature is the first bit of the key usage bit string.
+	keyUsage, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x80}, BitLength: 1})
+	if err != nil {
+		return nil, err
+	}
+	oids := map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+		x509.ExtKeyUsageServerAuth:   cppki.OIDExtKeyUsageServerAuth,
+		x509.ExtKeyUsageClientAuth:   cppki.OIDExtKeyUsageClientAuth,
+		x509.ExtKeyUsageTimeStamping: cppki.OIDExtKeyUsageTimeStamping,
+	}
+	var usages []asn1.ObjectIdentifier
+	for _, u := range tmpl.ExtKeyUsage {
+		usages = append(usages, oids[u])
+	}
+	extKeyUsage, err := asn1.Marshal(usages)
+	if err != nil {
+		return nil, err
+	}
+	rawSKID, err := asn1.Marshal(skid)
+	if err != nil {
+		return nil, err
+	}
+	return []pkix.Extension{
+		{Id: cppki.OIDExtensionKeyUsage, Critical: true, Value: keyUsage},
+		{Id: cppki.OIDExtensionExtendedKeyUsage, Value: extKeyUsage},
+		{Id: cppki.OIDExtensionSubjectKeyID, Value: rawSKID},
+	}, nil
+}
+
+func selfSigned(typ cppki.CertType) bool {
+	return typ != cppki.CA && typ != cppki.AS
+}
@@ -0,0 +1,144 @@
+package pki_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+var (
+	coreIA = addr.MustParseIA("1-ff00:0:110")
+	authIA = addr.MustParseIA("1-ff00:0:120")
+	leafIA = addr.MustParseIA("1-ff00:0:111")
+)
+
+func TestGenerate(t *testing.T) {
+	core, err := pki.Generate(pki.Config{IA: coreIA, Type: trust.ASTypeCore})
+	if err != nil {
+		t.Fatalf("generating core AS: %v", err)
+	}
+
+	tests := map[string]struct {
+		cfg       pki.Config
+		wantTypes map[cppki.CertType]bool
+		wantCSR   bool
+		wantErr   bool
+	}{
+		"core": {
+			cfg: pki.Config{IA: coreIA, Type: trust.ASTypeCore},
+			wantTypes: map[cppki.CertType]bool{
+				cppki.Sensitive: true,
+				cppki.Regular:   true,
+				cppki.Root:      true,
+				cppki.CA:        true,
+				cppki.AS:        true,
+			},
+		},
+		"authoritative": {
+			cfg: pki.Config{IA: authIA, Type: trust.ASTypeAuthoritative, Root: core.Root},
+			wantTypes: map[cppki.CertType]bool{
+				cppki.Regular: true,
+				cppki.CA:      true,
+				cppki.AS:      true,
+			},
+		},
+		"authoritative without root": {
+			cfg:     pki.Config{IA: authIA, Type: trust.ASTypeAuthoritative},
+			wantErr: true,
+		},
+		"normal": {
+			cfg:     pki.Config{IA: leafIA, Type: trust.ASTypeNormal},
+			wantCSR: true,
+		},
+		"validity not covered by root": {
+			cfg: pki.Config{
+				IA:        authIA,
+				Type:      trust.ASTypeAuthoritative,
+				Root:      core.Root,
+				NotBefore: time.Now().Add(365 * 24 * time.Hour),
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := pki.Generate(tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Generate should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			creds := map[cppki.CertType]pki.Credential{
+				cppki.Sensitive: c.Sensitive,
+				cppki.Regular:   c.Regular,
+				cppki.Root:      c.Root,
+				cppki.CA:        c.CA,
+				cppki.AS:        c.AS,
+			}
+			for typ, cred := range creds {
+				if cred.Cert == nil {
+					if tc.wantTypes[typ] {
+						t.Errorf("missing %s certificate", typ)
+					}
+					continue
+				}
+				if !tc.wantTypes[typ] {
+					t.Errorf("unexpected %s certificate", typ)
+				}
+				if ct, err := cppki.ValidateCert(cred.Cert); err != nil || ct != typ {
+					t.Errorf("%s certificate validated as %s: %v", typ, ct, err)
+				}
+				skid, err := cppki.SubjectKeyID(cred.Key.Public())
+				if err != nil || !bytes.Equal(skid, cred.Cert.SubjectKeyId) {
+					t.Errorf("%s certificate does not match its key", typ)
+				}
+				if ia, err := cppki.ExtractIA(cred.Cert.Subject); err != nil || ia != tc.cfg.IA {
+					t.Errorf("%s certificate of %s, want %s", typ, ia, tc.cfg.IA)
+				}
+			}
+
+			if chain := c.Chain(); chain != nil {
+				root := core.Root.Cert
+				if c.Root.Cert != nil {
+					root = c.Root.Cert
+				}
+				trc := &cppki.TRC{Certificates: []*x509.Certificate{root}}
+				if err := cppki.VerifyChain(chain, cppki.VerifyOptions{TRC: []*cppki.TRC{trc}}); err != nil {
+					t.Errorf("verifying chain: %v", err)
+				}
+			}
+
+			if !tc.wantCSR {
+				if c.CSR != nil {
+					t.Error("unexpected CSR")
+				}
+				return
+			}
+			if c.AS.Key == nil {
+				t.Fatal("missing AS key")
+			}
+			csr, err := x509.ParseCertificateRequest(c.CSR)
+			if err != nil {
+				t.Fatalf("parsing CSR: %v", err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				t.Errorf("CSR signature: %v", err)
+			}
+			if ia, err := cppki.ExtractIA(csr.Subject); err != nil || ia != tc.cfg.IA {
+				t.Errorf("CSR of %s, want %s", ia, tc.cfg.IA)
+			}
+		})
+	}
+}
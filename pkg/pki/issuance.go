@@ -0,0 +1,95 @@
+package pki
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+)
+
+// Issuance is a certificate issued by a CA.
+type Issuance struct {
+	// Time is the time of issuance.
+	Time time.Time `json:"time"`
+	// IA is the ISD-AS of the certificate.
+	IA addr.IA `json:"isd_as"`
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber *big.Int `json:"serial_number"`
+	// SubjectKeyID is the subject key ID of the certificate.
+	SubjectKeyID []byte `json:"subject_key_id"`
+	// NotBefore and NotAfter are the validity of the certificate.
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// RequesterKey is the subject key ID of the AS certificate that signed the
+	// renewal request.
+	RequesterKey []byte `json:"requester_key_id"`
+	// Certificate is the DER encoded certificate.
+	Certificate []byte `json:"certificate"`
+}
+
+// IssuanceLog records the certificates issued by a CA.
+type IssuanceLog interface {
+	Record(ctx context.Context, issuance Issuance) error
+}
+
+// FileIssuanceLog appends the issued certificates to a file, one JSON object
+// per line. It is safe for concurrent use.
+type FileIssuanceLog struct {
+	// Path is the file of the log, which is created if it does not exist.
+	Path string
+
+	mu sync.Mutex
+}
+
+var _ IssuanceLog = (*FileIssuanceLog)(nil)
+
+// Record appends the issuance to the log.
+func (l *FileIssuanceLog) Record(_ context.Context, issuance Issuance) error {
+	line, err := json.Marshal(issuance)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Issuances returns the issued certificates in the log, oldest first.
+func (l *FileIssuanceLog) Issuances() ([]Issuance, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var issuances []Issuance
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var issuance Issuance
+		if err := json.Unmarshal(scanner.Bytes(), &issuance); err != nil {
+			return nil, fmt.Errorf("parsing %s line %d: %w", l.Path, line, err)
+		}
+		issuances = append(issuances, issuance)
+	}
+	return issuances, scanner.Err()
+}
@@ -0,0 +1,214 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cms/protocol"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+// BaseTRCConfig configures the payload of a base TRC.
+type BaseTRCConfig struct {
+	// ISD is the ISD of the TRC.
+	ISD addr.ISD
+	// Description is the description of the TRC.
+	Description string
+	// Validity is the validity period of the TRC. The zero value means the
+	// largest period covered by all certificates.
+	Validity cppki.Validity
+	// Quorum is the number of votes required for TRC updates. Zero means a
+	// majority of the sensitive or regular voters, whichever are fewer.
+	Quorum int
+	// Certificates are the voting and root certificates of the core ASes.
+	// Every AS holding a certificate is a core and authoritative AS.
+	Certificates []*x509.Certificate
+}
+
+// NewBaseTRC builds the payload of a base TRC. The encoded payload is in the
+// Raw field of the returned TRC, and is signed by every voter of the TRC with
+// SignTRC. As CION does not support trust resets, the TRC has noTrustReset
+// set.
+func NewBaseTRC(cfg BaseTRCConfig) (cppki.TRC, error) {
+	info, err := classify(cfg.ISD, cfg.Certificates)
+	if err != nil {
+		return cppki.TRC{}, err
+	}
+	validity := cfg.Validity
+	if validity == (cppki.Validity{}) {
+		validity = info.validity
+	}
+	quorum := cfg.Quorum
+	if quorum == 0 {
+		quorum = min(info.sensitive, info.regular)/2 + 1
+	}
+
+	trc := cppki.TRC{
+		Version:           1,
+		ID:                cppki.TRCID{ISD: cfg.ISD, Base: 1, Serial: 1},
+		Validity:          validity,
+		NoTrustReset:      true,
+		Quorum:            quorum,
+		CoreASes:          info.ases,
+		AuthoritativeASes: info.ases,
+		Description:       cfg.Description,
+		Certificates:      cfg.Certificates,
+	}
+	return encodeTRC(trc)
+}
+
+// certInfo is the information derived from the certificates of a TRC.
+type certInfo struct {
+	// ases are the ASes holding a certificate, sorted.
+	ases []addr.AS
+	// sensitive and regular are the number of voting certificates.
+	sensitive, regular int
+	// validity is the largest period covered by all certificates.
+	validity cppki.Validity
+}
+
+// classify checks that the certificates are voting and root certificates of
+// the ISD and derives the information for the TRC from them. Following ADR
+// 0002, every AS holding a certificate is a core and authoritative AS.
+func classify(isd addr.ISD, certs []*x509.Certificate) (certInfo, error) {
+	var info certInfo
+	for i, cert := range certs {
+		typ, err := cppki.ValidateCert(cert)
+		if err != nil {
+			return certInfo{}, fmt.Errorf("certificate %d: %w", i, err)
+		}
+		switch typ {
+		case cppki.Sensitive:
+			info.sensitive++
+		case cppki.Regular:
+			info.regular++
+		case cppki.Root:
+		default:
+			return certInfo{}, fmt.Errorf("certificate %d: %s certificate in TRC", i, typ)
+		}
+		ia, err := cppki.ExtractIA(cert.Subject)
+		if err != nil {
+			return certInfo{}, fmt.Errorf("certificate %d: %w", i, err)
+		}
+		if ia.ISD() != isd {
+			return certInfo{}, fmt.Errorf("certificate %d: certificate of %s in ISD %d", i, ia, isd)
+		}
+		if !slices.Contains(info.ases, ia.AS()) {
+			info.ases = append(info.ases, ia.AS())
+		}
+		if i == 0 || cert.NotBefore.After(info.validity.NotBefore) {
+			info.validity.NotBefore = cert.NotBefore
+		}
+		if i == 0 || cert.NotAfter.Before(info.validity.NotAfter) {
+			info.validity.NotAfter = cert.NotAfter
+		}
+	}
+	slices.Sort(info.ases)
+	return info, nil
+}
+
+// encodeTRC validates and encodes the TRC, and returns the decoded TRC with
+// the encoded payload.
+func encodeTRC(trc cppki.TRC) (cppki.TRC, error) {
+	raw, err := trc.Encode()
+	if err != nil {
+		return cppki.TRC{}, fmt.Errorf("encoding TRC: %w", err)
+	}
+	return cppki.DecodeTRC(raw)
+}
+
+// SignTRC signs the encoded TRC payload with the voting credential and returns
+// a signed TRC that only holds this signature. The signatures of all voters
+// are combined with CombineTRC. The certificate of the voter is not included,
+// as it is in the TRC or its predecessor.
+func SignTRC(payload []byte, voter Credential) ([]byte, error) {
+	eci, err := protocol.NewDataEncapsulatedContentInfo(payload)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := protocol.NewSignedData(eci)
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.AddSignerInfo([]*x509.Certificate{voter.Cert}, voter.Key); err != nil {
+		return nil, fmt.Errorf("signing TRC: %w", err)
+	}
+	sd.Certificates = []asn1.RawValue{}
+	return sd.ContentInfoDER()
+}
+
+// CombineTRC combines the signed TRCs created by SignTRC for the same payload
+// into a single signed TRC, and verifies it. A base TRC must be signed by all
+// its voters and the predecessor must be nil. A TRC update is verified against
+// its predecessor, which requires a quorum of votes and signatures of all new
+// voters.
+func CombineTRC(predecessor *cppki.TRC, parts ...[]byte) (cppki.SignedTRC, error) {
+	if len(parts) == 0 {
+		return cppki.SignedTRC{}, errors.New("no signed TRC")
+	}
+	var payload []byte
+	var infos []protocol.SignerInfo
+	for i, raw := range parts {
+		part, err := cppki.DecodeSignedTRC(raw)
+		if err != nil {
+			return cppki.SignedTRC{}, fmt.Errorf("decoding signed TRC %d: %w", i, err)
+		}
+		if payload == nil {
+			payload = part.TRC.Raw
+		} else if !bytes.Equal(payload, part.TRC.Raw) {
+			return cppki.SignedTRC{}, fmt.Errorf("signed TRC %d: different payload", i)
+		}
+		for _, si := range part.SignerInfos {
+			// A voter that signed more than once is only included once.
+			if !slices.ContainsFunc(infos, func(o protocol.SignerInfo) bool {
+				return bytes.Equal(o.SID.FullBytes, si.SID.FullBytes)
+			}) {
+				infos = append(infos, si)
+			}
+		}
+	}
+	slices.SortFunc(infos, func(a, b protocol.SignerInfo) int {
+		return bytes.Compare(a.SID.FullBytes, b.SID.FullBytes)
+	})
+
+	eci, err := protocol.NewDataEncapsulatedContentInfo(payload)
+	if err != nil {
+		return cppki.SignedTRC{}, err
+	}
+	sd := protocol.SignedData{
+		Version:          1,
+		EncapContentInfo: eci,
+		SignerInfos:      infos,
+		DigestAlgorithms: digestAlgorithms(infos),
+	}
+	raw, err := sd.ContentInfoDER()
+	if err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("encoding signed TRC: %w", err)
+	}
+	signed, err := cppki.DecodeSignedTRC(raw)
+	if err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("decoding signed TRC: %w", err)
+	}
+	if err := signed.Verify(predecessor); err != nil {
+		return cppki.SignedTRC{}, fmt.Errorf("verifying TRC %s: %w", signed.TRC.ID, err)
+	}
+	return signed, nil
+}
+
+func digestAlgorithms(infos []protocol.SignerInfo) []pkix.AlgorithmIdentifier {
+	var algos []pkix.AlgorithmIdentifier
+	for _, si := range infos {
+		if !slices.ContainsFunc(algos, func(a pkix.AlgorithmIdentifier) bool {
+			return a.Algorithm.Equal(si.DigestAlgorithm.Algorithm)
+		}) {
+			algos = append(algos, si.DigestAlgorithm)
+		}
+	}
+	return algos
+}
@@ -0,0 +1,163 @@
+package pki_test
+
+import (
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+)
+
+func TestBaseTRCCeremony(t *testing.T) {
+	core, err := pki.Generate(pki.Config{IA: coreIA, Type: trust.ASTypeCore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := pki.Generate(pki.Config{IA: authIA, Type: trust.ASTypeAuthoritative, Root: core.Root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := pki.Generate(pki.Config{IA: addr.MustParseIA("2-ff00:0:210"), Type: trust.ASTypeCore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{core.Sensitive.Cert, core.Regular.Cert, core.Root.Cert, auth.Regular.Cert}
+	voters := []pki.Credential{core.Sensitive, core.Regular, auth.Regular}
+
+	tests := map[string]struct {
+		certs      []*x509.Certificate
+		quorum     int
+		voters     []pki.Credential
+		wantErr    bool
+		wantSigned bool
+	}{
+		"all voters": {
+			certs:      certs,
+			voters:     voters,
+			wantSigned: true,
+		},
+		"missing voter": {
+			certs:  certs,
+			voters: voters[:2],
+		},
+		"quorum above voters": {
+			certs:   certs,
+			quorum:  2,
+			wantErr: true,
+		},
+		"CA certificate": {
+			certs:   append(certs, core.CA.Cert),
+			wantErr: true,
+		},
+		"other ISD": {
+			certs:   append(certs, other.Regular.Cert),
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			trc, err := pki.NewBaseTRC(pki.BaseTRCConfig{
+				ISD:          coreIA.ISD(),
+				Description:  "test ISD",
+				Quorum:       tc.quorum,
+				Certificates: tc.certs,
+			})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("NewBaseTRC should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewBaseTRC failed: %v", err)
+			}
+			want := []addr.AS{coreIA.AS(), authIA.AS()}
+			if len(trc.CoreASes) != 2 || len(trc.AuthoritativeASes) != 2 ||
+				trc.CoreASes[0] != want[0] || trc.CoreASes[1] != want[1] {
+				t.Errorf("core ASes %v, authoritative ASes %v, want %v",
+					trc.CoreASes, trc.AuthoritativeASes, want)
+			}
+
+			var parts [][]byte
+			for _, v := range tc.voters {
+				part, err := pki.SignTRC(trc.Raw, v)
+				if err != nil {
+					t.Fatalf("SignTRC failed: %v", err)
+				}
+				// Signing twice is harmless.
+				parts = append(parts, part, part)
+			}
+			signed, err := pki.CombineTRC(nil, parts...)
+			if !tc.wantSigned {
+				if err == nil {
+					t.Error("CombineTRC should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CombineTRC failed: %v", err)
+			}
+			if len(signed.SignerInfos) != len(tc.voters) {
+				t.Errorf("%d signatures, want %d", len(signed.SignerInfos), len(tc.voters))
+			}
+
+			db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := (trust.TRCVerifier{DB: db}).Insert(context.Background(), signed); err != nil {
+				t.Errorf("inserting TRC: %v", err)
+			}
+		})
+	}
+
+	t.Run("different payloads", func(t *testing.T) {
+		var parts [][]byte
+		for _, desc := range []string{"a", "b"} {
+			trc, err := pki.NewBaseTRC(pki.BaseTRCConfig{
+				ISD:          coreIA.ISD(),
+				Description:  desc,
+				Certificates: certs,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			part, err := pki.SignTRC(trc.Raw, core.Regular)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts = append(parts, part)
+		}
+		if _, err := pki.CombineTRC(nil, parts...); err == nil {
+			t.Error("CombineTRC should reject different payloads")
+		}
+	})
+
+	t.Run("validity", func(t *testing.T) {
+		trc, err := pki.NewBaseTRC(pki.BaseTRCConfig{ISD: coreIA.ISD(), Certificates: certs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The regular voting and root certificates expire first.
+		if !trc.Validity.NotAfter.Equal(core.Root.Cert.NotAfter) {
+			t.Errorf("TRC valid until %v, want %v", trc.Validity.NotAfter, core.Root.Cert.NotAfter)
+		}
+		if _, err := pki.NewBaseTRC(pki.BaseTRCConfig{
+			ISD: coreIA.ISD(),
+			Validity: cppki.Validity{
+				NotBefore: core.Root.Cert.NotBefore,
+				NotAfter:  core.Sensitive.Cert.NotAfter,
+			},
+			Certificates: certs,
+		}); err == nil {
+			t.Error("NewBaseTRC should reject a validity not covered by the certificates")
+		}
+	})
+}
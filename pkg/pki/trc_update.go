@@ -0,0 +1,269 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/scrypto/cms/protocol"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+// DefaultGracePeriod is the default grace period of a TRC update, during which
+// the predecessor stays active.
+var DefaultGracePeriod = 24 * time.Hour
+
+// TRCUpdateConfig configures a TRC update.
+type TRCUpdateConfig struct {
+	// Type is the type of the update. A sensitive update is voted for by
+	// sensitive voters, which only core ASes hold, and may change anything. A
+	// regular update is voted for by regular voters, which core and
+	// authoritative ASes hold, and may only replace regular voting and root
+	// certificates.
+	Type cppki.UpdateType
+	// Description is the description of the TRC. Empty keeps the description
+	// of the predecessor.
+	Description string
+	// Validity is the validity period of the TRC. The zero value means from
+	// now until the end of the period covered by all certificates.
+	Validity cppki.Validity
+	// GracePeriod is the period after the start of the validity during which
+	// the predecessor stays active. Zero means DefaultGracePeriod.
+	GracePeriod time.Duration
+	// Quorum is the number of votes required for TRC updates. Zero keeps the
+	// quorum of the predecessor.
+	Quorum int
+	// Certificates are the voting and root certificates of the TRC. Nil keeps
+	// the certificates of the predecessor.
+	Certificates []*x509.Certificate
+	// Voters are the voting certificates in the predecessor that vote for the
+	// update. Nil means all voters of the update type.
+	Voters []*x509.Certificate
+}
+
+// TRCProposal is a proposed TRC update and the signatures collected for it.
+// The encoded payload in TRC.Raw is distributed to the voters, who sign it
+// with SignTRC. It is safe for concurrent use.
+type TRCProposal struct {
+	// TRC is the proposed TRC.
+	TRC cppki.TRC
+	// Predecessor is the TRC that is updated.
+	Predecessor cppki.TRC
+	// Update describes the update and the required signatures.
+	Update cppki.Update
+
+	mu sync.Mutex
+	// signed holds the signed TRCs by the index of the signer in Signers.
+	signed map[int][]byte
+}
+
+// ProposeTRCUpdate builds the update of the predecessor. The update is checked
+// against the predecessor, which requires a quorum of voters of the update
+// type.
+func ProposeTRCUpdate(predecessor cppki.TRC, cfg TRCUpdateConfig) (*TRCProposal, error) {
+	certs := cfg.Certificates
+	if certs == nil {
+		certs = predecessor.Certificates
+	}
+	info, err := classify(predecessor.ID.ISD, certs)
+	if err != nil {
+		return nil, err
+	}
+	validity := cfg.Validity
+	if validity == (cppki.Validity{}) {
+		validity = cppki.Validity{
+			NotBefore: time.Now().Truncate(time.Second),
+			NotAfter:  info.validity.NotAfter,
+		}
+	}
+	grace := cfg.GracePeriod
+	if grace == 0 {
+		grace = DefaultGracePeriod
+	}
+	quorum := cfg.Quorum
+	if quorum == 0 {
+		quorum = predecessor.Quorum
+	}
+	description := cfg.Description
+	if description == "" {
+		description = predecessor.Description
+	}
+
+	voterType := cppki.Sensitive
+	switch cfg.Type {
+	case cppki.SensitiveUpdate:
+	case cppki.RegularUpdate:
+		voterType = cppki.Regular
+	default:
+		return nil, fmt.Errorf("unsupported update type %s", cfg.Type)
+	}
+	var votes []int
+	for i, cert := range predecessor.Certificates {
+		if cfg.Voters != nil && !slices.ContainsFunc(cfg.Voters, cert.Equal) {
+			continue
+		}
+		typ, err := cppki.ValidateCert(cert)
+		if err == nil && typ == voterType {
+			votes = append(votes, i)
+		} else if cfg.Voters != nil {
+			return nil, fmt.Errorf("voter %s is not a %s voter", cert.Subject.CommonName, voterType)
+		}
+	}
+	if cfg.Voters != nil && len(votes) != len(cfg.Voters) {
+		return nil, errors.New("voter not in predecessor")
+	}
+
+	trc, err := encodeTRC(cppki.TRC{
+		Version: 1,
+		ID: cppki.TRCID{
+			ISD:    predecessor.ID.ISD,
+			Base:   predecessor.ID.Base,
+			Serial: predecessor.ID.Serial + 1,
+		},
+		Validity:          validity,
+		GracePeriod:       grace,
+		NoTrustReset:      predecessor.NoTrustReset,
+		Votes:             votes,
+		Quorum:            quorum,
+		CoreASes:          info.ases,
+		AuthoritativeASes: info.ases,
+		Description:       description,
+		Certificates:      certs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewTRCProposal(predecessor, trc.Raw)
+}
+
+// NewTRCProposal returns the proposal for the encoded TRC payload, e.g. to
+// collect the signatures for a payload distributed by another party. The
+// payload must be a valid update of the predecessor.
+func NewTRCProposal(predecessor cppki.TRC, payload []byte) (*TRCProposal, error) {
+	trc, err := cppki.DecodeTRC(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding TRC: %w", err)
+	}
+	if trc.ID.IsBase() {
+		return nil, fmt.Errorf("TRC %s is not an update", trc.ID)
+	}
+	update, err := trc.ValidateUpdate(&predecessor)
+	if err != nil {
+		return nil, fmt.Errorf("validating TRC update %s: %w", trc.ID, err)
+	}
+	return &TRCProposal{
+		TRC:         trc,
+		Predecessor: predecessor,
+		Update:      update,
+		signed:      make(map[int][]byte),
+	}, nil
+}
+
+// Signers returns the certificates whose keys must sign the update: the voters,
+// the new voters showing possession of their key, and the replaced root
+// certificates acknowledging their successor.
+func (p *TRCProposal) Signers() []*x509.Certificate {
+	var signers []*x509.Certificate
+	for _, certs := range [][]*x509.Certificate{p.Update.Votes, p.Update.NewVoters,
+		p.Update.RootAcknowledgments} {
+
+		for _, cert := range certs {
+			if !slices.ContainsFunc(signers, cert.Equal) {
+				signers = append(signers, cert)
+			}
+		}
+	}
+	return signers
+}
+
+// Add adds the signatures of a signed TRC created by SignTRC. Every signature
+// must be valid and by a signer of the update.
+func (p *TRCProposal) Add(raw []byte) error {
+	signed, err := cppki.DecodeSignedTRC(raw)
+	if err != nil {
+		return fmt.Errorf("decoding signed TRC: %w", err)
+	}
+	if !bytes.Equal(signed.TRC.Raw, p.TRC.Raw) {
+		return errors.New("signed TRC has a different payload")
+	}
+	if len(signed.SignerInfos) == 0 {
+		return errors.New("signed TRC without signatures")
+	}
+	signers := p.Signers()
+	var indices []int
+	for _, si := range signed.SignerInfos {
+		cert, err := si.FindCertificate(signers)
+		if err != nil {
+			return fmt.Errorf("finding signer: %w", err)
+		}
+		if err := verifySignerInfo(signed.TRC.Raw, cert, si); err != nil {
+			return fmt.Errorf("verifying signature of %s: %w", cert.Subject.CommonName, err)
+		}
+		indices = append(indices, slices.Index(signers, cert))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, i := range indices {
+		p.signed[i] = raw
+	}
+	return nil
+}
+
+// Missing returns the signers whose signature is not collected yet.
+func (p *TRCProposal) Missing() []*x509.Certificate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var missing []*x509.Certificate
+	for i, cert := range p.Signers() {
+		if _, ok := p.signed[i]; !ok {
+			missing = append(missing, cert)
+		}
+	}
+	return missing
+}
+
+// SignedTRC combines the collected signatures into the signed TRC and verifies
+// it against the predecessor. It fails until all signatures are collected.
+func (p *TRCProposal) SignedTRC() (cppki.SignedTRC, error) {
+	if missing := p.Missing(); len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for _, cert := range missing {
+			names = append(names, cert.Subject.CommonName)
+		}
+		return cppki.SignedTRC{}, fmt.Errorf("missing signatures of %v", names)
+	}
+	p.mu.Lock()
+	parts := make([][]byte, 0, len(p.signed))
+	for _, raw := range p.signed {
+		parts = append(parts, raw)
+	}
+	p.mu.Unlock()
+	return CombineTRC(&p.Predecessor, parts...)
+}
+
+// verifySignerInfo verifies the signature of the signer info on the payload
+// with the certificate.
+func verifySignerInfo(payload []byte, cert *x509.Certificate, si protocol.SignerInfo) error {
+	hash, err := si.Hash()
+	if err != nil {
+		return err
+	}
+	digest, err := si.GetMessageDigestAttribute()
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(payload)
+	if !bytes.Equal(digest, h.Sum(nil)) {
+		return errors.New("message digest does not match")
+	}
+	input, err := si.SignedAttrs.MarshaledForVerifying()
+	if err != nil {
+		return err
+	}
+	return cert.CheckSignature(si.X509SignatureAlgorithm(), input, si.Signature)
+}
@@ -0,0 +1,197 @@
+package pki_test
+
+import (
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+)
+
+func TestTRCProposal(t *testing.T) {
+	ctx := context.Background()
+	core, err := pki.Generate(pki.Config{IA: coreIA, Type: trust.ASTypeCore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := pki.Generate(pki.Config{IA: authIA, Type: trust.ASTypeAuthoritative, Root: core.Root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	core2, err := pki.Generate(pki.Config{IA: addr.MustParseIA("1-ff00:0:130"), Type: trust.ASTypeCore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := pki.NewCredential(cppki.Regular, authIA, cppki.Validity{
+		NotBefore: auth.Regular.Cert.NotBefore,
+		NotAfter:  auth.Regular.Cert.NotAfter,
+	}, pki.Credential{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := []pki.Credential{core.Sensitive, core.Regular, core.Root, auth.Regular,
+		core2.Sensitive, core2.Regular, core2.Root, rotated}
+
+	certs := []*x509.Certificate{core.Sensitive.Cert, core.Regular.Cert, core.Root.Cert, auth.Regular.Cert}
+	base, err := pki.NewBaseTRC(pki.BaseTRCConfig{ISD: coreIA.ISD(), Certificates: certs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts [][]byte
+	for _, v := range []pki.Credential{core.Sensitive, core.Regular, auth.Regular} {
+		part, err := pki.SignTRC(base.Raw, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part)
+	}
+	signedBase, err := pki.CombineTRC(nil, parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		cfg         pki.TRCUpdateConfig
+		wantSigners []*x509.Certificate
+		wantErr     bool
+	}{
+		"regular update rotating a regular voter": {
+			cfg: pki.TRCUpdateConfig{
+				Type: cppki.RegularUpdate,
+				Certificates: []*x509.Certificate{core.Sensitive.Cert, core.Regular.Cert,
+					core.Root.Cert, rotated.Cert},
+			},
+			// The rotated voter votes, and its successor shows possession of
+			// its key.
+			wantSigners: []*x509.Certificate{core.Regular.Cert, auth.Regular.Cert, rotated.Cert},
+		},
+		"regular update by quorum": {
+			cfg: pki.TRCUpdateConfig{
+				Type:        cppki.RegularUpdate,
+				Description: "renewed",
+				Voters:      []*x509.Certificate{auth.Regular.Cert},
+			},
+			wantSigners: []*x509.Certificate{auth.Regular.Cert},
+		},
+		"sensitive update adding a core AS": {
+			cfg: pki.TRCUpdateConfig{
+				Type: cppki.SensitiveUpdate,
+				Certificates: append(slices.Clone(certs),
+					core2.Sensitive.Cert, core2.Regular.Cert, core2.Root.Cert),
+			},
+			wantSigners: []*x509.Certificate{core.Sensitive.Cert, core2.Sensitive.Cert, core2.Regular.Cert},
+		},
+		"regular update adding a core AS": {
+			cfg: pki.TRCUpdateConfig{
+				Type: cppki.RegularUpdate,
+				Certificates: append(slices.Clone(certs),
+					core2.Sensitive.Cert, core2.Regular.Cert, core2.Root.Cert),
+			},
+			wantErr: true,
+		},
+		"regular voter in sensitive update": {
+			cfg: pki.TRCUpdateConfig{
+				Type:   cppki.SensitiveUpdate,
+				Voters: []*x509.Certificate{core.Regular.Cert},
+			},
+			wantErr: true,
+		},
+		"voter not in predecessor": {
+			cfg: pki.TRCUpdateConfig{
+				Type:   cppki.RegularUpdate,
+				Voters: []*x509.Certificate{core2.Regular.Cert},
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := pki.ProposeTRCUpdate(signedBase.TRC, tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("ProposeTRCUpdate should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProposeTRCUpdate failed: %v", err)
+			}
+			signers := p.Signers()
+			if len(signers) != len(tc.wantSigners) {
+				t.Fatalf("%d signers, want %d", len(signers), len(tc.wantSigners))
+			}
+			for _, cert := range tc.wantSigners {
+				if !slices.ContainsFunc(signers, cert.Equal) {
+					t.Errorf("missing signer %s", cert.Subject.CommonName)
+				}
+			}
+
+			// The voters receive the distributed payload.
+			collector, err := pki.NewTRCProposal(signedBase.TRC, p.TRC.Raw)
+			if err != nil {
+				t.Fatalf("NewTRCProposal failed: %v", err)
+			}
+			other, err := pki.SignTRC(p.TRC.Raw, core2.Sensitive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := collector.Add(other); err == nil && tc.cfg.Type == cppki.RegularUpdate {
+				t.Error("Add should reject signatures by other keys")
+			}
+			for _, cert := range signers {
+				i := slices.IndexFunc(creds, func(c pki.Credential) bool { return c.Cert.Equal(cert) })
+				part, err := pki.SignTRC(p.TRC.Raw, creds[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := collector.SignedTRC(); err == nil {
+					t.Error("SignedTRC should fail with missing signatures")
+				}
+				if err := collector.Add(part); err != nil {
+					t.Fatalf("Add failed: %v", err)
+				}
+			}
+			if missing := collector.Missing(); len(missing) != 0 {
+				t.Errorf("%d missing signatures", len(missing))
+			}
+			signed, err := collector.SignedTRC()
+			if err != nil {
+				t.Fatalf("SignedTRC failed: %v", err)
+			}
+
+			db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			v := trust.TRCVerifier{DB: db}
+			if _, err := v.Insert(ctx, signedBase); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := v.Insert(ctx, signed); err != nil {
+				t.Errorf("inserting TRC update: %v", err)
+			}
+		})
+	}
+
+	t.Run("different payload", func(t *testing.T) {
+		p, err := pki.ProposeTRCUpdate(signedBase.TRC, pki.TRCUpdateConfig{Type: cppki.RegularUpdate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		part, err := pki.SignTRC(base.Raw, core.Regular)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Add(part); err == nil {
+			t.Error("Add should reject a signature on another payload")
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package trust
+
+// ASType is the role of an AS within its ISD. The roles are tiered, see ADR
+// 0002 for the capabilities of each type.
+type ASType int
+
+const (
+	// ASTypeNormal is a non-core AS.
+	ASTypeNormal ASType = iota
+	// ASTypeAuthoritative is a core AS with regular voting rights.
+	ASTypeAuthoritative
+	// ASTypeCore is a core AS with root, sensitive and regular voting rights.
+	ASTypeCore
+)
+
+func (t ASType) String() string {
+	switch t {
+	case ASTypeAuthoritative:
+		return "authoritative"
+	case ASTypeCore:
+		return "core"
+	default:
+		return "normal"
+	}
+}
+
+// IsCore reports whether ASes of this type are core ASes.
+func (t ASType) IsCore() bool {
+	return t == ASTypeCore || t == ASTypeAuthoritative
+}
@@ -0,0 +1,101 @@
+package trust
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+// ChainVerifier verifies AS certificate chains against the TRCs in the
+// database.
+type ChainVerifier struct {
+	DB DB
+}
+
+// Verify verifies the chain at the given time. The chain must consist of an AS
+// certificate and a CA certificate that follow the CP-PKI profiles, and the AS
+// certificate must verify through the CA certificate to a root certificate of
+// the active TRC of its ISD, or of its predecessor during the grace period.
+//
+// With the AllowInactive option, the chain may instead verify against a TRC
+// that is no longer active. The AS and CA certificates must still be valid at
+// the given time. Only the root certificates of the TRC may have expired since,
+// so the chain is verified against the TRCs that were valid when the AS
+// certificate was issued.
+func (v ChainVerifier) Verify(ctx context.Context, chain []*x509.Certificate, now time.Time,
+	opts ...Option) error {
+
+	o := applyOptions(opts)
+	if err := cppki.ValidateChain(chain); err != nil {
+		return serrors.Wrap("validating chain", err)
+	}
+	ia, err := cppki.ExtractIA(chain[0].Subject)
+	if err != nil {
+		return serrors.Wrap("extracting ISD-AS of AS certificate", err)
+	}
+	caIA, err := cppki.ExtractIA(chain[1].Subject)
+	if err != nil {
+		return serrors.Wrap("extracting ISD-AS of CA certificate", err)
+	}
+	if caIA.ISD() != ia.ISD() {
+		return serrors.New("CA certificate of other ISD", "as", ia, "ca", caIA)
+	}
+
+	state, err := TRCVerifier{DB: v.DB}.State(ctx, ia.ISD(), now)
+	switch {
+	case err == nil:
+		if err = verifyChain(chain, state.TRCs(), now); err == nil || !o.allowInactive {
+			return err
+		}
+	case !o.allowInactive:
+		return serrors.Wrap("loading active TRCs", err, "isd", ia.ISD())
+	}
+	if inactiveErr := v.verifyInactive(ctx, chain, ia.ISD(), now); inactiveErr != nil {
+		return serrors.Wrap("verifying chain", err, "inactive_trcs", inactiveErr)
+	}
+	return nil
+}
+
+// verifyInactive verifies the chain against the TRCs of the ISD in the
+// database that were valid when the AS certificate was issued, newest first.
+// The certificates of the chain must be valid at now, the root certificates at
+// the issuance.
+func (v ChainVerifier) verifyInactive(ctx context.Context, chain []*x509.Certificate,
+	isd addr.ISD, now time.Time) error {
+
+	for _, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return serrors.New("certificate not valid", "subject", cert.Subject,
+				"not_before", cert.NotBefore, "not_after", cert.NotAfter, "now", now)
+		}
+	}
+	issued := chain[0].NotBefore
+	trc, err := latestTRC(ctx, v.DB, isd)
+	for ; err == nil && !trc.IsZero(); trc, err = v.DB.SignedTRC(ctx, predecessorID(trc)) {
+		if trc.TRC.Validity.Contains(issued) &&
+			verifyChain(chain, []cppki.SignedTRC{trc}, issued) == nil {
+			return nil
+		}
+		if trc.TRC.ID.IsBase() {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return serrors.New("no TRC verifies the chain at issuance", "issued", issued)
+}
+
+// verifyChain verifies the chain against the root certificates of the TRCs at
+// the given time.
+func verifyChain(chain []*x509.Certificate, trcs []cppki.SignedTRC, now time.Time) error {
+	verifyOptions := cppki.VerifyOptions{CurrentTime: now}
+	for i := range trcs {
+		verifyOptions.TRC = append(verifyOptions.TRC, &trcs[i].TRC)
+	}
+	return cppki.VerifyChain(chain, verifyOptions)
+}
@@ -0,0 +1,119 @@
+package trust_test
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+func TestChainVerifier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	otherIA := addr.MustParseIA("2-ff00:0:210")
+
+	// The sensitive updates rotate the root, so the chains issued under the
+	// base TRC only verify against the base TRC.
+	setup := func(t *testing.T, isd *trusttest.ISD, grace time.Duration) trust.DB {
+		db := newDB(t)
+		v := trust.TRCVerifier{DB: db}
+		base := isd.TRC
+		if _, err := v.Insert(ctx, base); err != nil {
+			t.Fatal(err)
+		}
+		update := isd.Update(t, cppki.SensitiveUpdate, now.Add(-10*time.Minute), grace)
+		if _, err := v.Insert(ctx, update); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	tests := map[string]struct {
+		// chain returns the chain to verify. It is called before the TRC
+		// update.
+		chain   func(isd *trusttest.ISD) []*x509.Certificate
+		grace   time.Duration
+		at      time.Time
+		opts    []trust.Option
+		wantErr bool
+	}{
+		"active TRC": {
+			chain: func(isd *trusttest.ISD) []*x509.Certificate { return nil },
+		},
+		"grace TRC": {
+			chain: func(isd *trusttest.ISD) []*x509.Certificate { return isd.ASes[coreIA].Chain },
+			grace: time.Hour,
+		},
+		"inactive TRC": {
+			chain:   func(isd *trusttest.ISD) []*x509.Certificate { return isd.ASes[coreIA].Chain },
+			grace:   time.Minute,
+			wantErr: true,
+		},
+		"inactive TRC allowed": {
+			chain: func(isd *trusttest.ISD) []*x509.Certificate { return isd.ASes[coreIA].Chain },
+			grace: time.Minute,
+			opts:  []trust.Option{trust.AllowInactive()},
+		},
+		"inactive TRC allowed expired chain": {
+			chain:   func(isd *trusttest.ISD) []*x509.Certificate { return isd.ASes[coreIA].Chain },
+			grace:   time.Minute,
+			at:      now.Add(48 * time.Hour),
+			opts:    []trust.Option{trust.AllowInactive()},
+			wantErr: true,
+		},
+		"untrusted": {
+			chain: func(*trusttest.ISD) []*x509.Certificate {
+				return trusttest.NewISD(t, coreIA).ASes[coreIA].Chain
+			},
+			opts:    []trust.Option{trust.AllowInactive()},
+			wantErr: true,
+		},
+		"other ISD": {
+			chain: func(*trusttest.ISD) []*x509.Certificate {
+				return trusttest.NewISD(t, otherIA).ASes[otherIA].Chain
+			},
+			wantErr: true,
+		},
+		"wrong order": {
+			chain: func(isd *trusttest.ISD) []*x509.Certificate {
+				chain := isd.ASes[coreIA].Chain
+				return []*x509.Certificate{chain[1], chain[0]}
+			},
+			grace:   time.Hour,
+			wantErr: true,
+		},
+		"expired": {
+			chain:   func(isd *trusttest.ISD) []*x509.Certificate { return nil },
+			at:      now.Add(48 * time.Hour),
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			isd := trusttest.NewISD(t, coreIA)
+			chain := tc.chain(isd)
+			db := setup(t, isd, tc.grace)
+			// A nil chain selects the chain issued under the update.
+			if chain == nil {
+				chain = isd.ASes[coreIA].Chain
+			}
+			at := tc.at
+			if at.IsZero() {
+				at = now
+			}
+			err := trust.ChainVerifier{DB: db}.Verify(ctx, chain, at, tc.opts...)
+			if tc.wantErr && err == nil {
+				t.Error("Verify should fail")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Verify failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/scrypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+// Fetcher fetches trust material from a remote.
+type Fetcher interface {
+	// Chains fetches certificate chains that match the query from the remote.
+	Chains(ctx context.Context, req ChainQuery, server net.Addr) ([][]*x509.Certificate, error)
+	// TRC fetches a specific TRC from the remote.
+	TRC(ctx context.Context, id cppki.TRCID, server net.Addr) (cppki.SignedTRC, error)
+}
+
+// FetchingProvider provides crypto material. The fetching provider is capable
+// of fetching missing crypto material from the server given by the Server
+// option.
+type FetchingProvider struct {
+	// DB stores the trust material.
+	DB DB
+	// Recurser decides whether a client may trigger fetching. Nil means
+	// LocalOnlyRecurser.
+	Recurser Recurser
+	// Fetcher fetches missing trust material.
+	Fetcher Fetcher
+
+	flights group
+}
+
+var _ Provider = (*FetchingProvider)(nil)
+
+// GetChains returns certificate chains that match the chain query. If no chain
+// is locally available, they are fetched over the network.
+//
+// Chains are verified with the ChainVerifier, which honours the AllowInactive
+// option for chains in the database. Fetched chains are always verified
+// against the active TRCs before they are inserted, and chains that are not
+// verifiable are ignored.
+func (p *FetchingProvider) GetChains(ctx context.Context, query ChainQuery,
+	opts ...Option) ([][]*x509.Certificate, error) {
+
+	o := applyOptions(opts)
+	if query.IA.IsWildcard() {
+		return nil, serrors.New("ISD-AS must not contain a wildcard", "isd_as", query.IA)
+	}
+	chains, err := p.DB.Chains(ctx, query)
+	if err != nil {
+		return nil, serrors.Wrap("fetching chains from database", err)
+	}
+	if chains = p.filterChains(ctx, chains, query, opts...); len(chains) > 0 {
+		return chains, nil
+	}
+	// Without active TRCs, fetched chains cannot be verified either.
+	if _, err := activeTRCs(ctx, p.DB, query.IA.ISD()); err != nil {
+		return nil, serrors.Wrap("fetching active TRCs from database", err)
+	}
+
+	if err := p.allowFetch(o); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("chains-%s-%x-%s-%s", query.IA, query.SubjectKeyID, query.Validity, o.server)
+	v, err := p.flights.do(key, func() (any, error) {
+		fetched, err := p.Fetcher.Chains(ctx, query, o.server)
+		if err != nil {
+			return nil, serrors.Wrap("fetching chains from remote", err, "server", o.server)
+		}
+		fetched = p.filterChains(ctx, fetched, query)
+		for _, chain := range fetched {
+			if _, err := p.DB.InsertChain(ctx, chain); err != nil {
+				return nil, serrors.Wrap("inserting chain into database", err)
+			}
+		}
+		return fetched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([][]*x509.Certificate), nil
+}
+
+// GetSignedTRC returns the TRC with the given ID. TRCs newer than the latest
+// TRC in the database are fetched over the network and verified as updates of
+// the latest TRC. Missing older TRCs are not fetched, and the zero value is
+// returned.
+func (p *FetchingProvider) GetSignedTRC(ctx context.Context, id cppki.TRCID,
+	opts ...Option) (cppki.SignedTRC, error) {
+
+	trc, err := p.DB.SignedTRC(ctx, id)
+	if err != nil || !trc.IsZero() || id.Base.IsLatest() || id.Serial.IsLatest() {
+		return trc, err
+	}
+	if err := p.NotifyTRC(ctx, id, opts...); err != nil {
+		return cppki.SignedTRC{}, err
+	}
+	return p.DB.SignedTRC(ctx, id)
+}
+
+// NotifyTRC notifies the provider of the existence of a TRC. Missing TRC
+// updates up to the given TRC are fetched and inserted in order, and each of
+// them must verify as update of its predecessor with TRCVerifier.
+// This method only fails in case of a DB, network or verification error.
+func (p *FetchingProvider) NotifyTRC(ctx context.Context, id cppki.TRCID, opts ...Option) error {
+	o := applyOptions(opts)
+	trc, err := p.DB.SignedTRC(ctx, cppki.TRCID{
+		ISD:    id.ISD,
+		Base:   scrypto.LatestVer,
+		Serial: scrypto.LatestVer,
+	})
+	if err != nil {
+		return err
+	}
+	if trc.IsZero() {
+		return serrors.New("no TRC for ISD present", "isd", id.ISD)
+	}
+	if trc.TRC.ID.Base != id.Base {
+		return serrors.New("base number mismatch", "expected", trc.TRC.ID.Base, "actual", id.Base)
+	}
+	if id.Serial <= trc.TRC.ID.Serial {
+		return nil
+	}
+	if err := p.allowFetch(o); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("trc-%s-%s", id, o.server)
+	_, err = p.flights.do(key, func() (any, error) {
+		// In general, only one TRC update is missing, so sequential fetching
+		// is fine.
+		for serial := trc.TRC.ID.Serial + 1; serial <= id.Serial; serial++ {
+			toFetch := cppki.TRCID{ISD: id.ISD, Base: id.Base, Serial: serial}
+			fetched, err := p.Fetcher.TRC(ctx, toFetch, o.server)
+			if err != nil {
+				return nil, serrors.Wrap("resolving TRC update", err, "id", toFetch)
+			}
+			if fetched.TRC.ID != toFetch {
+				return nil, serrors.New("received wrong TRC",
+					"expected", toFetch, "actual", fetched.TRC.ID)
+			}
+			if _, err := (TRCVerifier{DB: p.DB}).Insert(ctx, fetched); err != nil {
+				return nil, serrors.Wrap("inserting TRC update", err, "id", toFetch)
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// allowFetch returns an error if the options do not permit fetching.
+func (p *FetchingProvider) allowFetch(o options) error {
+	recurser := p.Recurser
+	if recurser == nil {
+		recurser = LocalOnlyRecurser{}
+	}
+	if err := recurser.AllowRecursion(o.client); err != nil {
+		return serrors.Wrap("checking whether recursion is allowed", err)
+	}
+	if o.server == nil {
+		return serrors.New("no server to fetch trust material from")
+	}
+	if p.Fetcher == nil {
+		return serrors.New("no fetcher configured")
+	}
+	return nil
+}
+
+// filterChains returns the chains that match the query and verify with the
+// ChainVerifier.
+func (p *FetchingProvider) filterChains(ctx context.Context, chains [][]*x509.Certificate,
+	query ChainQuery, opts ...Option) [][]*x509.Certificate {
+
+	verifier := ChainVerifier{DB: p.DB}
+	verified := make([][]*x509.Certificate, 0, len(chains))
+	for _, chain := range chains {
+		if matchesQuery(chain, query) && verifier.Verify(ctx, chain, time.Now(), opts...) == nil {
+			verified = append(verified, chain)
+		}
+	}
+	return verified
+}
+
+// matchesQuery reports whether the chain matches the query in the same way as
+// DB.Chains.
+func matchesQuery(chain []*x509.Certificate, query ChainQuery) bool {
+	if len(chain) != 2 {
+		return false
+	}
+	ia, err := cppki.ExtractIA(chain[0].Subject)
+	if err != nil || !ia.Equal(query.IA) {
+		return false
+	}
+	if !bytes.HasPrefix(chain[0].SubjectKeyId, query.SubjectKeyID) {
+		return false
+	}
+	return (query.Validity.NotBefore.IsZero() || !chain[0].NotBefore.After(query.Validity.NotBefore)) &&
+		(query.Validity.NotAfter.IsZero() || !chain[0].NotAfter.Before(query.Validity.NotAfter))
+}
+
+// group de-duplicates concurrent calls with the same key. Callers that join a
+// call in flight share its result, including errors caused by the context of
+// the first caller. The zero value is ready to use.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+func (g *group) do(key string, fn func() (any, error)) (any, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	close(c.done)
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, c.err
+}
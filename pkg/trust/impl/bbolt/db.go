@@ -53,6 +53,10 @@ func (b *bboltDB) Chains(ctx context.Context, query trust.ChainQuery) ([][]*x509
 		c := b.Cursor()
 
 		for k, _ := c.Seek(ia); k != nil && bytes.HasPrefix(k, ia); k, _ = c.Next() {
+			// 1-ff00:0:1 is a prefix of 1-ff00:0:110.
+			if ia != nil && !bytes.Equal(k, ia) {
+				continue
+			}
 			c := b.Bucket(k).Cursor()
 
 			for k, v := c.Seek(query.SubjectKeyID); k != nil && bytes.HasPrefix(k, query.SubjectKeyID); k, v = c.Next() {
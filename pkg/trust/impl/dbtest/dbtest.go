@@ -316,6 +316,17 @@ func testChain(t *testing.T, db trust.DB, cfg Config) {
 				t.Errorf("Chains should return empty slice for non-existing chain, got %v", chains)
 			}
 		})
+		t.Run("AS with common prefix", func(t *testing.T) {
+			chains, err := db.Chains(ctx, trust.ChainQuery{
+				IA: addr.MustParseIA("1-ff00:0:11"),
+			})
+			if err != nil {
+				t.Errorf("Chains failed: %v", err)
+			}
+			if len(chains) != 0 {
+				t.Errorf("Chains should only return chains of the exact ISD-AS, got %v", chains)
+			}
+		})
 		t.Run("Existing chain no overlap", func(t *testing.T) {
 			chains, err := db.Chains(ctx, trust.ChainQuery{
 				IA:           addr.MustParseIA("1-ff00:0:110"),
@@ -36,7 +36,8 @@ type Signer struct {
 }
 
 // Sign signs the message with the associated data and returns a SignedMessage protobuf payload. The
-// associated data is not included in the header or body of the signed message.
+// associated data is not included in the header or body of the signed message. Expired signers
+// refuse to sign.
 func (s Signer) Sign(
 	ctx context.Context,
 	msg []byte,
@@ -44,6 +45,9 @@ func (s Signer) Sign(
 ) (*cryptopb.SignedMessage, error) {
 
 	now := time.Now()
+	if err := s.validate(ctx, now); err != nil {
+		return nil, err
+	}
 
 	id := &cppb.VerificationKeyID{
 		IsdAs:        uint64(s.IA),
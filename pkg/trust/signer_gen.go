@@ -0,0 +1,260 @@
+package trust
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/log"
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+)
+
+// KeyRing provides private keys.
+type KeyRing interface {
+	PrivateKeys(ctx context.Context) ([]crypto.Signer, error)
+}
+
+// KeyDir is a KeyRing that loads the PEM encoded PKCS#8 private keys from the
+// files with the .key extension in a directory. Keys are reloaded when a file
+// is added, removed or modified. Files that cannot be loaded are logged and
+// skipped, so that a single bad file does not hide the other keys.
+type KeyDir struct {
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]keyFile
+}
+
+type keyFile struct {
+	modTime time.Time
+	key     crypto.Signer
+}
+
+// PrivateKeys returns the keys in the directory that can be loaded.
+func (d *KeyDir) PrivateKeys(ctx context.Context) ([]crypto.Signer, error) {
+	names, err := filepath.Glob(filepath.Join(d.Dir, "*.key"))
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := make(map[string]keyFile, len(names))
+	keys := make([]crypto.Signer, 0, len(names))
+	logger := log.FromCtx(ctx)
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			logger.Error("Skipping private key", "file", name, "err", err)
+			continue
+		}
+		f, ok := d.files[name]
+		if !ok || !f.modTime.Equal(info.ModTime()) {
+			key, err := LoadPrivateKey(name)
+			if err != nil {
+				logger.Error("Skipping private key", "file", name, "err", err)
+				continue
+			}
+			f = keyFile{modTime: info.ModTime(), key: key}
+		}
+		files[name] = f
+		keys = append(keys, f.key)
+	}
+	d.files = files
+	return keys, nil
+}
+
+// LoadPrivateKey loads a PEM encoded PKCS#8 private key from the file.
+func LoadPrivateKey(file string) (crypto.Signer, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, serrors.New("no PEM encoded private key", "file", file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, serrors.Wrap("parsing private key", err, "file", file)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, serrors.New("private key cannot sign", "file", file)
+	}
+	return signer, nil
+}
+
+// WritePrivateKey writes the key to the file as PEM encoded PKCS#8 private key.
+// The file is replaced atomically, so a KeyDir never loads a partial key.
+func WritePrivateKey(file string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return serrors.Wrap("encoding private key", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// KeySignerGen generates signers from the keys of a key ring and the
+// certificate chains in the database. Keys and chains are looked up on every
+// call, so renewed keys and newly installed chains are picked up
+// automatically.
+type KeySignerGen struct {
+	IA      addr.IA
+	KeyRing KeyRing
+	DB      DB
+	// ExtKeyUsage filters the chains for a specific key usage. The zero value
+	// x509.ExtKeyUsageAny does not filter.
+	ExtKeyUsage x509.ExtKeyUsage
+}
+
+var _ SignerGen = KeySignerGen{}
+
+// Generate returns a signer for every key that is authenticated by a chain
+// that verifies against the active TRCs of the local ISD. For each key, the
+// chain with the latest expiration is used. Chains that only verify against
+// the predecessor of the active TRC during its grace period are used if no
+// other chain is available, and the signer expires with the grace period.
+func (g KeySignerGen) Generate(ctx context.Context) ([]Signer, error) {
+	keys, err := g.KeyRing.PrivateKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, serrors.New("no private key found")
+	}
+	now := time.Now()
+	state, err := TRCVerifier{DB: g.DB}.State(ctx, g.IA.ISD(), now)
+	if err != nil {
+		return nil, serrors.Wrap("loading TRC", err)
+	}
+	var signers []Signer
+	for _, key := range keys {
+		signer, err := g.bestForKey(ctx, key, state, now)
+		if err != nil {
+			return nil, err
+		}
+		if signer != nil {
+			signers = append(signers, *signer)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, serrors.New("no certificate found", "num_private_keys", len(keys))
+	}
+	return signers, nil
+}
+
+// Best returns the generated signer that expires last.
+func (g KeySignerGen) Best(ctx context.Context) (Signer, error) {
+	signers, err := g.Generate(ctx)
+	if err != nil {
+		return Signer{}, err
+	}
+	now := time.Now()
+	return LastExpiring(signers, cppki.Validity{NotBefore: now, NotAfter: now})
+}
+
+func (g KeySignerGen) bestForKey(ctx context.Context, key crypto.Signer, state TRCState,
+	now time.Time) (*Signer, error) {
+
+	skid, err := cppki.SubjectKeyID(key.Public())
+	if err != nil {
+		// Other keys may still have a matching chain.
+		log.FromCtx(ctx).Error("Skipping private key without subject key ID", "err", err)
+		return nil, nil
+	}
+	algo, err := signed.SelectSignatureAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	chains, err := g.DB.Chains(ctx, ChainQuery{
+		IA:           g.IA,
+		SubjectKeyID: skid,
+		Validity:     cppki.Validity{NotBefore: now, NotAfter: now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if g.ExtKeyUsage != x509.ExtKeyUsageAny {
+		filtered := chains[:0]
+		for _, chain := range chains {
+			if verifyExtendedKeyUsage(chain[0], g.ExtKeyUsage) == nil {
+				filtered = append(filtered, chain)
+			}
+		}
+		chains = filtered
+	}
+
+	active := state.Active.TRC
+	chain, inGrace := bestChain(chains, active, now), false
+	if chain == nil && !state.Grace.IsZero() {
+		chain, inGrace = bestChain(chains, state.Grace.TRC, now), true
+	}
+	if chain == nil {
+		return nil, nil
+	}
+	expiration := minTime(chain[0].NotAfter, active.Validity.NotAfter)
+	if inGrace {
+		// The chain can only be used until the end of the grace period or the
+		// expiration of the previous TRC.
+		expiration = minTime(expiration, active.GracePeriodEnd(), state.Grace.TRC.Validity.NotAfter)
+	}
+	return &Signer{
+		PrivateKey:   key,
+		Algorithm:    algo,
+		IA:           g.IA,
+		Subject:      chain[0].Subject,
+		Chain:        chain,
+		SubjectKeyID: chain[0].SubjectKeyId,
+		Expiration:   expiration,
+		TRCID:        active.ID,
+		ChainValidity: cppki.Validity{
+			NotBefore: chain[0].NotBefore,
+			NotAfter:  chain[0].NotAfter,
+		},
+		InGrace: inGrace,
+	}, nil
+}
+
+// bestChain returns the chain that verifies against the TRC and expires last.
+func bestChain(chains [][]*x509.Certificate, trc cppki.TRC, now time.Time) []*x509.Certificate {
+	var best []*x509.Certificate
+	for _, chain := range chains {
+		err := cppki.VerifyChain(chain, cppki.VerifyOptions{TRC: []*cppki.TRC{&trc}, CurrentTime: now})
+		if err != nil {
+			continue
+		}
+		if best == nil || chain[0].NotAfter.After(best[0].NotAfter) {
+			best = chain
+		}
+	}
+	return best
+}
+
+func minTime(t time.Time, ts ...time.Time) time.Time {
+	for _, o := range ts {
+		if o.Before(t) {
+			t = o
+		}
+	}
+	return t
+}
@@ -0,0 +1,194 @@
+package trust_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+func writeKey(t *testing.T, file string, key crypto.Signer) {
+	t.Helper()
+	raw, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySignerGen(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := map[string]struct {
+		// update is the grace period of a sensitive update inserted after the
+		// chain of the base TRC, or zero for no update.
+		update      time.Duration
+		noChain     bool
+		extKeyUsage x509.ExtKeyUsage
+		wantGrace   bool
+		wantErr     bool
+	}{
+		"active TRC": {},
+		"grace TRC": {
+			update:    time.Hour,
+			wantGrace: true,
+		},
+		"inactive TRC": {
+			update:  time.Minute,
+			wantErr: true,
+		},
+		"no chain": {
+			noChain: true,
+			wantErr: true,
+		},
+		"key usage": {
+			extKeyUsage: x509.ExtKeyUsageServerAuth,
+		},
+		"missing key usage": {
+			extKeyUsage: x509.ExtKeyUsageCodeSigning,
+			wantErr:     true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			isd := trusttest.NewISD(t, coreIA)
+			as := isd.ASes[coreIA]
+			db := newDB(t)
+			v := trust.TRCVerifier{DB: db}
+			if _, err := v.Insert(ctx, isd.TRC); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.noChain {
+				if _, err := db.InsertChain(ctx, as.Chain); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.update != 0 {
+				update := isd.Update(t, cppki.SensitiveUpdate, now.Add(-10*time.Minute), tc.update)
+				if _, err := v.Insert(ctx, update); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := t.TempDir()
+			writeKey(t, filepath.Join(dir, "cp-as.key"), as.Key)
+
+			gen := trust.KeySignerGen{
+				IA:          coreIA,
+				KeyRing:     &trust.KeyDir{Dir: dir},
+				DB:          db,
+				ExtKeyUsage: tc.extKeyUsage,
+			}
+			signers, err := gen.Generate(ctx)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Generate should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if len(signers) != 1 {
+				t.Fatalf("got %d signers, want 1", len(signers))
+			}
+			s := signers[0]
+			if s.TRCID != isd.TRC.TRC.ID {
+				t.Errorf("TRC ID %s, want %s", s.TRCID, isd.TRC.TRC.ID)
+			}
+			if s.InGrace != tc.wantGrace {
+				t.Errorf("InGrace %v, want %v", s.InGrace, tc.wantGrace)
+			}
+			if !s.Chain[0].Equal(as.Chain[0]) {
+				t.Error("signer uses another chain")
+			}
+			if s.ChainValidity.NotAfter != as.Chain[0].NotAfter {
+				t.Errorf("chain validity ends %v, want %v", s.ChainValidity.NotAfter, as.Chain[0].NotAfter)
+			}
+			wantExpiration := as.Chain[0].NotAfter
+			if tc.wantGrace {
+				wantExpiration = isd.TRC.TRC.GracePeriodEnd()
+			}
+			if !s.Expiration.Equal(wantExpiration) {
+				t.Errorf("expiration %v, want %v", s.Expiration, wantExpiration)
+			}
+		})
+	}
+
+	t.Run("bad key file", func(t *testing.T) {
+		isd := trusttest.NewISD(t, coreIA)
+		as := isd.ASes[coreIA]
+		db := newDB(t)
+		if _, err := (trust.TRCVerifier{DB: db}).Insert(ctx, isd.TRC); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.InsertChain(ctx, as.Chain); err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		writeKey(t, filepath.Join(dir, "cp-as.key"), as.Key)
+		if err := os.WriteFile(filepath.Join(dir, "bad.key"), []byte("bad"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		gen := trust.KeySignerGen{IA: coreIA, KeyRing: &trust.KeyDir{Dir: dir}, DB: db}
+		signers, err := gen.Generate(ctx)
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if len(signers) != 1 || !signers[0].Chain[0].Equal(as.Chain[0]) {
+			t.Errorf("got %d signers, want the signer of the good key", len(signers))
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		isd := trusttest.NewISD(t, coreIA)
+		old := isd.ASes[coreIA]
+		db := newDB(t)
+		v := trust.TRCVerifier{DB: db}
+		if _, err := v.Insert(ctx, isd.TRC); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.InsertChain(ctx, old.Chain); err != nil {
+			t.Fatal(err)
+		}
+		update := isd.Update(t, cppki.SensitiveUpdate, now.Add(-10*time.Minute), time.Hour)
+		if _, err := v.Insert(ctx, update); err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		writeKey(t, filepath.Join(dir, "old.key"), old.Key)
+		gen := trust.KeySignerGen{IA: coreIA, KeyRing: &trust.KeyDir{Dir: dir}, DB: db}
+		s, err := gen.Best(ctx)
+		if err != nil {
+			t.Fatalf("Best failed: %v", err)
+		}
+		if !s.InGrace {
+			t.Error("signer of the previous TRC should be in grace")
+		}
+
+		// The chain issued under the update and its key are installed.
+		renewed := isd.ASes[coreIA]
+		if _, err := db.InsertChain(ctx, renewed.Chain); err != nil {
+			t.Fatal(err)
+		}
+		writeKey(t, filepath.Join(dir, "new.key"), renewed.Key)
+		s, err = gen.Best(ctx)
+		if err != nil {
+			t.Fatalf("Best failed: %v", err)
+		}
+		if s.InGrace || !s.Chain[0].Equal(renewed.Chain[0]) {
+			t.Error("Best should pick the chain issued under the update")
+		}
+	})
+}
@@ -0,0 +1,317 @@
+package trust
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/log"
+	"github.com/scionproto/scion/pkg/private/serrors"
+	cryptopb "github.com/scionproto/scion/pkg/proto/crypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+var (
+	// DefaultSignerRefreshInterval is the default interval between two
+	// refreshes of the signer.
+	DefaultSignerRefreshInterval = time.Minute
+	// DefaultRenewBefore is the default time before the expiration of the
+	// signer at which its chain is renewed.
+	DefaultRenewBefore = 24 * time.Hour
+	// DefaultRenewTimeout is the default timeout of a renewal.
+	DefaultRenewTimeout = 30 * time.Second
+	// DefaultExpiryThresholds are the default times before the expiration of
+	// the signer at which a warning is emitted.
+	DefaultExpiryThresholds = []time.Duration{12 * time.Hour, time.Hour, 10 * time.Minute}
+)
+
+// SignerEventType is the type of a SignerEvent.
+type SignerEventType int
+
+const (
+	// SignerChanged is emitted when another signer is selected.
+	SignerChanged SignerEventType = iota
+	// SignerExpiring is emitted when the remaining lifetime of the signer
+	// crosses an expiry threshold.
+	SignerExpiring
+	// SignerRenewalFailed is emitted when renewing the chain of the signer
+	// failed.
+	SignerRenewalFailed
+	// SignerExpired is emitted when the signer has expired and no other
+	// signer is available.
+	SignerExpired
+)
+
+func (t SignerEventType) String() string {
+	switch t {
+	case SignerChanged:
+		return "changed"
+	case SignerExpiring:
+		return "expiring"
+	case SignerRenewalFailed:
+		return "renewal failed"
+	case SignerExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("SignerEventType(%d)", int(t))
+	}
+}
+
+// SignerEvent is a change in the lifecycle of the signer.
+type SignerEvent struct {
+	Type SignerEventType
+	// Signer is the signer the event refers to.
+	Signer Signer
+	// Remaining is the remaining lifetime of the signer.
+	Remaining time.Duration
+	// Err is the error of a failed renewal.
+	Err error
+}
+
+// Renewer renews the certificate chain of a signer. Once Renew returns, the
+// renewed key and chain must be generated by the SignerGen of the
+// SignerManager, e.g. by writing the key to the KeyDir and inserting the chain
+// into the DB of a KeySignerGen. controlplane.Renewer renews the chain at the
+// CA of a core or authoritative AS.
+type Renewer interface {
+	Renew(ctx context.Context, signer Signer) error
+}
+
+// SignerManager manages the lifecycle of the signer of the local AS. It
+// selects the signer that expires last, renews its chain ahead of the
+// expiration and emits events as the expiration approaches. It signs with the
+// selected signer and refuses to sign once no signer is valid, so no message
+// goes out with an expired key. SignerManager implements the signer interfaces
+// of beaconing, discovery and the secure underlay.
+type SignerManager struct {
+	// SignerGen generates the candidate signers.
+	SignerGen SignerGen
+	// Renewer renews the chain of the signer. Nil disables renewal.
+	Renewer Renewer
+	// RenewBefore is the time before the expiration of the signer at which its
+	// chain is renewed. Zero means DefaultRenewBefore.
+	RenewBefore time.Duration
+	// RenewTimeout bounds the duration of a renewal. Zero means
+	// DefaultRenewTimeout.
+	RenewTimeout time.Duration
+	// ExpiryThresholds are the times before the expiration of the signer at
+	// which a warning is logged and a SignerExpiring event is emitted. Nil
+	// means DefaultExpiryThresholds.
+	ExpiryThresholds []time.Duration
+	// Events receives the lifecycle events. It is called synchronously and
+	// must not call the SignerManager. Nil means events are only logged.
+	Events func(SignerEvent)
+	// Interval is the interval between two refreshes in Run. Zero means
+	// DefaultSignerRefreshInterval.
+	Interval time.Duration
+
+	mu     sync.Mutex
+	signer Signer
+	// warned is the smallest expiry threshold crossed by the signer.
+	warned time.Duration
+	// expired is set once the SignerExpired event is emitted for the signer.
+	expired bool
+	// renewing is set while the chain of the signer is renewed.
+	renewing bool
+}
+
+// Run refreshes the signer until the context is cancelled.
+func (m *SignerManager) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval == 0 {
+		interval = DefaultSignerRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Refresh(ctx); err != nil {
+			log.FromCtx(ctx).Error("Refreshing signer", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh selects the signer that expires last, and renews its chain if it is
+// about to expire. The selected signer keeps signing while the chain is
+// renewed.
+func (m *SignerManager) Refresh(ctx context.Context) error {
+	m.mu.Lock()
+	signer, renew, err := m.refresh(ctx, time.Now())
+	if renew {
+		m.renewing = true
+	}
+	m.mu.Unlock()
+	if err != nil || !renew {
+		return err
+	}
+
+	timeout := m.RenewTimeout
+	if timeout == 0 {
+		timeout = DefaultRenewTimeout
+	}
+	renewCtx, cancel := context.WithTimeout(ctx, timeout)
+	renewErr := m.Renewer.Renew(renewCtx, signer)
+	cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewing = false
+	now := time.Now()
+	if renewErr != nil {
+		m.emit(ctx, SignerEvent{Type: SignerRenewalFailed, Err: renewErr}, now)
+		// The warnings matter most while the renewal fails.
+		m.checkExpiring(ctx, now)
+		return serrors.Wrap("renewing signer", renewErr)
+	}
+	if err := m.selectSigner(ctx, now); err != nil {
+		m.checkExpired(ctx, now)
+		return serrors.Wrap("selecting renewed signer", err)
+	}
+	m.checkExpiring(ctx, now)
+	return nil
+}
+
+// refresh selects the signer and reports whether its chain must be renewed,
+// unless a renewal is already in progress. m.mu must be held.
+func (m *SignerManager) refresh(ctx context.Context, now time.Time) (Signer, bool, error) {
+	if err := m.selectSigner(ctx, now); err != nil {
+		m.checkExpired(ctx, now)
+		return Signer{}, false, err
+	}
+	renewBefore := m.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	if m.Renewer != nil && !m.renewing && m.signer.Expiration.Sub(now) < renewBefore {
+		return m.signer, true, nil
+	}
+	m.checkExpiring(ctx, now)
+	return m.signer, false, nil
+}
+
+// selectSigner generates the signers and selects the one that expires last.
+func (m *SignerManager) selectSigner(ctx context.Context, now time.Time) error {
+	signers, err := m.SignerGen.Generate(ctx)
+	if err != nil {
+		return err
+	}
+	best, err := LastExpiring(signers, cppki.Validity{NotBefore: now, NotAfter: now})
+	if err != nil {
+		return err
+	}
+	if !best.Equal(m.signer) {
+		m.signer, m.warned, m.expired = best, 0, false
+		m.emit(ctx, SignerEvent{Type: SignerChanged}, now)
+	}
+	return nil
+}
+
+// checkExpiring emits a SignerExpiring event for the smallest threshold
+// crossed by the signer, unless it was already emitted.
+func (m *SignerManager) checkExpiring(ctx context.Context, now time.Time) {
+	thresholds := m.ExpiryThresholds
+	if thresholds == nil {
+		thresholds = DefaultExpiryThresholds
+	}
+	remaining := m.signer.Expiration.Sub(now)
+	crossed := time.Duration(0)
+	for _, th := range thresholds {
+		if remaining <= th && (crossed == 0 || th < crossed) {
+			crossed = th
+		}
+	}
+	if crossed != 0 && (m.warned == 0 || crossed < m.warned) {
+		m.warned = crossed
+		m.emit(ctx, SignerEvent{Type: SignerExpiring}, now)
+	}
+}
+
+// checkExpired emits a SignerExpired event once the current signer has
+// expired.
+func (m *SignerManager) checkExpired(ctx context.Context, now time.Time) {
+	if m.signer.PrivateKey == nil || m.expired || now.Before(m.signer.Expiration) {
+		return
+	}
+	m.expired = true
+	m.emit(ctx, SignerEvent{Type: SignerExpired}, now)
+}
+
+func (m *SignerManager) emit(ctx context.Context, e SignerEvent, now time.Time) {
+	e.Signer = m.signer
+	e.Remaining = m.signer.Expiration.Sub(now)
+	logger := log.FromCtx(ctx)
+	attrs := []any{
+		"event", e.Type,
+		"subject_key_id", fmt.Sprintf("%x", e.Signer.SubjectKeyID),
+		"expiration", e.Signer.Expiration,
+	}
+	switch e.Type {
+	case SignerChanged:
+		logger.Info("Signer selected", attrs...)
+	case SignerRenewalFailed:
+		logger.Error("Signer renewal failed", append(attrs, "err", e.Err)...)
+	default:
+		logger.Info("Signer lifecycle warning", append(attrs, "remaining", e.Remaining)...)
+	}
+	if m.Events != nil {
+		m.Events(e)
+	}
+}
+
+// Signer returns the selected signer. A signer is selected if none is
+// selected yet or the selected signer has expired. An error is returned if no
+// valid signer is available.
+func (m *SignerManager) Signer(ctx context.Context) (Signer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current(ctx, time.Now())
+}
+
+func (m *SignerManager) current(ctx context.Context, now time.Time) (Signer, error) {
+	if m.signer.PrivateKey == nil || !now.Before(m.signer.Expiration) {
+		if err := m.selectSigner(ctx, now); err != nil {
+			m.checkExpired(ctx, now)
+			return Signer{}, serrors.Wrap("no valid signer", err)
+		}
+	}
+	return m.signer, nil
+}
+
+// Sign signs the message with the selected signer.
+func (m *SignerManager) Sign(ctx context.Context, msg []byte,
+	associatedData ...[]byte) (*cryptopb.SignedMessage, error) {
+
+	s, err := m.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(ctx, msg, associatedData...)
+}
+
+// SignCMS signs the message with the selected signer and returns a CMS/PKCS7
+// encoded payload.
+func (m *SignerManager) SignCMS(ctx context.Context, msg []byte) ([]byte, error) {
+	s, err := m.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.SignCMS(ctx, msg)
+}
+
+// Validity returns the validity of the selected signer. It is the zero value
+// if no valid signer is available.
+func (m *SignerManager) Validity() cppki.Validity {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, err := m.current(context.Background(), time.Now())
+	if err != nil {
+		return cppki.Validity{}
+	}
+	return s.Validity()
+}
@@ -0,0 +1,209 @@
+package trust_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+// staticGen generates a fixed set of signers that can be replaced.
+type staticGen struct {
+	mu      sync.Mutex
+	signers []trust.Signer
+}
+
+func (g *staticGen) Generate(context.Context) ([]trust.Signer, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.signers), nil
+}
+
+func (g *staticGen) set(signers ...trust.Signer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.signers = signers
+}
+
+// renewerFunc renews signers with a function.
+type renewerFunc func(ctx context.Context, signer trust.Signer) error
+
+func (f renewerFunc) Renew(ctx context.Context, signer trust.Signer) error { return f(ctx, signer) }
+
+func TestSignerSignExpired(t *testing.T) {
+	signer := trusttest.NewISD(t, coreIA).Signer(coreIA)
+	signer.Expiration = time.Now().Add(-time.Second)
+	if _, err := signer.Sign(context.Background(), []byte("msg")); err == nil {
+		t.Error("Sign should fail for an expired signer")
+	}
+}
+
+func TestSignerManager(t *testing.T) {
+	ctx := context.Background()
+	isd := trusttest.NewISD(t, coreIA)
+	withExpiry := func(d time.Duration) trust.Signer {
+		s := isd.Signer(coreIA)
+		s.Expiration = time.Now().Add(d)
+		return s
+	}
+
+	tests := map[string]struct {
+		expiry     time.Duration
+		renewed    time.Duration
+		renewErr   error
+		wantEvents []trust.SignerEventType
+		wantErr    bool
+	}{
+		"valid": {
+			expiry:     48 * time.Hour,
+			wantEvents: []trust.SignerEventType{trust.SignerChanged},
+		},
+		"expiring": {
+			expiry: 30 * time.Minute,
+			wantEvents: []trust.SignerEventType{
+				trust.SignerChanged,
+				trust.SignerRenewalFailed,
+				trust.SignerExpiring,
+			},
+			renewErr: errors.New("CA unreachable"),
+			wantErr:  true,
+		},
+		"renewed": {
+			expiry:  30 * time.Minute,
+			renewed: 72 * time.Hour,
+			wantEvents: []trust.SignerEventType{
+				trust.SignerChanged,
+				trust.SignerChanged,
+			},
+		},
+		"renewed but expiring": {
+			expiry:  30 * time.Minute,
+			renewed: 5 * time.Hour,
+			wantEvents: []trust.SignerEventType{
+				trust.SignerChanged,
+				trust.SignerChanged,
+				trust.SignerExpiring,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gen := &staticGen{signers: []trust.Signer{withExpiry(tc.expiry)}}
+			var events []trust.SignerEventType
+			m := &trust.SignerManager{
+				SignerGen: gen,
+				Renewer: renewerFunc(func(context.Context, trust.Signer) error {
+					if tc.renewErr != nil {
+						return tc.renewErr
+					}
+					gen.set(withExpiry(tc.renewed))
+					return nil
+				}),
+				ExpiryThresholds: []time.Duration{12 * time.Hour, 10 * time.Minute},
+				Events:           func(e trust.SignerEvent) { events = append(events, e.Type) },
+			}
+			err := m.Refresh(ctx)
+			if tc.wantErr && err == nil {
+				t.Error("Refresh should fail")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Refresh failed: %v", err)
+			}
+			if !slices.Equal(events, tc.wantEvents) {
+				t.Errorf("events %v, want %v", events, tc.wantEvents)
+			}
+			if _, err := m.Sign(ctx, []byte("msg")); err != nil {
+				t.Errorf("Sign failed: %v", err)
+			}
+		})
+	}
+
+	t.Run("thresholds", func(t *testing.T) {
+		gen := &staticGen{signers: []trust.Signer{withExpiry(11 * time.Hour)}}
+		var events []trust.SignerEvent
+		m := &trust.SignerManager{
+			SignerGen:        gen,
+			ExpiryThresholds: []time.Duration{12 * time.Hour, 10 * time.Minute},
+			Events:           func(e trust.SignerEvent) { events = append(events, e) },
+		}
+		for range 2 {
+			if err := m.Refresh(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// A threshold is only reported once per signer.
+		if len(events) != 2 || events[1].Type != trust.SignerExpiring {
+			t.Fatalf("unexpected events %v", events)
+		}
+		if events[1].Remaining > 11*time.Hour {
+			t.Errorf("remaining %v, want at most 11h", events[1].Remaining)
+		}
+
+		gen.set(withExpiry(5 * time.Minute))
+		if err := m.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(events); n != 4 || events[n-1].Type != trust.SignerExpiring {
+			t.Errorf("expected a warning for the next threshold, got %v", events)
+		}
+	})
+
+	t.Run("renewal does not block signing", func(t *testing.T) {
+		gen := &staticGen{signers: []trust.Signer{withExpiry(30 * time.Minute)}}
+		started := make(chan struct{})
+		m := &trust.SignerManager{
+			SignerGen: gen,
+			Renewer: renewerFunc(func(ctx context.Context, _ trust.Signer) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			RenewTimeout: 200 * time.Millisecond,
+		}
+		done := make(chan error)
+		go func() { done <- m.Refresh(ctx) }()
+		<-started
+		if _, err := m.Sign(ctx, []byte("msg")); err != nil {
+			t.Errorf("Sign failed: %v", err)
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("Refresh returned before the renewal timed out: %v", err)
+		default:
+		}
+		if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Refresh returned %v, want deadline exceeded", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		gen := &staticGen{signers: []trust.Signer{withExpiry(50 * time.Millisecond)}}
+		var events []trust.SignerEventType
+		m := &trust.SignerManager{
+			SignerGen: gen,
+			Events:    func(e trust.SignerEvent) { events = append(events, e.Type) },
+		}
+		if _, err := m.Sign(ctx, []byte("msg")); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if _, err := m.Sign(ctx, []byte("msg")); err == nil {
+			t.Error("Sign should fail once the signer expired")
+		}
+		if err := m.Refresh(ctx); err == nil {
+			t.Error("Refresh should fail without a valid signer")
+		}
+		want := []trust.SignerEventType{trust.SignerChanged, trust.SignerExpired}
+		if !slices.Equal(events, want) {
+			t.Errorf("events %v, want %v", events, want)
+		}
+		if v := m.Validity(); !v.NotAfter.IsZero() {
+			t.Errorf("validity %v, want zero", v)
+		}
+	})
+}
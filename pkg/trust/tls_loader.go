@@ -0,0 +1,72 @@
+package trust
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+// SignerGen generates the signers of the local AS.
+type SignerGen interface {
+	Generate(ctx context.Context) ([]Signer, error)
+}
+
+// TLSCertificateLoader is a wrapper for a SignerGen, converting the
+// Signer to an equivalent tls.Certificate. The signers are generated on
+// every handshake, so renewed certificates are used as soon as they are
+// available.
+type TLSCertificateLoader struct {
+	SignerGen SignerGen
+}
+
+// GetCertificate returns the certificate representing the Signer generated by
+// the SignerGen.
+// This function can be bound to tls.Config.GetCertificate.
+func (l TLSCertificateLoader) GetCertificate(
+	hello *tls.ClientHelloInfo,
+) (*tls.Certificate, error) {
+
+	return l.Get(hello.Context())
+}
+
+// GetClientCertificate returns the certificate representing the Signer
+// generated by the SignerGen.
+// This function can be bound to tls.Config.GetClientCertificate.
+func (l TLSCertificateLoader) GetClientCertificate(
+	reqInfo *tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+
+	return l.Get(reqInfo.Context())
+}
+
+// Get returns the certificate representing the Signer
+// generated by the SignerGen.
+func (l TLSCertificateLoader) Get(ctx context.Context) (*tls.Certificate, error) {
+	signers, err := l.SignerGen.Generate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	signer, err := LastExpiring(signers, cppki.Validity{
+		NotBefore: now,
+		NotAfter:  now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toTLSCertificate(signer), nil
+}
+
+func toTLSCertificate(signer Signer) *tls.Certificate {
+	certificate := make([][]byte, len(signer.Chain))
+	for i := range signer.Chain {
+		certificate[i] = signer.Chain[i].Raw
+	}
+	return &tls.Certificate{
+		Certificate: certificate,
+		PrivateKey:  signer.PrivateKey,
+		Leaf:        signer.Chain[0],
+	}
+}
@@ -0,0 +1,152 @@
+package trust
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/serrors"
+	"github.com/scionproto/scion/pkg/scrypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+)
+
+var (
+	errNotFound = serrors.New("not found")
+	errInactive = serrors.New("inactive")
+)
+
+// TRCState is the state of the TRCs of an ISD at a point in time.
+type TRCState struct {
+	// Active is the latest TRC whose validity period has started.
+	Active cppki.SignedTRC
+	// Grace is the predecessor of the active TRC during the grace period of
+	// the active TRC, and the zero value otherwise.
+	Grace cppki.SignedTRC
+}
+
+// TRCs returns the TRCs that certificate chains are verified against.
+func (s TRCState) TRCs() []cppki.SignedTRC {
+	if s.Grace.IsZero() {
+		return []cppki.SignedTRC{s.Active}
+	}
+	return []cppki.SignedTRC{s.Active, s.Grace}
+}
+
+// TRCVerifier verifies TRCs against their predecessors before they are
+// inserted into the database, so that the database only holds verified TRC
+// update chains.
+type TRCVerifier struct {
+	DB DB
+}
+
+// Verify verifies the TRC. A base TRC must be signed by all its voters and is
+// only accepted for an ISD without TRCs, as trust resets are not supported. A
+// TRC update must be a regular or sensitive update of its predecessor in the
+// database, with a quorum of votes cast by the voters of the predecessor.
+func (v TRCVerifier) Verify(ctx context.Context, trc cppki.SignedTRC) error {
+	id := trc.TRC.ID
+	existing, err := v.DB.SignedTRC(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !existing.IsZero() {
+		if !bytes.Equal(existing.Raw, trc.Raw) {
+			return serrors.New("conflicting TRC in database", "id", id)
+		}
+		return nil
+	}
+	if id.IsBase() {
+		if err := trc.Verify(nil); err != nil {
+			return serrors.Wrap("verifying base TRC", err, "id", id)
+		}
+		latest, err := latestTRC(ctx, v.DB, id.ISD)
+		if err != nil {
+			return err
+		}
+		if !latest.IsZero() {
+			return serrors.New("trust reset not supported", "id", id, "latest", latest.TRC.ID)
+		}
+		return nil
+	}
+	predecessor, err := v.DB.SignedTRC(ctx, predecessorID(trc))
+	if err != nil {
+		return err
+	}
+	if predecessor.IsZero() {
+		return serrors.Wrap("predecessor of TRC", errNotFound, "id", id)
+	}
+	if err := trc.Verify(&predecessor.TRC); err != nil {
+		return serrors.Wrap("verifying TRC update", err, "id", id)
+	}
+	return nil
+}
+
+// Insert verifies the TRC and inserts it into the database. Returns true if
+// the TRC was not yet in the database.
+func (v TRCVerifier) Insert(ctx context.Context, trc cppki.SignedTRC) (bool, error) {
+	if err := v.Verify(ctx, trc); err != nil {
+		return false, err
+	}
+	return v.DB.InsertTRC(ctx, trc)
+}
+
+// State returns the state of the TRCs of the ISD at the given time. TRC
+// updates whose validity period has not started yet are skipped. The
+// predecessor of the active TRC is only included if it is in the database and
+// valid at the given time.
+func (v TRCVerifier) State(ctx context.Context, isd addr.ISD, now time.Time) (TRCState, error) {
+	trc, err := latestTRC(ctx, v.DB, isd)
+	if err != nil {
+		return TRCState{}, err
+	}
+	for !trc.IsZero() && !trc.TRC.ID.IsBase() && now.Before(trc.TRC.Validity.NotBefore) {
+		if trc, err = v.DB.SignedTRC(ctx, predecessorID(trc)); err != nil {
+			return TRCState{}, err
+		}
+	}
+	if trc.IsZero() {
+		return TRCState{}, errNotFound
+	}
+	if !trc.TRC.Validity.Contains(now) {
+		return TRCState{}, errInactive
+	}
+	state := TRCState{Active: trc}
+	if !trc.TRC.InGracePeriod(now) {
+		return state, nil
+	}
+	grace, err := v.DB.SignedTRC(ctx, predecessorID(trc))
+	if err != nil {
+		return TRCState{}, err
+	}
+	if !grace.IsZero() && grace.TRC.Validity.Contains(now) {
+		state.Grace = grace
+	}
+	return state, nil
+}
+
+func latestTRC(ctx context.Context, db DB, isd addr.ISD) (cppki.SignedTRC, error) {
+	return db.SignedTRC(ctx, cppki.TRCID{
+		ISD:    isd,
+		Base:   scrypto.LatestVer,
+		Serial: scrypto.LatestVer,
+	})
+}
+
+func predecessorID(trc cppki.SignedTRC) cppki.TRCID {
+	return cppki.TRCID{
+		ISD:    trc.TRC.ID.ISD,
+		Base:   trc.TRC.ID.Base,
+		Serial: trc.TRC.ID.Serial - 1,
+	}
+}
+
+// activeTRCs returns the active TRCs of the ISD. During the grace period of
+// the active TRC, its predecessor is active as well.
+func activeTRCs(ctx context.Context, db DB, isd addr.ISD) ([]cppki.SignedTRC, error) {
+	state, err := TRCVerifier{DB: db}.State(ctx, isd, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return state.TRCs(), nil
+}
@@ -0,0 +1,181 @@
+package trust_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/fancl20/cion/pkg/trust"
+	"github.com/fancl20/cion/pkg/trust/impl/bbolt"
+	"github.com/fancl20/cion/pkg/trust/trusttest"
+)
+
+var coreIA = addr.MustParseIA("1-ff00:0:110")
+
+func newDB(t *testing.T) trust.DB {
+	t.Helper()
+	db, err := bbolt.New(filepath.Join(t.TempDir(), "trust.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestTRCVerifier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := map[string]struct {
+		// trcs are inserted in order, and all but the last must succeed.
+		trcs    func(t *testing.T) []cppki.SignedTRC
+		wantErr bool
+	}{
+		"base": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				return []cppki.SignedTRC{trusttest.NewISD(t, coreIA).TRC}
+			},
+		},
+		"same base twice": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				isd := trusttest.NewISD(t, coreIA)
+				return []cppki.SignedTRC{isd.TRC, isd.TRC}
+			},
+		},
+		"trust reset": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				return []cppki.SignedTRC{
+					trusttest.NewISD(t, coreIA).TRC,
+					trusttest.NewISD(t, coreIA).TRC,
+				}
+			},
+			wantErr: true,
+		},
+		"regular and sensitive updates": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				isd := trusttest.NewISD(t, coreIA)
+				base := isd.TRC
+				return []cppki.SignedTRC{
+					base,
+					isd.Update(t, cppki.RegularUpdate, now, time.Hour),
+					isd.Update(t, cppki.SensitiveUpdate, now, time.Hour),
+					isd.Update(t, cppki.RegularUpdate, now, time.Hour),
+				}
+			},
+		},
+		"missing predecessor": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				isd := trusttest.NewISD(t, coreIA)
+				base := isd.TRC
+				isd.Update(t, cppki.RegularUpdate, now, time.Hour)
+				return []cppki.SignedTRC{base, isd.Update(t, cppki.RegularUpdate, now, time.Hour)}
+			},
+			wantErr: true,
+		},
+		"update by other voters": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				rogue := trusttest.NewISD(t, coreIA)
+				return []cppki.SignedTRC{
+					trusttest.NewISD(t, coreIA).TRC,
+					rogue.Update(t, cppki.SensitiveUpdate, now, time.Hour),
+				}
+			},
+			wantErr: true,
+		},
+		"conflicting update": {
+			trcs: func(t *testing.T) []cppki.SignedTRC {
+				isd := trusttest.NewISD(t, coreIA)
+				base := isd.TRC
+				update := isd.Update(t, cppki.RegularUpdate, now, time.Hour)
+				isd.TRC = base
+				return []cppki.SignedTRC{
+					base,
+					update,
+					isd.Update(t, cppki.RegularUpdate, now, 2*time.Hour),
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := trust.TRCVerifier{DB: newDB(t)}
+			trcs := tc.trcs(t)
+			for i, trc := range trcs {
+				_, err := v.Insert(ctx, trc)
+				if last := i == len(trcs)-1; last && tc.wantErr {
+					if err == nil {
+						t.Errorf("inserting TRC %s should fail", trc.TRC.ID)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("inserting TRC %s failed: %v", trc.TRC.ID, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTRCVerifierState(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := map[string]struct {
+		notBefore  time.Time
+		grace      time.Duration
+		wantActive scrypto.Version
+		wantGrace  scrypto.Version
+	}{
+		"in grace period": {
+			notBefore:  now.Add(-10 * time.Minute),
+			grace:      time.Hour,
+			wantActive: 2,
+			wantGrace:  1,
+		},
+		"after grace period": {
+			notBefore:  now.Add(-10 * time.Minute),
+			grace:      time.Minute,
+			wantActive: 2,
+		},
+		"not yet valid": {
+			notBefore:  now.Add(10 * time.Minute),
+			grace:      time.Hour,
+			wantActive: 1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			isd := trusttest.NewISD(t, coreIA)
+			v := trust.TRCVerifier{DB: newDB(t)}
+			base := isd.TRC
+			for _, trc := range []cppki.SignedTRC{
+				base,
+				isd.Update(t, cppki.RegularUpdate, tc.notBefore, tc.grace),
+			} {
+				if _, err := v.Insert(ctx, trc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			state, err := v.State(ctx, coreIA.ISD(), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := state.Active.TRC.ID.Serial; got != tc.wantActive {
+				t.Errorf("active TRC has serial %d, want %d", got, tc.wantActive)
+			}
+			if got := state.Grace.TRC.ID.Serial; got != tc.wantGrace {
+				t.Errorf("grace TRC has serial %d, want %d", got, tc.wantGrace)
+			}
+		})
+	}
+
+	if _, err := (trust.TRCVerifier{DB: newDB(t)}).State(ctx, coreIA.ISD(), now); err == nil {
+		t.Error("State should fail without TRCs")
+	}
+}
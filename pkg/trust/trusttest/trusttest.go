@@ -0,0 +1,198 @@
+// Package trusttest generates control plane PKI material for tests.
+package trusttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cms/protocol"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/scionproto/scion/pkg/scrypto/signed"
+
+	"github.com/fancl20/cion/pkg/pki"
+	"github.com/fancl20/cion/pkg/trust"
+)
+
+// ISD is the trust material of an ISD with a single core AS.
+type ISD struct {
+	// TRC is the latest TRC of the ISD, signed by the voting keys of the core
+	// AS. It is the base TRC until Update is called.
+	TRC cppki.SignedTRC
+	// ASes contains the keys and certificate chains of the ASes.
+	ASes map[addr.IA]AS
+	// CA is the CA key and certificate that issued the AS certificates.
+	CA pki.Credential
+
+	core      addr.IA
+	validity  cppki.Validity
+	sensitive pki.Credential
+	regular   pki.Credential
+}
+
+// AS is the key and certificate chain of an AS.
+type AS struct {
+	Key   *ecdsa.PrivateKey
+	Chain []*x509.Certificate
+}
+
+// Signer returns a signer for the key of the AS.
+func (isd *ISD) Signer(ia addr.IA) trust.Signer {
+	as := isd.ASes[ia]
+	return trust.Signer{
+		PrivateKey:   as.Key,
+		Algorithm:    signed.ECDSAWithSHA256,
+		IA:           ia,
+		Subject:      as.Chain[0].Subject,
+		Chain:        as.Chain,
+		SubjectKeyID: as.Chain[0].SubjectKeyId,
+		Expiration:   as.Chain[0].NotAfter,
+		TRCID:        isd.TRC.TRC.ID,
+		ChainValidity: cppki.Validity{
+			NotBefore: as.Chain[0].NotBefore,
+			NotAfter:  as.Chain[0].NotAfter,
+		},
+	}
+}
+
+// NewISD generates the base TRC of the ISD of the core AS. The core AS holds
+// all voting and root keys and issues the AS certificates of the core AS and
+// the given ASes. Everything is valid from an hour ago for a day.
+func NewISD(t testing.TB, core addr.IA, ases ...addr.IA) *ISD {
+	t.Helper()
+	validity := cppki.Validity{
+		NotBefore: time.Now().Add(-time.Hour).Truncate(time.Second),
+		NotAfter:  time.Now().Add(24 * time.Hour).Truncate(time.Second),
+	}
+
+	isd := &ISD{
+		ASes:      make(map[addr.IA]AS),
+		core:      core,
+		validity:  validity,
+		sensitive: newCredential(t, cppki.Sensitive, core, validity, pki.Credential{}),
+		regular:   newCredential(t, cppki.Regular, core, validity, pki.Credential{}),
+	}
+	root := isd.issue(t, append([]addr.IA{core}, ases...))
+	isd.TRC = signTRC(t, cppki.TRC{
+		Version:           1,
+		ID:                cppki.TRCID{ISD: core.ISD(), Base: 1, Serial: 1},
+		Validity:          validity,
+		Quorum:            1,
+		CoreASes:          []addr.AS{core.AS()},
+		AuthoritativeASes: []addr.AS{core.AS()},
+		Description:       "test TRC",
+		Certificates:      []*x509.Certificate{isd.sensitive.Cert, isd.regular.Cert, root},
+	}, isd.sensitive, isd.regular)
+	return isd
+}
+
+// issue creates a new root and CA certificate, issues new AS certificates
+// for the ASes and returns the root certificate. The CA certificate replaces
+// CA.
+func (isd *ISD) issue(t testing.TB, ases []addr.IA) *x509.Certificate {
+	t.Helper()
+	root := newCredential(t, cppki.Root, isd.core, isd.validity, pki.Credential{})
+	ca := newCredential(t, cppki.CA, isd.core, isd.validity, root)
+	isd.CA = ca
+	for _, ia := range ases {
+		as := newCredential(t, cppki.AS, ia, isd.validity, ca)
+		isd.ASes[ia] = AS{Key: as.Key.(*ecdsa.PrivateKey), Chain: []*x509.Certificate{as.Cert, ca.Cert}}
+	}
+	return root.Cert
+}
+
+// Update issues the next TRC of the ISD and makes it the current TRC. The
+// update is valid from notBefore until the end of the validity of the ISD, and
+// its grace period is the given duration. A regular update is voted for by the
+// regular voting key. A sensitive update replaces the sensitive voting key and
+// the root certificate and is voted for by the previous sensitive voting key.
+// The AS certificates are reissued under the new root, so the previous chains
+// only verify against the previous TRCs.
+func (isd *ISD) Update(t testing.TB, typ cppki.UpdateType, notBefore time.Time,
+	grace time.Duration) cppki.SignedTRC {
+
+	t.Helper()
+	pred := isd.TRC.TRC
+	next := pred
+	next.ID.Serial++
+	next.Validity = cppki.Validity{
+		NotBefore: notBefore.Truncate(time.Second),
+		NotAfter:  isd.validity.NotAfter,
+	}
+	next.GracePeriod = grace
+	next.Description = fmt.Sprintf("test TRC update %d", next.ID.Serial)
+	next.Certificates = slices.Clone(pred.Certificates)
+
+	var signers []pki.Credential
+	switch typ {
+	case cppki.RegularUpdate:
+		next.Votes = []int{slices.IndexFunc(pred.Certificates, isd.regular.Cert.Equal)}
+		signers = []pki.Credential{isd.regular}
+	case cppki.SensitiveUpdate:
+		idx := slices.IndexFunc(pred.Certificates, isd.sensitive.Cert.Equal)
+		next.Votes = []int{idx}
+		signers = []pki.Credential{isd.sensitive}
+		isd.sensitive = newCredential(t, cppki.Sensitive, isd.core, isd.validity, pki.Credential{})
+		next.Certificates[idx] = isd.sensitive.Cert
+		rootIdx := slices.IndexFunc(pred.Certificates, func(c *x509.Certificate) bool {
+			ct, err := cppki.ValidateCert(c)
+			return err == nil && ct == cppki.Root
+		})
+		next.Certificates[rootIdx] = isd.issue(t, slices.Collect(maps.Keys(isd.ASes)))
+		// New voters show possession of their key by signing.
+		signers = append(signers, isd.sensitive)
+	default:
+		t.Fatalf("unsupported update type %s", typ)
+	}
+	isd.TRC = signTRC(t, next, signers...)
+	return isd.TRC
+}
+
+// signTRC encodes the TRC and signs it with the voters.
+func signTRC(t testing.TB, trc cppki.TRC, signers ...pki.Credential) cppki.SignedTRC {
+	t.Helper()
+	raw, err := trc.Encode()
+	if err != nil {
+		t.Fatalf("encoding TRC: %v", err)
+	}
+	eci, err := protocol.NewDataEncapsulatedContentInfo(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := protocol.NewSignedData(eci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range signers {
+		if err := sd.AddSignerInfo([]*x509.Certificate{v.Cert}, v.Key); err != nil {
+			t.Fatalf("signing TRC: %v", err)
+		}
+	}
+	signedRaw, err := sd.ContentInfoDER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := cppki.DecodeSignedTRC(signedRaw)
+	if err != nil {
+		t.Fatalf("decoding TRC: %v", err)
+	}
+	return signed
+}
+
+// newCredential generates a key and a certificate of the given type. Root and
+// voting certificates are self-signed and take a zero issuer.
+func newCredential(t testing.TB, typ cppki.CertType, ia addr.IA, validity cppki.Validity,
+	issuer pki.Credential) pki.Credential {
+
+	t.Helper()
+	cred, err := pki.NewCredential(typ, ia, validity, issuer)
+	if err != nil {
+		t.Fatalf("creating %s certificate: %v", typ, err)
+	}
+	return cred
+}